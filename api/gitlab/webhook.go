@@ -1,82 +1,212 @@
 package handler
 
 import (
-	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
-	"strconv"
-
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"pachca.com/android-deployment/audit"
+	"pachca.com/android-deployment/config"
+	"pachca.com/android-deployment/logging"
+	"pachca.com/android-deployment/metrics"
+	"pachca.com/android-deployment/pachca"
+	"pachca.com/android-deployment/queue"
+	"pachca.com/android-deployment/release"
 	"pachca.com/android-deployment/shared"
+	"pachca.com/android-deployment/tracing"
 )
 
 type GitlabPayload struct {
-	Event  string          `json:"event"`
-	Result string          `json:"result"`
-	Data   json.RawMessage `json:"data"`
+	Event  string `json:"event"`
+	Result string `json:"result"`
+	// JobID is the CI job that reports the event. Together with the event and the release
+	// it identifies a delivery, so that a webhook GitLab sends again is processed once.
+	JobID int `json:"job_id"`
+	// Traceparent is the TRACEPARENT variable of the pipeline, which links the event
+	// to the trace of the action that started the pipeline.
+	Traceparent string          `json:"traceparent,omitempty"`
+	Data        json.RawMessage `json:"data"`
+}
+
+// GitlabTarget is the part of the event data every event shares.
+type GitlabTarget struct {
+	shared.ReleaseInfo
+	FailedJob GitlabJob `json:"failed_job"`
 }
 
 type GitlabBuildData struct {
 	shared.ReleaseInfo
 }
 
-type Config struct {
-	PachcaBaseURL string
-	PachcaAPIKey  string
-	ChatID        int
+type GitlabPromoteData struct {
+	shared.ReleaseInfo
+	RolloutPercentage int `json:"rollout_percentage"`
 }
 
-type PachcaMessageRequest struct {
-	Message struct {
-		EntityType string           `json:"entity_type"`
-		EntityID   int              `json:"entity_id"`
-		Content    string           `json:"content"`
-		Buttons    [][]PachcaButton `json:"buttons"`
-	} `json:"message"`
+type GitlabRolloutData struct {
+	shared.ReleaseInfo
+	RolloutPercentage int `json:"rollout_percentage"`
 }
 
-type PachcaButton struct {
-	Text string `json:"text"`
-	Data string `json:"data"`
+type GitlabHaltData struct {
+	shared.ReleaseInfo
 }
 
-type PachcaMessageResponse struct {
-	Data struct {
-		ID int `json:"id"`
-	} `json:"data"`
+type GitlabOtherStoresData struct {
+	shared.ReleaseInfo
+	Stores []GitlabStoreResult `json:"stores"`
 }
 
-func Handler(w http.ResponseWriter, r *http.Request) {
-	HandleGitlabHook(w, r, http.DefaultClient)
+type GitlabStoreResult struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+}
+
+type GitlabFailureData struct {
+	shared.ReleaseInfo
+	FailedJob GitlabJob `json:"failed_job"`
+}
+
+type GitlabJob struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Stage string `json:"stage"`
+}
+
+// failureDescriptions names the step that failed for every event that can be retried.
+var failureDescriptions = map[string]string{
+	"build":        "Upload of release %s (%d) to Google Play Internal failed",
+	"promote":      "Promotion of release %s (%d) to production failed",
+	"rollout":      "Rollout update of release %s (%d) failed",
+	"other_stores": "Release of %s (%d) to other stores failed",
+	"halt":         "Halting the rollout of release %s (%d) failed",
 }
 
-func HandleGitlabHook(w http.ResponseWriter, r *http.Request, client *http.Client) {
-	config, err := NewConfig()
+const tokenHeader = "X-Gitlab-Token"
+
+// requestIDHeader lets the CI job tag the logs of a webhook with its own ID.
+const requestIDHeader = "X-Request-Id"
+
+// JobKind names queued Gitlab payloads.
+const JobKind = "gitlab"
+
+// deliveryLease is how long a delivery may take before a repeated one takes it over.
+const deliveryLease = time.Minute
+
+// loadConfig reads the configuration and sets up logging and tracing once per process rather than on every webhook.
+var loadConfig = sync.OnceValues(func() (*config.Config, error) {
+	config, err := config.LoadFromEnv()
 	if err != nil {
-		log.Printf("Config error: %s", err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, err
+	}
+	if err := config.ValidateServerless(); err != nil {
+		return nil, err
+	}
+	if err := logging.Setup(config.Log); err != nil {
+		return nil, err
+	}
+	_, err = tracing.Setup(context.Background(), config.Tracing)
+	return config, err
+})
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	config, err := loadConfig()
+	if err != nil {
+		slog.Error("Config error", "error", err)
+		http.Error(w, "Invalid configuration", http.StatusInternalServerError)
+		return
+	}
+
+	HandleGitlabHook(w, r, config, http.DefaultClient)
+
+	// The platform may freeze the process once the response is sent.
+	if err := tracing.Flush(r.Context()); err != nil {
+		slog.Error("Error exporting spans", "error", err)
+	}
+}
+
+func HandleGitlabHook(w http.ResponseWriter, r *http.Request, config *config.Config, client *http.Client) {
+	r = r.WithContext(logging.WithRequestID(r.Context(), r.Header.Get(requestIDHeader)))
+
+	webhook := metrics.NewWebhook(w, metrics.ServiceGitlab)
+	defer webhook.Done()
+	w = webhook
+
+	r, span := tracing.StartWebhook(r, metrics.ServiceGitlab)
+	defer func() { tracing.EndWebhook(span, webhook.Status()) }()
+
+	if !verifyToken(config.Gitlab.WebhookToken, r.Header.Get(tokenHeader)) {
+		slog.WarnContext(r.Context(), "Rejected Gitlab payload: missing or invalid token", "remote_addr", r.RemoteAddr, "header", tokenHeader)
+		http.Error(w, "Invalid token", http.StatusUnauthorized)
 		return
 	}
 
 	bodyBytes, _ := io.ReadAll(r.Body)
-	log.Printf("Incoming Gitlab payload: %s", string(bodyBytes))
+	logging.Payload(r.Context(), "Incoming Gitlab payload", bodyBytes)
 
 	var payload GitlabPayload
 	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
 		http.Error(w, "Invalid payload", http.StatusBadRequest)
 		return
 	}
+	webhook.Type = "pipeline"
+	tracing.Set(r.Context(), attribute.String("gitlab.event", payload.Event), attribute.String("gitlab.result", payload.Result))
 
-	if payload.Event != "build" || payload.Result != "success" {
+	if !handled(payload) {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
+	webhook.Action, webhook.Result = payload.Event, "success"
+	if payload.Result != "success" {
+		webhook.Result = "failed"
+	}
+
+	var target GitlabTarget
+	if err := json.Unmarshal(payload.Data, &target); err != nil || target.VersionCode == 0 {
+		http.Error(w, "Invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	if config.Queue.Store != "" {
+		jobs, err := queue.Open(config.Queue.Store, config.Queue.Path)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Queue error", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		job, err := jobs.Enqueue(r.Context(), JobKind, bodyBytes, time.Now())
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Error queueing Gitlab payload", "event", payload.Event, "version_code", target.VersionCode, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Queued Gitlab payload", "event", payload.Event, "version_code", target.VersionCode, "job_id", job.ID)
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
 
-	err = HandleGitlabBuildSuccess(r.Context(), client, config, payload.Data)
+	err := processPayload(r.Context(), config, client, payload, target)
+	var transitionErr *release.TransitionError
+	if errors.Is(err, release.ErrDeliveryInProgress) {
+		http.Error(w, "Delivery in progress", http.StatusConflict)
+		return
+	}
+	if errors.As(err, &transitionErr) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -85,40 +215,208 @@ func HandleGitlabHook(w http.ResponseWriter, r *http.Request, client *http.Clien
 	w.WriteHeader(http.StatusOK)
 }
 
-func NewConfig() (*Config, error) {
-	pachcaBaseURL := os.Getenv(shared.EnvPachcaUrl)
-	if pachcaBaseURL == "" {
-		return nil, fmt.Errorf("ENV_PACHCA_URL not set")
+// ProcessGitlabJob processes a Gitlab payload that HandleGitlabHook has queued.
+// Events the release lifecycle rejects are reported to the internal chat and not retried.
+func ProcessGitlabJob(ctx context.Context, config *config.Config, client *http.Client, bodyBytes []byte) error {
+	var payload GitlabPayload
+	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
+		return queue.Permanent(err)
+	}
+
+	var target GitlabTarget
+	if err := json.Unmarshal(payload.Data, &target); err != nil {
+		return queue.Permanent(err)
+	}
+
+	err := processPayload(ctx, config, client, payload, target)
+	var transitionErr *release.TransitionError
+	if errors.As(err, &transitionErr) {
+		return nil
+	}
+	return err
+}
+
+// successHandlers process the events of a successful job.
+var successHandlers = map[string]func(ctx context.Context, pachcaClient *pachca.Client, delivery *release.Delivery, config *config.Config, data json.RawMessage) error{
+	"build":        HandleGitlabBuildSuccess,
+	"promote":      HandleGitlabPromoteSuccess,
+	"rollout":      HandleGitlabRolloutSuccess,
+	"other_stores": HandleGitlabOtherStoresSuccess,
+	"halt":         HandleGitlabHaltSuccess,
+}
+
+// handled reports whether the payload is an event the bot reacts to.
+func handled(payload GitlabPayload) bool {
+	if payload.Result != "success" {
+		_, ok := failureDescriptions[payload.Event]
+		return ok
 	}
 
-	pachcaAPIKey := os.Getenv(shared.EnvPachcaKey)
-	if pachcaAPIKey == "" {
-		return nil, fmt.Errorf("ENV_PACHCA_KEY not set")
+	_, ok := successHandlers[payload.Event]
+	return ok
+}
+
+// processPayload handles the event once per delivery, resuming a delivery that failed halfway.
+func processPayload(ctx context.Context, config *config.Config, client *http.Client, payload GitlabPayload, target GitlabTarget) (err error) {
+	key := deliveryKey(payload, target)
+	ctx = logging.With(ctx, "event", payload.Event, "result", payload.Result, "version_code", target.VersionCode, "delivery", key)
+
+	ctx, span := tracing.StartLinked(ctx, "gitlab "+payload.Event, payload.Traceparent)
+	defer func() { tracing.End(span, err) }()
+	tracing.SetRelease(ctx, &target.ReleaseInfo)
+	tracing.Set(ctx, attribute.String("gitlab.event", payload.Event), attribute.String("gitlab.result", payload.Result))
+
+	store, err := release.OpenStore(config.Release.Store, config.Release.StorePath)
+	if err != nil {
+		slog.ErrorContext(ctx, "Release store error", "error", err)
+		return err
+	}
+
+	delivery, err := release.ClaimDelivery(ctx, store, target.VersionCode, key, time.Now(), deliveryLease)
+	if errors.Is(err, release.ErrDeliveryDone) {
+		slog.InfoContext(ctx, "Skipped repeated delivery")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	pachcaClient := pachca.NewClient(config.Pachca.URL, config.Pachca.Key, client, pachca.WithRetryPolicy(config.Pachca.RetryPolicy()))
+
+	if payload.Result == "success" {
+		err = successHandlers[payload.Event](ctx, pachcaClient, delivery, config, payload.Data)
+	} else {
+		err = HandleGitlabFailure(ctx, pachcaClient, delivery, config, payload.Event, payload.Data)
+	}
+
+	// A rejected event stays rejected, so only other failures leave the delivery open for a retry.
+	var transitionErr *release.TransitionError
+	if err == nil || errors.As(err, &transitionErr) {
+		if finishErr := delivery.Finish(ctx); finishErr != nil {
+			return finishErr
+		}
+	} else if abandonErr := delivery.Abandon(ctx); abandonErr != nil {
+		slog.ErrorContext(ctx, "Error abandoning delivery", "error", abandonErr)
+	}
+
+	switch {
+	case transitionErr != nil:
+	case err != nil:
+		slog.ErrorContext(ctx, "Error processing Gitlab event", "error", err)
+	default:
+		slog.InfoContext(ctx, "Processed Gitlab event")
+		recordResult(ctx, config, payload, target)
 	}
 
-	chatIDStr := os.Getenv(shared.EnvPachcaInternalChatId)
-	if chatIDStr == "" {
-		return nil, fmt.Errorf("ENV_PACHCA_INTERNAL_CHAT_ID not set")
+	return err
+}
+
+// recordResult appends the result of a pipeline started from Pachca to the audit log, on behalf
+// of the user who started it. Like the other audit entries, it does not fail the event when the log
+// cannot be written.
+func recordResult(ctx context.Context, config *config.Config, payload GitlabPayload, target GitlabTarget) {
+	action, ok := shared.PipelineActions[payload.Event]
+	if !ok {
+		return
 	}
 
-	chatID, err := strconv.Atoi(chatIDStr)
+	entry := &audit.Entry{At: time.Now(), Action: action, ReleaseInfo: target.ReleaseInfo, JobID: target.JobID, Outcome: audit.OutcomeSucceeded}
+	if payload.Result != "success" {
+		entry.JobID = target.FailedJob.ID
+		entry.Outcome = audit.OutcomeJobFailed
+		entry.Error = fmt.Sprintf("job %s (%d) failed at stage %s", target.FailedJob.Name, target.FailedJob.ID, target.FailedJob.Stage)
+	}
+	if payload.Event == "other_stores" && payload.Result == "success" {
+		var storesData GitlabOtherStoresData
+		if err := json.Unmarshal(payload.Data, &storesData); err == nil {
+			if failed := failedStores(storesData.Stores); len(failed) > 0 {
+				entry.Outcome = audit.OutcomeJobFailed
+				entry.Error = "stores " + strings.Join(failed, ", ") + " failed"
+			}
+		}
+	}
+
+	auditLog, err := audit.Open(config.Audit.Store, config.Audit.Path)
 	if err != nil {
-		return nil, fmt.Errorf("invalid ENV_PACHCA_INTERNAL_CHAT_ID")
+		slog.ErrorContext(ctx, "Error writing audit log", "outcome", entry.Outcome, "error", err)
+		return
+	}
+
+	// The latest start of the action, or a retry of its failed job, is what produced this result.
+	entries, err := auditLog.Query(ctx, audit.Filter{VersionCode: target.VersionCode})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error reading audit log", "error", err)
+	}
+	for _, started := range slices.Backward(entries) {
+		if started.Outcome == audit.OutcomeStarted && (started.Action == action || started.Action == shared.ActionRetry) {
+			entry.UserID, entry.PipelineID = started.UserID, started.PipelineID
+			break
+		}
+	}
+
+	if err := auditLog.Append(ctx, entry); err != nil {
+		slog.ErrorContext(ctx, "Error writing audit log", "outcome", entry.Outcome, "error", err)
+	}
+}
+
+// verifyToken compares the X-Gitlab-Token header with the configured secret in constant time.
+func verifyToken(expected string, token string) bool {
+	if token == "" {
+		return false
 	}
 
-	return &Config{
-		PachcaBaseURL: pachcaBaseURL,
-		PachcaAPIKey:  pachcaAPIKey,
-		ChatID:        chatID,
-	}, nil
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(token)) == 1
 }
 
-func HandleGitlabBuildSuccess(ctx context.Context, client *http.Client, config *Config, data json.RawMessage) error {
+// deliveryKey identifies the event a webhook reports by the job that reported it.
+// Without a reporting job the failed job identifies a failure, and the digest of the data
+// any other event, so that only identical deliveries are taken for repeats.
+func deliveryKey(payload GitlabPayload, target GitlabTarget) string {
+	switch {
+	case payload.JobID != 0:
+		return fmt.Sprintf("%s:%s:%d", payload.Event, payload.Result, payload.JobID)
+	case payload.Result != "success" && target.FailedJob.ID != 0:
+		return fmt.Sprintf("%s:%s:%d", payload.Event, payload.Result, target.FailedJob.ID)
+	default:
+		digest := sha256.Sum256(payload.Data)
+		return fmt.Sprintf("%s:%s:%x", payload.Event, payload.Result, digest[:8])
+	}
+}
+
+func HandleGitlabBuildSuccess(ctx context.Context, pachcaClient *pachca.Client, delivery *release.Delivery, config *config.Config, data json.RawMessage) error {
 	var buildData GitlabBuildData
 	if err := json.Unmarshal(data, &buildData); err != nil {
 		return err
 	}
 
+	if !delivery.Completed("message") {
+		if err := createBuildMessage(ctx, pachcaClient, delivery, config, buildData); err != nil {
+			return err
+		}
+	}
+
+	if !delivery.Completed("pin") {
+		r, err := delivery.Get(ctx)
+		if err != nil {
+			return err
+		}
+		if err := pachcaClient.PinMessage(ctx, r.MessageID); err != nil {
+			return err
+		}
+		if _, err := delivery.Complete(ctx, "pin", nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createBuildMessage posts the release message and stores it in the same update that moves the release to internal testing.
+func createBuildMessage(ctx context.Context, pachcaClient *pachca.Client, delivery *release.Delivery, config *config.Config, buildData GitlabBuildData) error {
+	if err := checkTransition(ctx, pachcaClient, delivery, config, "build", buildData.ReleaseInfo, release.StateInternal); err != nil {
+		return err
+	}
+
 	content := fmt.Sprintf(
 		"Release %s (%d) uploaded to Google Play Internal. Built by job %d.",
 		buildData.VersionName, buildData.VersionCode, buildData.JobID,
@@ -129,92 +427,472 @@ func HandleGitlabBuildSuccess(ctx context.Context, client *http.Client, config *
 		VersionCode: buildData.VersionCode,
 		VersionName: buildData.VersionName,
 	}
-	releaseInfoJSON, _ := json.Marshal(releaseInfo)
 
-	button := []PachcaButton{
+	button := []pachca.Button{
 		{
 			Text: "Promote release",
-			Data: fmt.Sprintf("promote|%s", string(releaseInfoJSON)),
+			Data: buttonData(config, "promote", releaseInfo),
+		},
+	}
+	buttons := [][]pachca.Button{button}
+
+	message, err := pachcaClient.CreateMessage(ctx, pachca.MessageCreateRequest{
+		Message: pachca.NewMessage{
+			EntityType: "discussion",
+			EntityID:   config.Pachca.InternalChatID,
+			Content:    content,
+			Buttons:    buttons,
 		},
+	})
+	if err != nil {
+		return err
 	}
-	buttons := [][]PachcaButton{button}
 
-	var messageReq PachcaMessageRequest
-	messageReq.Message.EntityType = "discussion"
-	messageReq.Message.EntityID = config.ChatID
-	messageReq.Message.Content = content
-	messageReq.Message.Buttons = buttons
+	_, err = delivery.Complete(ctx, "message", func(r *release.Release) error {
+		r.VersionName = buildData.VersionName
+		r.JobID = buildData.JobID
+		r.MessageID = message.ID
+		r.Track = release.TrackInternal
+		if err := r.Transition(release.StateInternal); err != nil {
+			return err
+		}
+		r.Record(time.Now(), "build", fmt.Sprintf("job %d", buildData.JobID))
+		return nil
+	})
+	return err
+}
 
-	messageID, err := sendMessage(ctx, client, config, messageReq)
+func HandleGitlabPromoteSuccess(ctx context.Context, pachcaClient *pachca.Client, delivery *release.Delivery, config *config.Config, data json.RawMessage) error {
+	var promoteData GitlabPromoteData
+	err := json.Unmarshal(data, &promoteData)
 	if err != nil {
 		return err
 	}
+	if delivery.Completed("edit") {
+		return nil
+	}
 
-	if err := pinMessage(ctx, client, config, messageID); err != nil {
+	promoteData.MessageID, err = releaseMessageID(ctx, delivery, promoteData.ReleaseInfo)
+	if err != nil {
 		return err
 	}
+	if promoteData.MessageID == 0 {
+		return fmt.Errorf("promote event has no message_id")
+	}
 
-	return nil
+	state, err := release.ProductionState(promoteData.RolloutPercentage)
+	if err != nil {
+		return fmt.Errorf("promote event: %w", err)
+	}
+	if err := checkTransition(ctx, pachcaClient, delivery, config, "promote", promoteData.ReleaseInfo, state); err != nil {
+		return err
+	}
+
+	content := fmt.Sprintf(
+		"Release %s (%d) is in the Google Play production track, rolled out to %d%% of users.",
+		promoteData.VersionName, promoteData.VersionCode, promoteData.RolloutPercentage,
+	)
+
+	_, err = pachcaClient.EditMessage(ctx, promoteData.MessageID, pachca.MessageUpdateRequest{
+		Message: pachca.MessageUpdate{
+			Content: content,
+			Buttons: productionButtons(config, promoteData.ReleaseInfo, state),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = delivery.Complete(ctx, "edit", func(r *release.Release) error {
+		r.VersionName = promoteData.VersionName
+		r.MessageID = promoteData.MessageID
+		r.Track = release.TrackProduction
+		if err := r.Transition(state); err != nil {
+			return err
+		}
+		r.RolloutPercentage = promoteData.RolloutPercentage
+		r.Record(time.Now(), "promote", fmt.Sprintf("%d%%", promoteData.RolloutPercentage))
+		return nil
+	})
+	return err
 }
 
-func sendMessage(ctx context.Context, client *http.Client, config *Config, messageReq PachcaMessageRequest) (int, error) {
-	payloadBytes, err := json.Marshal(messageReq)
+func HandleGitlabRolloutSuccess(ctx context.Context, pachcaClient *pachca.Client, delivery *release.Delivery, config *config.Config, data json.RawMessage) error {
+	var rolloutData GitlabRolloutData
+	err := json.Unmarshal(data, &rolloutData)
 	if err != nil {
-		return 0, err
+		return err
+	}
+	if delivery.Completed("edit") {
+		return nil
 	}
 
-	log.Printf("Outgoing Pachca payload: %s", string(payloadBytes))
+	rolloutData.MessageID, err = releaseMessageID(ctx, delivery, rolloutData.ReleaseInfo)
+	if err != nil {
+		return err
+	}
+	if rolloutData.MessageID == 0 {
+		return fmt.Errorf("rollout event has no message_id")
+	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", config.PachcaBaseURL+"/messages", bytes.NewReader(payloadBytes))
+	state, err := release.ProductionState(rolloutData.RolloutPercentage)
 	if err != nil {
-		return 0, err
+		return fmt.Errorf("rollout event: %w", err)
+	}
+	if err := checkTransition(ctx, pachcaClient, delivery, config, "rollout", rolloutData.ReleaseInfo, state); err != nil {
+		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+config.PachcaAPIKey)
+	content := fmt.Sprintf(
+		"Release %s (%d) is in the Google Play production track, rollout updated to %d%% of users.",
+		rolloutData.VersionName, rolloutData.VersionCode, rolloutData.RolloutPercentage,
+	)
 
-	resp, err := client.Do(req)
+	_, err = pachcaClient.EditMessage(ctx, rolloutData.MessageID, pachca.MessageUpdateRequest{
+		Message: pachca.MessageUpdate{
+			Content: content,
+			Buttons: productionButtons(config, rolloutData.ReleaseInfo, state),
+		},
+	})
 	if err != nil {
-		return 0, err
+		return err
 	}
-	defer resp.Body.Close()
 
-	respBody, _ := io.ReadAll(resp.Body)
-	log.Printf("Pachca response: %s", string(respBody))
+	_, err = delivery.Complete(ctx, "edit", func(r *release.Release) error {
+		r.VersionName = rolloutData.VersionName
+		r.MessageID = rolloutData.MessageID
+		r.Track = release.TrackProduction
+		if err := r.Transition(state); err != nil {
+			return err
+		}
+		r.RolloutPercentage = rolloutData.RolloutPercentage
+		r.Record(time.Now(), "rollout", fmt.Sprintf("%d%%", rolloutData.RolloutPercentage))
+		return nil
+	})
+	return err
+}
 
-	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("Pachca API returned status %d", resp.StatusCode)
+// HandleGitlabHaltSuccess reports a rollout halted in Google Play, leaving only the button that resumes it.
+func HandleGitlabHaltSuccess(ctx context.Context, pachcaClient *pachca.Client, delivery *release.Delivery, config *config.Config, data json.RawMessage) error {
+	var haltData GitlabHaltData
+	err := json.Unmarshal(data, &haltData)
+	if err != nil {
+		return err
+	}
+	if delivery.Completed("edit") {
+		return nil
 	}
 
-	var messageResp PachcaMessageResponse
-	if err := json.Unmarshal(respBody, &messageResp); err != nil {
-		return 0, err
+	haltData.MessageID, err = releaseMessageID(ctx, delivery, haltData.ReleaseInfo)
+	if err != nil {
+		return err
+	}
+	if haltData.MessageID == 0 {
+		return fmt.Errorf("halt event has no message_id")
 	}
 
-	return messageResp.Data.ID, nil
-}
+	if err := checkTransition(ctx, pachcaClient, delivery, config, "halt", haltData.ReleaseInfo, release.StateHalted); err != nil {
+		return err
+	}
+
+	content := fmt.Sprintf(
+		"Rollout of release %s (%d) is halted in the Google Play production track.",
+		haltData.VersionName, haltData.VersionCode,
+	)
 
-func pinMessage(ctx context.Context, client *http.Client, config *Config, messageID int) error {
-	url := fmt.Sprintf("%s/messages/%d/pin", config.PachcaBaseURL, messageID)
-	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+	_, err = pachcaClient.EditMessage(ctx, haltData.MessageID, pachca.MessageUpdateRequest{
+		Message: pachca.MessageUpdate{
+			Content: content,
+			Buttons: productionButtons(config, haltData.ReleaseInfo, release.StateHalted),
+		},
+	})
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+config.PachcaAPIKey)
+	_, err = delivery.Complete(ctx, "edit", func(r *release.Release) error {
+		r.VersionName = haltData.VersionName
+		r.MessageID = haltData.MessageID
+		if err := r.Transition(release.StateHalted); err != nil {
+			return err
+		}
+		r.Record(time.Now(), "halt", "")
+		return nil
+	})
+	return err
+}
 
-	resp, err := client.Do(req)
+func HandleGitlabOtherStoresSuccess(ctx context.Context, pachcaClient *pachca.Client, delivery *release.Delivery, config *config.Config, data json.RawMessage) error {
+	var storesData GitlabOtherStoresData
+	err := json.Unmarshal(data, &storesData)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 
-	respBody, _ := io.ReadAll(resp.Body)
-	log.Printf("Pachca pin response: %s", string(respBody))
+	storesData.MessageID, err = releaseMessageID(ctx, delivery, storesData.ReleaseInfo)
+	if err != nil {
+		return err
+	}
+	if storesData.MessageID == 0 {
+		return fmt.Errorf("other_stores event has no message_id")
+	}
+
+	if !delivery.Completed("edit") {
+		if err := editOtherStoresMessage(ctx, pachcaClient, delivery, config, storesData); err != nil {
+			return err
+		}
+	}
+
+	// A release that some stores did not take stays pinned until a retry releases it everywhere.
+	if len(failedStores(storesData.Stores)) > 0 {
+		return nil
+	}
 
-	if resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("Pachca pin API returned status %d", resp.StatusCode)
+	if !delivery.Completed("unpin") {
+		if err := pachcaClient.UnpinMessage(ctx, storesData.MessageID); err != nil {
+			return err
+		}
+		if _, err := delivery.Complete(ctx, "unpin", nil); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
+
+// editOtherStoresMessage lists the store results in the release message and completes the release.
+// When a store did not take the release, the release fails instead and the message offers to retry the job.
+func editOtherStoresMessage(ctx context.Context, pachcaClient *pachca.Client, delivery *release.Delivery, config *config.Config, storesData GitlabOtherStoresData) error {
+	failed := failedStores(storesData.Stores)
+	to := release.StateDone
+	if len(failed) > 0 {
+		to = release.StateFailed
+	}
+
+	if err := checkTransition(ctx, pachcaClient, delivery, config, "other_stores", storesData.ReleaseInfo, to); err != nil {
+		return err
+	}
+
+	var content strings.Builder
+	buttons := [][]pachca.Button{}
+	if len(failed) > 0 {
+		fmt.Fprintf(&content, failureDescriptions["other_stores"], storesData.VersionName, storesData.VersionCode)
+		fmt.Fprintf(&content, " in %s.", strings.Join(failed, ", "))
+		buttons = retryButtons(config, storesData.ReleaseInfo)
+	} else {
+		fmt.Fprintf(&content, "Release %s (%d) is released to all stores.",
+			storesData.VersionName, storesData.VersionCode)
+	}
+	for _, store := range storesData.Stores {
+		fmt.Fprintf(&content, "\n%s: %s", store.Name, store.Result)
+	}
+
+	_, err := pachcaClient.EditMessage(ctx, storesData.MessageID, pachca.MessageUpdateRequest{
+		Message: pachca.MessageUpdate{
+			Content: content.String(),
+			Buttons: buttons,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = delivery.Complete(ctx, "edit", func(r *release.Release) error {
+		r.VersionName = storesData.VersionName
+		r.MessageID = storesData.MessageID
+		if err := r.Transition(to); err != nil {
+			return err
+		}
+		if r.Stores == nil {
+			r.Stores = make(map[string]string)
+		}
+		for _, s := range storesData.Stores {
+			r.Stores[s.Name] = s.Result
+		}
+		if len(failed) > 0 {
+			r.Record(time.Now(), "other_stores_failed", "stores "+strings.Join(failed, ", "))
+		} else {
+			r.Record(time.Now(), "other_stores", "")
+		}
+		return nil
+	})
+	return err
+}
+
+// failedStores names the stores whose result is anything but success.
+func failedStores(stores []GitlabStoreResult) []string {
+	var failed []string
+	for _, store := range stores {
+		if store.Result != "success" {
+			failed = append(failed, store.Name)
+		}
+	}
+	return failed
+}
+
+// retryButtons offers to retry the job of releaseInfo.
+func retryButtons(config *config.Config, releaseInfo shared.ReleaseInfo) [][]pachca.Button {
+	return [][]pachca.Button{
+		{
+			{
+				Text: "Retry",
+				Data: buttonData(config, "retry", releaseInfo),
+			},
+		},
+	}
+}
+
+// HandleGitlabFailure reports a failed job to the internal chat with a button that retries it.
+// The release message is edited in place when the event refers to one, otherwise a new message is posted.
+func HandleGitlabFailure(ctx context.Context, pachcaClient *pachca.Client, delivery *release.Delivery, config *config.Config, event string, data json.RawMessage) error {
+	var failureData GitlabFailureData
+	err := json.Unmarshal(data, &failureData)
+	if err != nil {
+		return err
+	}
+
+	if failureData.FailedJob.ID == 0 {
+		return fmt.Errorf("%s failure event has no failed_job", event)
+	}
+
+	if delivery.Completed("message") {
+		return nil
+	}
+
+	failureData.MessageID, err = releaseMessageID(ctx, delivery, failureData.ReleaseInfo)
+	if err != nil {
+		return err
+	}
+
+	if err := checkTransition(ctx, pachcaClient, delivery, config, event, failureData.ReleaseInfo, release.StateFailed); err != nil {
+		return err
+	}
+
+	content := fmt.Sprintf(failureDescriptions[event], failureData.VersionName, failureData.VersionCode)
+	content += fmt.Sprintf(": job %s (%d) failed at stage %s.",
+		failureData.FailedJob.Name, failureData.FailedJob.ID, failureData.FailedJob.Stage)
+
+	retryInfo := failureData.ReleaseInfo
+	retryInfo.JobID = failureData.FailedJob.ID
+	buttons := retryButtons(config, retryInfo)
+
+	messageID := failureData.MessageID
+	if messageID == 0 {
+		message, err := pachcaClient.CreateMessage(ctx, pachca.MessageCreateRequest{
+			Message: pachca.NewMessage{
+				EntityType: "discussion",
+				EntityID:   config.Pachca.InternalChatID,
+				Content:    content,
+				Buttons:    buttons,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		messageID = message.ID
+	} else {
+		_, err := pachcaClient.EditMessage(ctx, messageID, pachca.MessageUpdateRequest{
+			Message: pachca.MessageUpdate{
+				Content: content,
+				Buttons: buttons,
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = delivery.Complete(ctx, "message", func(r *release.Release) error {
+		r.VersionName = failureData.VersionName
+		r.MessageID = messageID
+		if err := r.Transition(release.StateFailed); err != nil {
+			return err
+		}
+		r.Record(time.Now(), event+"_failed", fmt.Sprintf("job %s (%d) at stage %s",
+			failureData.FailedJob.Name, failureData.FailedJob.ID, failureData.FailedJob.Stage))
+		return nil
+	})
+	return err
+}
+
+// checkTransition rejects an event that would move the release to a state its lifecycle does not allow,
+// and tells the internal chat that the event was ignored.
+func checkTransition(ctx context.Context, pachcaClient *pachca.Client, delivery *release.Delivery, config *config.Config, event string, releaseInfo shared.ReleaseInfo, to release.State) error {
+	r, err := delivery.Get(ctx)
+	if err != nil {
+		return err
+	}
+
+	transitionErr := r.CanTransition(to)
+	if transitionErr == nil {
+		return nil
+	}
+
+	slog.WarnContext(ctx, "Ignored Gitlab event", "version_name", releaseInfo.VersionName, "state", r.State, "error", transitionErr)
+
+	_, err = pachcaClient.CreateMessage(ctx, pachca.MessageCreateRequest{
+		Message: pachca.NewMessage{
+			EntityType: "discussion",
+			EntityID:   config.Pachca.InternalChatID,
+			Content: fmt.Sprintf(
+				"Ignored %s result from Gitlab for release %s (%d): the release is %s.",
+				event, releaseInfo.VersionName, releaseInfo.VersionCode, r.State.Description(),
+			),
+		},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error reporting ignored event", "error", err)
+	}
+
+	return transitionErr
+}
+
+// releaseMessageID returns the message of the release that an event refers to,
+// looking it up in the store when the event does not carry it.
+func releaseMessageID(ctx context.Context, delivery *release.Delivery, releaseInfo shared.ReleaseInfo) (int, error) {
+	if releaseInfo.MessageID != 0 {
+		return releaseInfo.MessageID, nil
+	}
+
+	r, err := delivery.Get(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.MessageID, nil
+}
+
+// productionButtons lists the actions the lifecycle allows for a release in the production track.
+// "Update rollout" is only offered while the rollout has not reached 100%,
+// and "Release to all stores" is not offered while the rollout is halted.
+func productionButtons(config *config.Config, releaseInfo shared.ReleaseInfo, state release.State) [][]pachca.Button {
+	r := release.Release{VersionCode: releaseInfo.VersionCode, State: state}
+
+	var button []pachca.Button
+	if r.CanStart(shared.ActionUpdateRollout) == nil {
+		button = append(button, pachca.Button{
+			Text: "Update rollout",
+			Data: buttonData(config, shared.ActionUpdateRollout, releaseInfo),
+		})
+	}
+	if r.CanStart(shared.ActionHalt) == nil {
+		button = append(button, pachca.Button{
+			Text: "Halt rollout",
+			Data: buttonData(config, shared.ActionHalt, releaseInfo),
+		})
+	}
+	if r.CanStart(shared.ActionReleaseStores) == nil {
+		button = append(button, pachca.Button{
+			Text: "Release to all stores",
+			Data: buttonData(config, shared.ActionReleaseStores, releaseInfo),
+		})
+	}
+
+	return [][]pachca.Button{button}
+}
+
+// buttonData prefixes ReleaseInfo, signed together with the action, with the action the button triggers.
+func buttonData(config *config.Config, action string, releaseInfo shared.ReleaseInfo) string {
+	signedInfo, _ := shared.SignReleaseInfo(config.Release.SigningKey, action, releaseInfo, time.Now().Add(config.Release.DataTTL))
+	return fmt.Sprintf("%s|%s", action, signedInfo)
+}
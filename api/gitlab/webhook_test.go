@@ -2,13 +2,24 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync/atomic"
 	"testing"
+	"time"
 
+	"pachca.com/android-deployment/audit"
+	"pachca.com/android-deployment/config"
+	"pachca.com/android-deployment/metrics"
+	"pachca.com/android-deployment/pachca"
+	"pachca.com/android-deployment/queue"
+	"pachca.com/android-deployment/release"
 	"pachca.com/android-deployment/shared"
 )
 
@@ -69,10 +80,7 @@ func TestGitlabNotifiesGooglePlayReleaseIsSuccessful(t *testing.T) {
 			if !strings.HasPrefix(buttonData, "promote|") {
 				t.Errorf("Expected button data to start with 'promote|', got '%s'", buttonData)
 			}
-			var releaseInfo shared.ReleaseInfo
-			if err := json.Unmarshal([]byte(strings.TrimPrefix(buttonData, "promote|")), &releaseInfo); err != nil {
-				t.Errorf("Failed to unmarshal button data: %v", err)
-			}
+			releaseInfo := verifyButtonData(t, buttonData, "promote")
 			if releaseInfo.JobID != 12345 {
 				t.Errorf("Expected button data job_id 12345, got %d", releaseInfo.JobID)
 			}
@@ -102,14 +110,13 @@ func TestGitlabNotifiesGooglePlayReleaseIsSuccessful(t *testing.T) {
 	defer mockPachca.Close()
 
 	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
-	t.Setenv(shared.EnvPachcaKey, "test-api-key")
-	t.Setenv(shared.EnvPachcaInternalChatId, "198")
 
 	req := httptest.NewRequest("POST", "/gitlab/webhook", bytes.NewReader(payloadBytes))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gitlab-Token", "test-webhook-token")
 	w := httptest.NewRecorder()
 
-	HandleGitlabHook(w, req, mockPachca.Client())
+	HandleGitlabHook(w, req, testConfig(t), mockPachca.Client())
 
 	if w.Code != http.StatusOK {
 		t.Errorf("Expected status 200, got %d", w.Code)
@@ -122,30 +129,1378 @@ func TestGitlabNotifiesGooglePlayReleaseIsSuccessful(t *testing.T) {
 	}
 }
 
+func TestGitlabRemembersReleaseMessage(t *testing.T) {
+	var editCalls atomic.Int32
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/messages":
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"data": map[string]any{
+					"id": 194275,
+				},
+			})
+		case "/messages/194275/pin":
+			w.WriteHeader(http.StatusCreated)
+		case "/messages/194275":
+			editCalls.Add(1)
+
+			if r.Method != "PUT" {
+				t.Errorf("Expected PUT method, got %s", r.Method)
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	storePath := filepath.Join(t.TempDir(), "releases.json")
+
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+	t.Setenv(shared.EnvReleaseStorePath, storePath)
+
+	payloads := []map[string]any{
+		{
+			"event":  "build",
+			"result": "success",
+			"data": map[string]any{
+				"job_id":       12345,
+				"version_code": 1001,
+				"version_name": "1.0.1",
+			},
+		},
+		{
+			"event":  "promote",
+			"result": "success",
+			"data": map[string]any{
+				"job_id":             12345,
+				"version_code":       1001,
+				"version_name":       "1.0.1",
+				"rollout_percentage": 25,
+			},
+		},
+	}
+
+	for _, payload := range payloads {
+		payloadBytes, _ := json.Marshal(payload)
+
+		req := httptest.NewRequest("POST", "/gitlab/webhook", bytes.NewReader(payloadBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Gitlab-Token", "test-webhook-token")
+		w := httptest.NewRecorder()
+
+		HandleGitlabHook(w, req, testConfig(t), mockPachca.Client())
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d", payload["event"], w.Code)
+		}
+	}
+
+	if editCalls.Load() != 1 {
+		t.Errorf("Expected 1 edit of the release message, got %d", editCalls.Load())
+	}
+
+	store, _ := release.OpenStore(release.StoreFile, storePath)
+	r, err := store.Get(context.Background(), 1001)
+	if err != nil {
+		t.Fatalf("Expected stored release, got %v", err)
+	}
+	if r.MessageID != 194275 {
+		t.Errorf("Expected stored message_id 194275, got %d", r.MessageID)
+	}
+	if r.Track != release.TrackProduction || r.RolloutPercentage != 25 {
+		t.Errorf("Expected production track at 25%%, got %s at %d%%", r.Track, r.RolloutPercentage)
+	}
+	if len(r.History) != 2 {
+		t.Errorf("Expected 2 history entries, got %d", len(r.History))
+	}
+}
+
 func TestGitlabNotifiesGooglePlayBuildFailed(t *testing.T) {
+	var messageCalls atomic.Int32
+
+	gitlabPayload := map[string]any{
+		"event":  "build",
+		"result": "failed",
+		"data": map[string]any{
+			"job_id":       12345,
+			"version_code": 1001,
+			"version_name": "1.0.1",
+			"failed_job": map[string]any{
+				"id":    12345,
+				"name":  "publishInternal",
+				"stage": "deploy",
+			},
+		},
+	}
+	payloadBytes, _ := json.Marshal(gitlabPayload)
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/messages":
+			messageCalls.Add(1)
+
+			if r.Method != "POST" {
+				t.Errorf("Expected POST method, got %s", r.Method)
+			}
+			var msg pachca.MessageCreateRequest
+			json.NewDecoder(r.Body).Decode(&msg)
+			if msg.Message.EntityType != "discussion" {
+				t.Errorf("Expected entity_type 'discussion', got '%s'", msg.Message.EntityType)
+			}
+			if msg.Message.EntityID != 198 {
+				t.Errorf("Expected entity_id 198, got %d", msg.Message.EntityID)
+			}
+			expectedContent := "Upload of release 1.0.1 (1001) to Google Play Internal failed: job publishInternal (12345) failed at stage deploy."
+			if msg.Message.Content != expectedContent {
+				t.Errorf("Expected content '%s', got '%s'", expectedContent, msg.Message.Content)
+			}
+			assertRetryButton(t, msg.Message.Buttons, 12345, 0)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"data": map[string]any{
+					"id": 194276,
+				},
+			})
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
 
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+
+	req := httptest.NewRequest("POST", "/gitlab/webhook", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gitlab-Token", "test-webhook-token")
+	w := httptest.NewRecorder()
+
+	HandleGitlabHook(w, req, testConfig(t), mockPachca.Client())
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if messageCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Pachca message API, got %d", messageCalls.Load())
+	}
 }
 
 func TestGitlabNotifiesPromotionIsSuccessful(t *testing.T) {
+	tests := []struct {
+		name            string
+		state           release.State
+		rollout         int
+		expectedContent string
+		expectedButtons []string
+	}{
+		{
+			name:            "staged rollout",
+			state:           release.StateInternal,
+			rollout:         25,
+			expectedContent: "Release 1.0.1 (1001) is in the Google Play production track, rolled out to 25% of users.",
+			expectedButtons: []string{"Update rollout", "Halt rollout", "Release to all stores"},
+		},
+		{
+			name:            "full rollout",
+			state:           release.StateInternal,
+			rollout:         100,
+			expectedContent: "Release 1.0.1 (1001) is in the Google Play production track, rolled out to 100% of users.",
+			expectedButtons: []string{"Release to all stores"},
+		},
+		{
+			// The build result reached another process, or one whose in-memory store is gone.
+			name:            "release missing from the store",
+			state:           release.StateNone,
+			rollout:         25,
+			expectedContent: "Release 1.0.1 (1001) is in the Google Play production track, rolled out to 25% of users.",
+			expectedButtons: []string{"Update rollout", "Halt rollout", "Release to all stores"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var editCalls atomic.Int32
+
+			gitlabPayload := map[string]any{
+				"event":  "promote",
+				"result": "success",
+				"data": map[string]any{
+					"job_id":             12345,
+					"version_code":       1001,
+					"version_name":       "1.0.1",
+					"message_id":         194275,
+					"rollout_percentage": tt.rollout,
+				},
+			}
+			payloadBytes, _ := json.Marshal(gitlabPayload)
+
+			mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/messages/194275":
+					editCalls.Add(1)
+
+					if r.Method != "PUT" {
+						t.Errorf("Expected PUT method, got %s", r.Method)
+					}
+					var msg pachca.MessageUpdateRequest
+					json.NewDecoder(r.Body).Decode(&msg)
+					if msg.Message.Content != tt.expectedContent {
+						t.Errorf("Expected content '%s', got '%s'", tt.expectedContent, msg.Message.Content)
+					}
+					if len(msg.Message.Buttons) != 1 {
+						t.Errorf("Expected 1 row of buttons, got %d", len(msg.Message.Buttons))
+						return
+					}
+					if len(msg.Message.Buttons[0]) != len(tt.expectedButtons) {
+						t.Errorf("Expected %d buttons, got %d", len(tt.expectedButtons), len(msg.Message.Buttons[0]))
+						return
+					}
+					for i, text := range tt.expectedButtons {
+						if msg.Message.Buttons[0][i].Text != text {
+							t.Errorf("Expected button %d text '%s', got '%s'", i, text, msg.Message.Buttons[0][i].Text)
+						}
+					}
+					buttonData := msg.Message.Buttons[0][len(tt.expectedButtons)-1].Data
+					if !strings.HasPrefix(buttonData, "release_stores|") {
+						t.Errorf("Expected button data to start with 'release_stores|', got '%s'", buttonData)
+					}
+					releaseInfo := verifyButtonData(t, buttonData, "release_stores")
+					if releaseInfo.VersionCode != 1001 {
+						t.Errorf("Expected button data version_code 1001, got %d", releaseInfo.VersionCode)
+					}
+					if releaseInfo.MessageID != 194275 {
+						t.Errorf("Expected button data message_id 194275, got %d", releaseInfo.MessageID)
+					}
+					w.WriteHeader(http.StatusOK)
+				default:
+					t.Errorf("Unexpected path: %s", r.URL.Path)
+				}
+			}))
+			defer mockPachca.Close()
 
+			t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+			if tt.state != release.StateNone {
+				seedRelease(t, 1001, tt.state)
+			}
+
+			req := httptest.NewRequest("POST", "/gitlab/webhook", bytes.NewReader(payloadBytes))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Gitlab-Token", "test-webhook-token")
+			w := httptest.NewRecorder()
+
+			HandleGitlabHook(w, req, testConfig(t), mockPachca.Client())
+
+			if w.Code != http.StatusOK {
+				t.Errorf("Expected status 200, got %d", w.Code)
+			}
+			if editCalls.Load() != 1 {
+				t.Errorf("Expected 1 call to Pachca edit API, got %d", editCalls.Load())
+			}
+			store, _ := release.OpenStore(release.StoreFile, os.Getenv(shared.EnvReleaseStorePath))
+			r, err := store.Get(context.Background(), 1001)
+			if err != nil {
+				t.Fatalf("Expected stored release, got %v", err)
+			}
+			if expected, _ := release.ProductionState(tt.rollout); r.State != expected {
+				t.Errorf("Expected release state %q, got %q", expected, r.State)
+			}
+		})
+	}
 }
 
 func TestGitlabNotifiesPromotionFailed(t *testing.T) {
+	var editCalls atomic.Int32
+
+	gitlabPayload := map[string]any{
+		"event":  "promote",
+		"result": "failed",
+		"data": map[string]any{
+			"job_id":       12345,
+			"version_code": 1001,
+			"version_name": "1.0.1",
+			"message_id":   194275,
+			"failed_job": map[string]any{
+				"id":    12400,
+				"name":  "promote_job",
+				"stage": "deploy",
+			},
+		},
+	}
+	payloadBytes, _ := json.Marshal(gitlabPayload)
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/messages/194275":
+			editCalls.Add(1)
+
+			if r.Method != "PUT" {
+				t.Errorf("Expected PUT method, got %s", r.Method)
+			}
+			var msg pachca.MessageUpdateRequest
+			json.NewDecoder(r.Body).Decode(&msg)
+			expectedContent := "Promotion of release 1.0.1 (1001) to production failed: job promote_job (12400) failed at stage deploy."
+			if msg.Message.Content != expectedContent {
+				t.Errorf("Expected content '%s', got '%s'", expectedContent, msg.Message.Content)
+			}
+			assertRetryButton(t, msg.Message.Buttons, 12400, 194275)
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
 
+	failed := map[string]string{"source": "gitlab", "type": "pipeline", "action": "promote", "result": "failed", "outcome": "ok"}
+	before := webhookCount(t, failed)
+
+	req := httptest.NewRequest("POST", "/gitlab/webhook", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gitlab-Token", "test-webhook-token")
+	w := httptest.NewRecorder()
+
+	HandleGitlabHook(w, req, testConfig(t), mockPachca.Client())
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if editCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Pachca edit API, got %d", editCalls.Load())
+	}
+	if count := webhookCount(t, failed) - before; count != 1 {
+		t.Errorf("Expected 1 failed promote pipeline counted, got %v", count)
+	}
 }
 
-func TestGitlabNotifiesRolloutUpdateIsSuccessful(t *testing.T) {
+func TestGitlabRecordsPipelineResult(t *testing.T) {
+	tests := []struct {
+		name            string
+		result          string
+		expectedJobID   int
+		expectedOutcome string
+		expectedError   string
+	}{
+		{
+			name:            "success",
+			result:          "success",
+			expectedJobID:   12345,
+			expectedOutcome: audit.OutcomeSucceeded,
+		},
+		{
+			name:            "failed job",
+			result:          "failed",
+			expectedJobID:   12400,
+			expectedOutcome: audit.OutcomeJobFailed,
+			expectedError:   "job promote_job (12400) failed at stage deploy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gitlabPayload := map[string]any{
+				"event":  "promote",
+				"result": tt.result,
+				"data": map[string]any{
+					"job_id":             12345,
+					"version_code":       1001,
+					"version_name":       "1.0.1",
+					"message_id":         194275,
+					"rollout_percentage": 25,
+					"failed_job": map[string]any{
+						"id":    12400,
+						"name":  "promote_job",
+						"stage": "deploy",
+					},
+				},
+			}
+			payloadBytes, _ := json.Marshal(gitlabPayload)
+
+			mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer mockPachca.Close()
+
+			t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+			t.Setenv(shared.EnvAuditStore, audit.StoreFile)
+			t.Setenv(shared.EnvAuditPath, filepath.Join(t.TempDir(), "audit.jsonl"))
+			seedRelease(t, 1001, release.StateInternal)
+
+			auditLog, err := audit.Open(audit.StoreFile, os.Getenv(shared.EnvAuditPath))
+			if err != nil {
+				t.Fatalf("Failed to open audit log: %v", err)
+			}
+			started := &audit.Entry{
+				UserID:      123,
+				Action:      shared.ActionPromote,
+				ReleaseInfo: shared.ReleaseInfo{VersionCode: 1001, VersionName: "1.0.1"},
+				PipelineID:  555,
+				Outcome:     audit.OutcomeStarted,
+			}
+			if err := auditLog.Append(context.Background(), started); err != nil {
+				t.Fatalf("Failed to seed audit log: %v", err)
+			}
+
+			req := httptest.NewRequest("POST", "/gitlab/webhook", bytes.NewReader(payloadBytes))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Gitlab-Token", "test-webhook-token")
+			w := httptest.NewRecorder()
+
+			HandleGitlabHook(w, req, testConfig(t), mockPachca.Client())
+
+			if w.Code != http.StatusOK {
+				t.Errorf("Expected status 200, got %d", w.Code)
+			}
 
+			entries, err := auditLog.Query(context.Background(), audit.Filter{VersionCode: 1001})
+			if err != nil {
+				t.Fatalf("Failed to query audit log: %v", err)
+			}
+			if len(entries) != 2 {
+				t.Fatalf("Expected 2 audit entries, got %d", len(entries))
+			}
+			entry := entries[1]
+			if entry.Action != shared.ActionPromote || entry.Outcome != tt.expectedOutcome {
+				t.Errorf("Expected %s %s, got %s %s", shared.ActionPromote, tt.expectedOutcome, entry.Action, entry.Outcome)
+			}
+			if entry.UserID != 123 || entry.PipelineID != 555 {
+				t.Errorf("Expected user 123 and pipeline 555, got user %d and pipeline %d", entry.UserID, entry.PipelineID)
+			}
+			if entry.JobID != tt.expectedJobID {
+				t.Errorf("Expected job %d, got %d", tt.expectedJobID, entry.JobID)
+			}
+			if entry.Error != tt.expectedError {
+				t.Errorf("Expected error '%s', got '%s'", tt.expectedError, entry.Error)
+			}
+		})
+	}
 }
 
-func TestGitlabNotifiesRolloutUpdateFailed(t *testing.T) {
+func TestGitlabNotifiesRolloutUpdateIsSuccessful(t *testing.T) {
+	var editCalls atomic.Int32
+
+	gitlabPayload := map[string]any{
+		"event":  "rollout",
+		"result": "success",
+		"data": map[string]any{
+			"job_id":             12345,
+			"version_code":       1001,
+			"version_name":       "1.0.1",
+			"message_id":         194275,
+			"rollout_percentage": 50,
+		},
+	}
+	payloadBytes, _ := json.Marshal(gitlabPayload)
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/messages/194275":
+			editCalls.Add(1)
+
+			if r.Method != "PUT" {
+				t.Errorf("Expected PUT method, got %s", r.Method)
+			}
+			var msg pachca.MessageUpdateRequest
+			json.NewDecoder(r.Body).Decode(&msg)
+			expectedContent := "Release 1.0.1 (1001) is in the Google Play production track, rollout updated to 50% of users."
+			if msg.Message.Content != expectedContent {
+				t.Errorf("Expected content '%s', got '%s'", expectedContent, msg.Message.Content)
+			}
+			if len(msg.Message.Buttons) != 1 || len(msg.Message.Buttons[0]) != 3 {
+				t.Errorf("Expected 3 buttons, got %v", msg.Message.Buttons)
+				return
+			}
+			if msg.Message.Buttons[0][0].Text != "Update rollout" {
+				t.Errorf("Expected button text 'Update rollout', got '%s'", msg.Message.Buttons[0][0].Text)
+			}
+			if !strings.HasPrefix(msg.Message.Buttons[0][0].Data, "update_rollout|") {
+				t.Errorf("Expected button data to start with 'update_rollout|', got '%s'", msg.Message.Buttons[0][0].Data)
+			}
+			if msg.Message.Buttons[0][1].Text != "Halt rollout" {
+				t.Errorf("Expected button text 'Halt rollout', got '%s'", msg.Message.Buttons[0][1].Text)
+			}
+			if !strings.HasPrefix(msg.Message.Buttons[0][1].Data, "halt|") {
+				t.Errorf("Expected button data to start with 'halt|', got '%s'", msg.Message.Buttons[0][1].Data)
+			}
+			if msg.Message.Buttons[0][2].Text != "Release to all stores" {
+				t.Errorf("Expected button text 'Release to all stores', got '%s'", msg.Message.Buttons[0][2].Text)
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+	seedRelease(t, 1001, release.StateProductionInProgress)
+
+	req := httptest.NewRequest("POST", "/gitlab/webhook", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gitlab-Token", "test-webhook-token")
+	w := httptest.NewRecorder()
+
+	HandleGitlabHook(w, req, testConfig(t), mockPachca.Client())
 
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if editCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Pachca edit API, got %d", editCalls.Load())
+	}
 }
 
-func TestGitlabNotifiesOtherStoresReleaseIsSuccessful(t *testing.T) {
+func TestGitlabNotifiesRolloutIsHalted(t *testing.T) {
+	var editCalls atomic.Int32
+
+	gitlabPayload := map[string]any{
+		"event":  "halt",
+		"result": "success",
+		"data": map[string]any{
+			"job_id":       12345,
+			"version_code": 1001,
+			"version_name": "1.0.1",
+			"message_id":   194275,
+		},
+	}
+	payloadBytes, _ := json.Marshal(gitlabPayload)
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/messages/194275":
+			editCalls.Add(1)
 
+			var msg pachca.MessageUpdateRequest
+			json.NewDecoder(r.Body).Decode(&msg)
+			expectedContent := "Rollout of release 1.0.1 (1001) is halted in the Google Play production track."
+			if msg.Message.Content != expectedContent {
+				t.Errorf("Expected content '%s', got '%s'", expectedContent, msg.Message.Content)
+			}
+			if len(msg.Message.Buttons) != 1 || len(msg.Message.Buttons[0]) != 1 {
+				t.Errorf("Expected 1 button, got %v", msg.Message.Buttons)
+				return
+			}
+			if msg.Message.Buttons[0][0].Text != "Update rollout" {
+				t.Errorf("Expected button text 'Update rollout', got '%s'", msg.Message.Buttons[0][0].Text)
+			}
+			verifyButtonData(t, msg.Message.Buttons[0][0].Data, "update_rollout")
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+	seedRelease(t, 1001, release.StateProductionInProgress)
+
+	req := httptest.NewRequest("POST", "/gitlab/webhook", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gitlab-Token", "test-webhook-token")
+	w := httptest.NewRecorder()
+
+	HandleGitlabHook(w, req, testConfig(t), mockPachca.Client())
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if editCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Pachca edit API, got %d", editCalls.Load())
+	}
+
+	store, _ := release.OpenStore(release.StoreFile, os.Getenv(shared.EnvReleaseStorePath))
+	r, err := store.Get(context.Background(), 1001)
+	if err != nil {
+		t.Fatalf("Failed to read release: %v", err)
+	}
+	if r.State != release.StateHalted {
+		t.Errorf("Expected state %s, got %s", release.StateHalted, r.State)
+	}
 }
 
-func TestGitlabNotifiesOtherStoresReleaseFailed(t *testing.T) {
+func TestGitlabNotifiesRolloutUpdateFailed(t *testing.T) {
+	var editCalls atomic.Int32
 
+	gitlabPayload := map[string]any{
+		"event":  "rollout",
+		"result": "failed",
+		"data": map[string]any{
+			"job_id":       12345,
+			"version_code": 1001,
+			"version_name": "1.0.1",
+			"message_id":   194275,
+			"failed_job": map[string]any{
+				"id":    12400,
+				"name":  "rollout_job",
+				"stage": "deploy",
+			},
+		},
+	}
+	payloadBytes, _ := json.Marshal(gitlabPayload)
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/messages/194275":
+			editCalls.Add(1)
+
+			if r.Method != "PUT" {
+				t.Errorf("Expected PUT method, got %s", r.Method)
+			}
+			var msg pachca.MessageUpdateRequest
+			json.NewDecoder(r.Body).Decode(&msg)
+			expectedContent := "Rollout update of release 1.0.1 (1001) failed: job rollout_job (12400) failed at stage deploy."
+			if msg.Message.Content != expectedContent {
+				t.Errorf("Expected content '%s', got '%s'", expectedContent, msg.Message.Content)
+			}
+			assertRetryButton(t, msg.Message.Buttons, 12400, 194275)
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+
+	req := httptest.NewRequest("POST", "/gitlab/webhook", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gitlab-Token", "test-webhook-token")
+	w := httptest.NewRecorder()
+
+	HandleGitlabHook(w, req, testConfig(t), mockPachca.Client())
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if editCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Pachca edit API, got %d", editCalls.Load())
+	}
+}
+
+func TestGitlabNotifiesOtherStoresReleaseIsSuccessful(t *testing.T) {
+	var editCalls atomic.Int32
+	var unpinCalls atomic.Int32
+
+	gitlabPayload := map[string]any{
+		"event":  "other_stores",
+		"result": "success",
+		"data": map[string]any{
+			"job_id":       12345,
+			"version_code": 1001,
+			"version_name": "1.0.1",
+			"message_id":   194275,
+			"stores": []map[string]any{
+				{"name": "RuStore", "result": "success"},
+				{"name": "AppGallery", "result": "success"},
+			},
+		},
+	}
+	payloadBytes, _ := json.Marshal(gitlabPayload)
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/messages/194275":
+			editCalls.Add(1)
+
+			if r.Method != "PUT" {
+				t.Errorf("Expected PUT method, got %s", r.Method)
+			}
+			var msg map[string]map[string]any
+			json.NewDecoder(r.Body).Decode(&msg)
+			expectedContent := "Release 1.0.1 (1001) is released to all stores.\nRuStore: success\nAppGallery: success"
+			if msg["message"]["content"] != expectedContent {
+				t.Errorf("Expected content '%s', got '%v'", expectedContent, msg["message"]["content"])
+			}
+			buttons, ok := msg["message"]["buttons"].([]any)
+			if !ok {
+				t.Errorf("Expected buttons to be an empty list, got %v", msg["message"]["buttons"])
+			} else if len(buttons) != 0 {
+				t.Errorf("Expected no buttons, got %d", len(buttons))
+			}
+			w.WriteHeader(http.StatusOK)
+		case "/messages/194275/pin":
+			unpinCalls.Add(1)
+
+			if r.Method != "DELETE" {
+				t.Errorf("Expected DELETE method, got %s", r.Method)
+			}
+			if editCalls.Load() != 1 {
+				t.Error("Expected message to be edited before unpinning")
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+	seedRelease(t, 1001, release.StateReleasingOtherStores)
+
+	req := httptest.NewRequest("POST", "/gitlab/webhook", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gitlab-Token", "test-webhook-token")
+	w := httptest.NewRecorder()
+
+	HandleGitlabHook(w, req, testConfig(t), mockPachca.Client())
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if editCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Pachca edit API, got %d", editCalls.Load())
+	}
+	if unpinCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Pachca unpin API, got %d", unpinCalls.Load())
+	}
+}
+
+func TestGitlabKeepsReleaseOpenWhenAStoreFails(t *testing.T) {
+	var editCalls atomic.Int32
+
+	gitlabPayload := map[string]any{
+		"event":  "other_stores",
+		"result": "success",
+		"data": map[string]any{
+			"job_id":       12345,
+			"version_code": 1001,
+			"version_name": "1.0.1",
+			"message_id":   194275,
+			"stores": []map[string]any{
+				{"name": "RuStore", "result": "success"},
+				{"name": "AppGallery", "result": "failed"},
+			},
+		},
+	}
+	payloadBytes, _ := json.Marshal(gitlabPayload)
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/messages/194275":
+			editCalls.Add(1)
+
+			var msg pachca.MessageUpdateRequest
+			json.NewDecoder(r.Body).Decode(&msg)
+			expectedContent := "Release of 1.0.1 (1001) to other stores failed in AppGallery.\nRuStore: success\nAppGallery: failed"
+			if msg.Message.Content != expectedContent {
+				t.Errorf("Expected content '%s', got '%s'", expectedContent, msg.Message.Content)
+			}
+			assertRetryButton(t, msg.Message.Buttons, 12345, 194275)
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("Unexpected path: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+	t.Setenv(shared.EnvAuditStore, audit.StoreFile)
+	t.Setenv(shared.EnvAuditPath, filepath.Join(t.TempDir(), "audit.jsonl"))
+	seedRelease(t, 1001, release.StateReleasingOtherStores)
+
+	req := httptest.NewRequest("POST", "/gitlab/webhook", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gitlab-Token", "test-webhook-token")
+	w := httptest.NewRecorder()
+
+	HandleGitlabHook(w, req, testConfig(t), mockPachca.Client())
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if editCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Pachca edit API, got %d", editCalls.Load())
+	}
+
+	auditLog, err := audit.Open(audit.StoreFile, os.Getenv(shared.EnvAuditPath))
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	entries, err := auditLog.Query(context.Background(), audit.Filter{VersionCode: 1001})
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Outcome != audit.OutcomeJobFailed || entries[0].Error != "stores AppGallery failed" {
+		t.Errorf("Expected a %s entry for AppGallery, got %+v", audit.OutcomeJobFailed, entries)
+	}
+
+	store, _ := release.OpenStore(release.StoreFile, os.Getenv(shared.EnvReleaseStorePath))
+	r, err := store.Get(context.Background(), 1001)
+	if err != nil {
+		t.Fatalf("Failed to read release: %v", err)
+	}
+	if r.State != release.StateFailed || r.FailedFrom != release.StateReleasingOtherStores {
+		t.Errorf("Expected state %s from %s, got %s from %s", release.StateFailed, release.StateReleasingOtherStores, r.State, r.FailedFrom)
+	}
+	if r.Stores["AppGallery"] != "failed" {
+		t.Errorf("Expected AppGallery result 'failed', got '%s'", r.Stores["AppGallery"])
+	}
+}
+
+func TestGitlabRejectsIllegalTransition(t *testing.T) {
+	tests := []struct {
+		name        string
+		state       release.State
+		description string
+	}{
+		{
+			name:        "release on the internal track",
+			state:       release.StateInternal,
+			description: "on the internal track",
+		},
+		{
+			name:        "release missing from the store",
+			state:       release.StateNone,
+			description: "not known yet",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var messageCalls atomic.Int32
+
+			gitlabPayload := map[string]any{
+				"event":  "other_stores",
+				"result": "success",
+				"data": map[string]any{
+					"job_id":       12345,
+					"version_code": 1001,
+					"version_name": "1.0.1",
+					"message_id":   194275,
+					"stores":       []map[string]any{{"name": "RuStore", "result": "success"}},
+				},
+			}
+			payloadBytes, _ := json.Marshal(gitlabPayload)
+
+			mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/messages":
+					messageCalls.Add(1)
+
+					var msg pachca.MessageCreateRequest
+					json.NewDecoder(r.Body).Decode(&msg)
+					if msg.Message.EntityID != 198 {
+						t.Errorf("Expected entity_id 198, got %d", msg.Message.EntityID)
+					}
+					expected := "Ignored other_stores result from Gitlab for release 1.0.1 (1001): the release is " + tt.description + "."
+					if msg.Message.Content != expected {
+						t.Errorf("Expected content '%s', got '%s'", expected, msg.Message.Content)
+					}
+					w.WriteHeader(http.StatusCreated)
+				default:
+					t.Errorf("Unexpected path: %s", r.URL.Path)
+				}
+			}))
+			defer mockPachca.Close()
+
+			t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+			if tt.state != release.StateNone {
+				seedRelease(t, 1001, tt.state)
+			}
+
+			req := httptest.NewRequest("POST", "/gitlab/webhook", bytes.NewReader(payloadBytes))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Gitlab-Token", "test-webhook-token")
+			w := httptest.NewRecorder()
+
+			HandleGitlabHook(w, req, testConfig(t), mockPachca.Client())
+
+			if w.Code != http.StatusConflict {
+				t.Errorf("Expected status 409, got %d", w.Code)
+			}
+			if messageCalls.Load() != 1 {
+				t.Errorf("Expected 1 call to Pachca message API, got %d", messageCalls.Load())
+			}
+		})
+	}
+}
+
+func TestGitlabIgnoresRepeatedDelivery(t *testing.T) {
+	var messageCalls atomic.Int32
+	var pinCalls atomic.Int32
+
+	gitlabPayload := map[string]any{
+		"event":  "build",
+		"result": "success",
+		"job_id": 12350,
+		"data": map[string]any{
+			"job_id":       12345,
+			"version_code": 1001,
+			"version_name": "1.0.1",
+		},
+	}
+	payloadBytes, _ := json.Marshal(gitlabPayload)
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/messages":
+			messageCalls.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"data": map[string]any{
+					"id": 194275,
+				},
+			})
+		case "/messages/194275/pin":
+			pinCalls.Add(1)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+
+	for range 2 {
+		req := httptest.NewRequest("POST", "/gitlab/webhook", bytes.NewReader(payloadBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Gitlab-Token", "test-webhook-token")
+		w := httptest.NewRecorder()
+
+		HandleGitlabHook(w, req, testConfig(t), mockPachca.Client())
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+	}
+
+	if messageCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Pachca message API, got %d", messageCalls.Load())
+	}
+	if pinCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Pachca pin API, got %d", pinCalls.Load())
+	}
+}
+
+func TestGitlabResumesPartialDelivery(t *testing.T) {
+	var messageCalls atomic.Int32
+	var pinCalls atomic.Int32
+
+	gitlabPayload := map[string]any{
+		"event":  "build",
+		"result": "success",
+		"job_id": 12350,
+		"data": map[string]any{
+			"job_id":       12345,
+			"version_code": 1001,
+			"version_name": "1.0.1",
+		},
+	}
+	payloadBytes, _ := json.Marshal(gitlabPayload)
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/messages":
+			messageCalls.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"data": map[string]any{
+					"id": 194275,
+				},
+			})
+		case "/messages/194275/pin":
+			if pinCalls.Add(1) == 1 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+	t.Setenv(shared.EnvPachcaMaxAttempts, "1")
+
+	for _, expected := range []int{http.StatusInternalServerError, http.StatusOK} {
+		req := httptest.NewRequest("POST", "/gitlab/webhook", bytes.NewReader(payloadBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Gitlab-Token", "test-webhook-token")
+		w := httptest.NewRecorder()
+
+		HandleGitlabHook(w, req, testConfig(t), mockPachca.Client())
+
+		if w.Code != expected {
+			t.Errorf("Expected status %d, got %d", expected, w.Code)
+		}
+	}
+
+	if messageCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Pachca message API, got %d", messageCalls.Load())
+	}
+	if pinCalls.Load() != 2 {
+		t.Errorf("Expected 2 calls to Pachca pin API, got %d", pinCalls.Load())
+	}
+
+	store, _ := release.OpenStore(release.StoreFile, os.Getenv(shared.EnvReleaseStorePath))
+	r, err := store.Get(context.Background(), 1001)
+	if err != nil {
+		t.Fatalf("Expected stored release, got %v", err)
+	}
+	if r.State != release.StateInternal || len(r.History) != 1 {
+		t.Errorf("Expected one build entry on the internal track, got %s with %d entries", r.State, len(r.History))
+	}
+}
+
+func TestGitlabQueuesPayload(t *testing.T) {
+	var messageCalls atomic.Int32
+	var pinCalls atomic.Int32
+
+	gitlabPayload := map[string]any{
+		"event":  "build",
+		"result": "success",
+		"job_id": 12350,
+		"data": map[string]any{
+			"job_id":       12345,
+			"version_code": 1001,
+			"version_name": "1.0.1",
+		},
+	}
+	payloadBytes, _ := json.Marshal(gitlabPayload)
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/messages":
+			messageCalls.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]any{
+				"data": map[string]any{
+					"id": 194275,
+				},
+			})
+		case "/messages/194275/pin":
+			pinCalls.Add(1)
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	queuePath := filepath.Join(t.TempDir(), "queue.json")
+
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+	t.Setenv(shared.EnvQueueStore, "file")
+	t.Setenv(shared.EnvQueuePath, queuePath)
+
+	req := httptest.NewRequest("POST", "/gitlab/webhook", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gitlab-Token", "test-webhook-token")
+	w := httptest.NewRecorder()
+
+	config := testConfig(t)
+	HandleGitlabHook(w, req, config, mockPachca.Client())
+
+	if w.Code != http.StatusAccepted {
+		t.Errorf("Expected status 202, got %d", w.Code)
+	}
+	if messageCalls.Load() != 0 || pinCalls.Load() != 0 {
+		t.Errorf("Expected no calls to Pachca API before the job runs, got %d messages and %d pins", messageCalls.Load(), pinCalls.Load())
+	}
+
+	jobs, _ := queue.Open(queue.StoreFile, queuePath)
+	job, err := jobs.Claim(context.Background(), time.Now(), time.Minute)
+	if err != nil {
+		t.Fatalf("Expected queued job, got %v", err)
+	}
+	if job.Kind != JobKind {
+		t.Errorf("Expected %s job, got %s", JobKind, job.Kind)
+	}
+
+	if err := ProcessGitlabJob(context.Background(), config, mockPachca.Client(), job.Payload); err != nil {
+		t.Fatalf("Expected job to be processed, got %v", err)
+	}
+	if messageCalls.Load() != 1 || pinCalls.Load() != 1 {
+		t.Errorf("Expected 1 message and 1 pin, got %d messages and %d pins", messageCalls.Load(), pinCalls.Load())
+	}
+}
+
+func TestGitlabNotifiesOtherStoresReleaseFailed(t *testing.T) {
+	var editCalls atomic.Int32
+
+	gitlabPayload := map[string]any{
+		"event":  "other_stores",
+		"result": "failed",
+		"data": map[string]any{
+			"job_id":       12345,
+			"version_code": 1001,
+			"version_name": "1.0.1",
+			"message_id":   194275,
+			"failed_job": map[string]any{
+				"id":    12400,
+				"name":  "other_stores_job",
+				"stage": "deploy",
+			},
+		},
+	}
+	payloadBytes, _ := json.Marshal(gitlabPayload)
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/messages/194275":
+			editCalls.Add(1)
+
+			if r.Method != "PUT" {
+				t.Errorf("Expected PUT method, got %s", r.Method)
+			}
+			var msg pachca.MessageUpdateRequest
+			json.NewDecoder(r.Body).Decode(&msg)
+			expectedContent := "Release of 1.0.1 (1001) to other stores failed: job other_stores_job (12400) failed at stage deploy."
+			if msg.Message.Content != expectedContent {
+				t.Errorf("Expected content '%s', got '%s'", expectedContent, msg.Message.Content)
+			}
+			assertRetryButton(t, msg.Message.Buttons, 12400, 194275)
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+
+	req := httptest.NewRequest("POST", "/gitlab/webhook", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Gitlab-Token", "test-webhook-token")
+	w := httptest.NewRecorder()
+
+	HandleGitlabHook(w, req, testConfig(t), mockPachca.Client())
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if editCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Pachca edit API, got %d", editCalls.Load())
+	}
+}
+
+// testConfig loads the configuration from the environment set up by the test, filling in
+// the required settings the test left out. Releases go to a file store of the test.
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	defaults := map[string]string{
+		shared.EnvPachcaUrl:            "http://pachca.invalid",
+		shared.EnvPachcaKey:            "test-api-key",
+		shared.EnvPachcaSigningSecret:  "test-signing-secret",
+		shared.EnvPachcaInternalChatId: "198",
+		shared.EnvGitlabUrl:            "http://gitlab.invalid",
+		shared.EnvGitlabKey:            "test-gitlab-key",
+		shared.EnvGitlabProjectId:      "42",
+		shared.EnvGitlabRef:            "release",
+		shared.EnvGitlabWebhookToken:   "test-webhook-token",
+		shared.EnvReleaseSigningKey:    "test-release-key",
+		shared.EnvReleaseStore:         release.StoreFile,
+		shared.EnvAuditStore:           audit.StoreMemory,
+	}
+	for key, value := range defaults {
+		if os.Getenv(key) == "" {
+			t.Setenv(key, value)
+		}
+	}
+	if os.Getenv(shared.EnvReleaseStorePath) == "" {
+		t.Setenv(shared.EnvReleaseStorePath, filepath.Join(t.TempDir(), "releases.json"))
+	}
+
+	config, err := config.Load("")
+	if err != nil {
+		t.Fatalf("Config error: %v", err)
+	}
+
+	return config
+}
+
+// seedRelease saves a release in the given state to the store configured by the test.
+func seedRelease(t *testing.T, versionCode int, state release.State) {
+	t.Helper()
+
+	config := testConfig(t)
+	store, err := release.OpenStore(config.Release.Store, config.Release.StorePath)
+	if err != nil {
+		t.Fatalf("Failed to open release store: %v", err)
+	}
+
+	_, err = store.Update(context.Background(), versionCode, func(r *release.Release) error {
+		r.VersionName = "1.0.1"
+		r.MessageID = 194275
+		r.State = state
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to seed release: %v", err)
+	}
+}
+
+func assertRetryButton(t *testing.T, buttons [][]pachca.Button, expectedJobID int, expectedMessageID int) {
+	t.Helper()
+
+	if len(buttons) != 1 || len(buttons[0]) != 1 {
+		t.Errorf("Expected a single button, got %v", buttons)
+		return
+	}
+	if buttons[0][0].Text != "Retry" {
+		t.Errorf("Expected button text 'Retry', got '%s'", buttons[0][0].Text)
+	}
+	buttonData := buttons[0][0].Data
+	if !strings.HasPrefix(buttonData, "retry|") {
+		t.Errorf("Expected button data to start with 'retry|', got '%s'", buttonData)
+	}
+	releaseInfo := verifyButtonData(t, buttonData, "retry")
+	if releaseInfo.JobID != expectedJobID {
+		t.Errorf("Expected button data job_id %d, got %d", expectedJobID, releaseInfo.JobID)
+	}
+	if releaseInfo.MessageID != expectedMessageID {
+		t.Errorf("Expected button data message_id %d, got %d", expectedMessageID, releaseInfo.MessageID)
+	}
+}
+
+func TestGitlabRejectsInvalidToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "missing token", token: ""},
+		{name: "wrong token", token: "guessed-webhook-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pachcaCalls atomic.Int32
+
+			mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				pachcaCalls.Add(1)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer mockPachca.Close()
+
+			t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			gitlabPayload := map[string]any{
+				"event":  "build",
+				"result": "success",
+				"data": map[string]any{
+					"job_id":       12345,
+					"version_code": 1001,
+					"version_name": "1.0.1",
+				},
+			}
+			payloadBytes, _ := json.Marshal(gitlabPayload)
+
+			req := httptest.NewRequest("POST", "/gitlab/webhook", bytes.NewReader(payloadBytes))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("X-Gitlab-Token", tt.token)
+			}
+			w := httptest.NewRecorder()
+
+			HandleGitlabHook(w, req, testConfig(t), mockPachca.Client())
+
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status 401, got %d", w.Code)
+			}
+			if pachcaCalls.Load() != 0 {
+				t.Errorf("Expected no calls to Pachca API, got %d", pachcaCalls.Load())
+			}
+			if !strings.Contains(logs.String(), "Rejected Gitlab payload") {
+				t.Errorf("Expected rejected attempt to be logged, got '%s'", logs.String())
+			}
+			if strings.Contains(logs.String(), "test-webhook-token") || strings.Contains(logs.String(), "guessed-webhook-token") {
+				t.Errorf("Expected log not to contain tokens, got '%s'", logs.String())
+			}
+		})
+	}
+}
+
+func verifyButtonData(t *testing.T, buttonData string, action string) shared.ReleaseInfo {
+	t.Helper()
+
+	releaseInfo, err := shared.VerifyReleaseInfo("test-release-key", action, strings.TrimPrefix(buttonData, action+"|"), time.Now())
+	if err != nil {
+		t.Errorf("Failed to verify button data '%s': %v", buttonData, err)
+		return shared.ReleaseInfo{}
+	}
+
+	return *releaseInfo
+}
+
+// webhookCount reads release_bot_webhooks_total for the labels, an empty value for those left out.
+func webhookCount(t *testing.T, labels map[string]string) float64 {
+	t.Helper()
+
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "release_bot_webhooks_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			matched := 0
+			for _, label := range metric.GetLabel() {
+				if labels[label.GetName()] == label.GetValue() {
+					matched++
+				}
+			}
+			if matched == len(metric.GetLabel()) {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
+
+	return 0
+}
+
+func TestGitlabRejectsMalformedData(t *testing.T) {
+	tests := []struct {
+		name string
+		data map[string]any
+	}{
+		{name: "missing version_code", data: map[string]any{"job_id": 12345, "version_name": "1.0.1"}},
+		{name: "version_name not a string", data: map[string]any{"job_id": 12345, "version_code": 1001, "version_name": 101}},
+		{name: "message_id not a number", data: map[string]any{"job_id": 12345, "version_code": 1001, "version_name": "1.0.1", "message_id": "194275"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pachcaCalls atomic.Int32
+
+			mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				pachcaCalls.Add(1)
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer mockPachca.Close()
+
+			t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+
+			gitlabPayload := map[string]any{
+				"event":  "build",
+				"result": "success",
+				"data":   tt.data,
+			}
+			payloadBytes, _ := json.Marshal(gitlabPayload)
+
+			req := httptest.NewRequest("POST", "/gitlab/webhook", bytes.NewReader(payloadBytes))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Gitlab-Token", "test-webhook-token")
+			w := httptest.NewRecorder()
+
+			HandleGitlabHook(w, req, testConfig(t), mockPachca.Client())
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d", w.Code)
+			}
+			if pachcaCalls.Load() != 0 {
+				t.Errorf("Expected no calls to Pachca API, got %d", pachcaCalls.Load())
+			}
+		})
+	}
 }
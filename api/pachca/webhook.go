@@ -1,18 +1,38 @@
 package handler
 
 import (
-	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"maps"
+	"net"
 	"net/http"
-	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
+	"go.opentelemetry.io/otel/attribute"
+
+	"pachca.com/android-deployment/audit"
+	"pachca.com/android-deployment/config"
+	"pachca.com/android-deployment/gitlab"
+	"pachca.com/android-deployment/logging"
+	"pachca.com/android-deployment/metrics"
+	"pachca.com/android-deployment/pachca"
+	"pachca.com/android-deployment/queue"
+	"pachca.com/android-deployment/release"
 	"pachca.com/android-deployment/shared"
+	"pachca.com/android-deployment/tracing"
 )
 
 type PachcaButtonWebhookPayload struct {
@@ -36,31 +56,29 @@ type PachcaViewSubmitPayload struct {
 	WebhookTimestamp int            `json:"webhook_timestamp"`
 }
 
-type PachcaViewRequest struct {
-	Type            string `json:"type"`
-	TriggerID       string `json:"trigger_id"`
-	CallbackID      string `json:"callback_id"`
-	PrivateMetadata string `json:"private_metadata"`
-	View            View   `json:"view"`
+// PachcaJob is what is left to do once a webhook has been checked: run a button action
+// or start a pipeline. It runs within the request, or in a queue worker when a queue is configured
+// and the job starts a pipeline.
+type PachcaJob struct {
+	Type        string              `json:"type"`
+	UserID      int                 `json:"user_id"`
+	Action      string              `json:"action"`
+	TriggerID   string              `json:"trigger_id,omitempty"`
+	ReleaseInfo *shared.ReleaseInfo `json:"release_info"`
+	Variables   []gitlab.Variable   `json:"variables,omitempty"`
+	// Form is the submitted form behind a pipeline, as recorded in the audit log.
+	Form map[string]string `json:"form,omitempty"`
+	// Traceparent continues the trace of the webhook in the queue worker.
+	Traceparent string `json:"traceparent,omitempty"`
 }
 
-type View struct {
-	Title  string      `json:"title"`
-	Blocks []ViewBlock `json:"blocks"`
-}
+const (
+	jobButton   string = "button"
+	jobPipeline string = "pipeline"
+)
 
-type ViewBlock struct {
-	Type        string `json:"type"`
-	Name        string `json:"name,omitempty"`
-	Label       string `json:"label,omitempty"`
-	Text        string `json:"text,omitempty"`
-	Placeholder string `json:"placeholder,omitempty"`
-	Multiline   bool   `json:"multiline,omitempty"`
-	MinLength   int    `json:"min_length,omitempty"`
-	MaxLength   int    `json:"max_length,omitempty"`
-	Required    bool   `json:"required,omitempty"`
-	Hint        string `json:"hint,omitempty"`
-}
+// JobKind names queued Pachca jobs.
+const JobKind = "pachca"
 
 type FormValidationErrorsResponse struct {
 	Errors map[string]string `json:"errors"`
@@ -68,185 +86,892 @@ type FormValidationErrorsResponse struct {
 
 type PromoteFormData struct {
 	RolloutPercentage int
-	ReleaseNotes      string
+	// ReleaseNotes are keyed by locale.
+	ReleaseNotes map[string]string
 }
 
-type Config struct {
-	PachcaBaseURL string
-	PachcaAPIKey  string
+type RolloutFormData struct {
+	RolloutPercentage int
 }
 
-func Handler(w http.ResponseWriter, r *http.Request) {
-	HandlePachcaHook(w, r, http.DefaultClient)
+type ReleaseStoresFormData struct {
+	// ReleaseNotes are keyed by locale.
+	ReleaseNotes map[string]string
 }
 
-func HandlePachcaHook(w http.ResponseWriter, r *http.Request, client *http.Client) {
-	config, err := NewConfig()
+const signatureHeader = "Pachca-Signature"
+
+// requestIDHeader tags the logs of a webhook with the ID a proxy in front of the bot assigned.
+const requestIDHeader = "X-Request-Id"
+
+// replayCache outlives a single request so that a webhook seen once
+// is rejected for the rest of its freshness window.
+var replayCache = shared.NewReplayCache()
+
+// loadConfig reads the configuration and sets up logging and tracing once per process rather than on every webhook.
+var loadConfig = sync.OnceValues(func() (*config.Config, error) {
+	config, err := config.LoadFromEnv()
 	if err != nil {
-		log.Printf("Config error: %s", err.Error())
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, err
+	}
+	if err := config.ValidateServerless(); err != nil {
+		return nil, err
+	}
+	if err := logging.Setup(config.Log); err != nil {
+		return nil, err
+	}
+	_, err = tracing.Setup(context.Background(), config.Tracing)
+	return config, err
+})
+
+func Handler(w http.ResponseWriter, r *http.Request) {
+	config, err := loadConfig()
+	if err != nil {
+		slog.Error("Config error", "error", err)
+		http.Error(w, "Invalid configuration", http.StatusInternalServerError)
 		return
 	}
 
+	HandlePachcaHook(w, r, config, http.DefaultClient)
+
+	// The platform may freeze the process once the response is sent.
+	if err := tracing.Flush(r.Context()); err != nil {
+		slog.Error("Error exporting spans", "error", err)
+	}
+}
+
+func HandlePachcaHook(w http.ResponseWriter, r *http.Request, config *config.Config, client *http.Client) {
+	r = r.WithContext(logging.WithRequestID(r.Context(), r.Header.Get(requestIDHeader)))
+
+	webhook := metrics.NewWebhook(w, metrics.ServicePachca)
+	defer webhook.Done()
+	w = webhook
+
+	r, span := tracing.StartWebhook(r, metrics.ServicePachca)
+	defer func() { tracing.EndWebhook(span, webhook.Status()) }()
+
 	bodyBytes, _ := io.ReadAll(r.Body)
-	log.Printf("Incoming Pachca payload: %s", string(bodyBytes))
+	logging.Payload(r.Context(), "Incoming Pachca payload", bodyBytes)
+
+	if !verifySignature(config.Pachca.SigningSecret, bodyBytes, r.Header.Get(signatureHeader)) {
+		slog.WarnContext(r.Context(), "Rejected Pachca payload with invalid signature")
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
 
 	var basePayload struct {
-		Type  string `json:"type"`
-		Event string `json:"event"`
+		Type             string `json:"type"`
+		Event            string `json:"event"`
+		TriggerID        string `json:"trigger_id"`
+		WebhookTimestamp int64  `json:"webhook_timestamp"`
 	}
 	if err := json.Unmarshal(bodyBytes, &basePayload); err != nil {
 		http.Error(w, "Invalid payload", http.StatusBadRequest)
 		return
 	}
+	webhook.Type = basePayload.Type + "_" + basePayload.Event
+	r = r.WithContext(logging.With(r.Context(), "event", webhook.Type))
+
+	now := time.Now()
+	sentAt := time.Unix(basePayload.WebhookTimestamp, 0)
+	if now.Sub(sentAt).Abs() > config.Pachca.WebhookMaxAge {
+		slog.WarnContext(r.Context(), "Rejected stale Pachca payload", "sent_at", sentAt.UTC())
+		http.Error(w, "Stale webhook", http.StatusUnauthorized)
+		return
+	}
+
+	key := replayKey(basePayload.TriggerID, bodyBytes)
+	if replayCache.Seen(key, sentAt.Add(config.Pachca.WebhookMaxAge), now) {
+		slog.WarnContext(r.Context(), "Rejected replayed Pachca payload", "sent_at", sentAt.UTC())
+		http.Error(w, "Replayed webhook", http.StatusConflict)
+		return
+	}
+	// The key is recorded up front so that concurrent deliveries are rejected, and dropped
+	// again when processing fails before Gitlab was asked to start anything, so that Pachca
+	// can retry the webhook without starting a pipeline or job twice.
+	ctx, started := trackStarts(r.Context())
+	r = r.WithContext(ctx)
+	defer func() {
+		if status := webhook.Status(); (status < 200 || status >= 300) && !started.Load() {
+			replayCache.Forget(key)
+		}
+	}()
+
+	store, err := release.OpenStore(config.Release.Store, config.Release.StorePath)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Release store error", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	pachcaClient := pachca.NewClient(config.Pachca.URL, config.Pachca.Key, client, pachca.WithRetryPolicy(config.Pachca.RetryPolicy()))
+	gitlabClient := gitlab.NewClient(config.Gitlab.URL, config.Gitlab.Key, config.Gitlab.ProjectID, client)
 
 	switch basePayload.Type {
 	case "button":
 		if basePayload.Event == "click" {
-			handleButtonClick(w, r, client, config, bodyBytes)
+			handleButtonClick(w, r, pachcaClient, gitlabClient, store, config, bodyBytes)
 		}
 	case "view":
 		if basePayload.Event == "submit" {
-			handleViewSubmit(w, r, client, config, bodyBytes)
+			handleViewSubmit(w, r, pachcaClient, gitlabClient, store, config, bodyBytes)
 		}
 	default:
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
-func handleButtonClick(w http.ResponseWriter, r *http.Request, client *http.Client, config *Config, bodyBytes []byte) {
+// buttonAction runs the action behind a message button, which is usually opening a form.
+type buttonAction func(ctx context.Context, pachcaClient *pachca.Client, gitlabClient *gitlab.Client, store release.Store, config *config.Config, userID int, triggerID string, releaseInfo *shared.ReleaseInfo) error
+
+var buttonActions = map[string]buttonAction{
+	"promote":        openPromoteForm,
+	"update_rollout": openRolloutForm,
+	"release_stores": openReleaseStoresForm,
+	"retry":          retryFailedJob,
+	"halt":           haltRollout,
+}
+
+// viewSubmitHandler handles a submitted form identified by its callback_id.
+type viewSubmitHandler func(w http.ResponseWriter, r *http.Request, pachcaClient *pachca.Client, gitlabClient *gitlab.Client, store release.Store, config *config.Config, userID int, releaseInfo *shared.ReleaseInfo, data map[string]any)
+
+// actionLabels name release actions in replies to users who are not allowed to perform them.
+var actionLabels = map[string]string{
+	shared.ActionPromote:       "Promote release",
+	shared.ActionUpdateRollout: "Update rollout",
+	shared.ActionReleaseStores: "Release to all stores",
+	shared.ActionRetry:         "Retry",
+	shared.ActionHalt:          "Halt rollout",
+}
+
+var viewSubmitHandlers = map[string]viewSubmitHandler{
+	"promote":        handlePromoteSubmit,
+	"update_rollout": handleRolloutSubmit,
+	"release_stores": handleReleaseStoresSubmit,
+}
+
+// verifySignature checks the hex-encoded HMAC-SHA256 of the raw body
+// that Pachca sends in the Pachca-Signature header.
+func verifySignature(secret string, body []byte, signature string) bool {
+	if signature == "" {
+		return false
+	}
+
+	received, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hmac.Equal(received, mac.Sum(nil))
+}
+
+// replayKey identifies a webhook delivery: button clicks by their trigger_id,
+// everything else by the hash of the signed body.
+func replayKey(triggerID string, body []byte) string {
+	if triggerID != "" {
+		return "trigger:" + triggerID
+	}
+
+	sum := sha256.Sum256(body)
+	return "body:" + hex.EncodeToString(sum[:])
+}
+
+func handleButtonClick(w http.ResponseWriter, r *http.Request, pachcaClient *pachca.Client, gitlabClient *gitlab.Client, store release.Store, config *config.Config, bodyBytes []byte) {
 	var payload PachcaButtonWebhookPayload
 	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
 		http.Error(w, "Invalid payload", http.StatusBadRequest)
 		return
 	}
 
-	releaseInfo, err := parseButtonData(payload.Data)
+	r = r.WithContext(logging.With(r.Context(), "user_id", payload.UserID))
+
+	action, releaseInfo, err := parseButtonData(config, payload.Data)
 	if err != nil {
+		slog.WarnContext(r.Context(), "Rejected button data", "error", err)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	metrics.SetAction(w, action)
 
 	if releaseInfo.JobID == 0 {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
 
-	err = openPromoteForm(r.Context(), client, config, payload.TriggerID, releaseInfo)
+	releaseInfo.MessageID = payload.MessageID
+	r = r.WithContext(logging.With(r.Context(), "action", action, "version_code", releaseInfo.VersionCode))
+	tracing.SetRelease(r.Context(), releaseInfo)
+	tracing.Set(r.Context(), attribute.String("pachca.action", action), attribute.Int("pachca.user_id", payload.UserID))
+
+	if !config.Policy.Allows(action, payload.UserID) {
+		slog.WarnContext(r.Context(), "User is not allowed to run the action")
+		recordDenial(r.Context(), config, payload.UserID, action, releaseInfo, audit.OutcomeNotAllowed)
+		if err := replyNotAllowed(r.Context(), pachcaClient, payload.UserID, action, releaseInfo); err != nil {
+			slog.ErrorContext(r.Context(), "Error replying to user", "error", err)
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	available, err := checkAction(r.Context(), pachcaClient, store, payload.UserID, action, releaseInfo)
 	if err != nil {
-		log.Printf("Error opening promote form: %s", err.Error())
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if !available {
+		recordDenial(r.Context(), config, payload.UserID, action, releaseInfo, audit.OutcomeRejected)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
 
-	w.WriteHeader(http.StatusOK)
+	carryOut(w, r, pachcaClient, gitlabClient, store, config, PachcaJob{
+		Type:        jobButton,
+		UserID:      payload.UserID,
+		Action:      action,
+		TriggerID:   payload.TriggerID,
+		ReleaseInfo: releaseInfo,
+	})
 }
 
-func handleViewSubmit(w http.ResponseWriter, r *http.Request, client *http.Client, config *Config, bodyBytes []byte) {
+func handleViewSubmit(w http.ResponseWriter, r *http.Request, pachcaClient *pachca.Client, gitlabClient *gitlab.Client, store release.Store, config *config.Config, bodyBytes []byte) {
 	var payload PachcaViewSubmitPayload
 	if err := json.Unmarshal(bodyBytes, &payload); err != nil {
 		http.Error(w, "Invalid payload", http.StatusBadRequest)
 		return
 	}
 
-	if payload.CallbackID != "promote" {
+	handler, ok := viewSubmitHandlers[payload.CallbackID]
+	if !ok {
 		w.WriteHeader(http.StatusOK)
 		return
 	}
+	metrics.SetAction(w, payload.CallbackID)
 
-	var releaseInfo shared.ReleaseInfo
-	if err := json.Unmarshal([]byte(payload.PrivateMetadata), &releaseInfo); err != nil {
+	r = r.WithContext(logging.With(r.Context(), "user_id", payload.UserID, "action", payload.CallbackID))
+
+	releaseInfo, err := shared.VerifyReleaseInfo(config.Release.SigningKey, payload.CallbackID, payload.PrivateMetadata, time.Now())
+	if err != nil {
+		slog.WarnContext(r.Context(), "Rejected private_metadata", "error", err)
 		http.Error(w, "Invalid private_metadata", http.StatusBadRequest)
 		return
 	}
+	r = r.WithContext(logging.With(r.Context(), "version_code", releaseInfo.VersionCode))
+	tracing.SetRelease(r.Context(), releaseInfo)
+	tracing.Set(r.Context(), attribute.String("pachca.action", payload.CallbackID), attribute.Int("pachca.user_id", payload.UserID))
+
+	if !config.Policy.Allows(payload.CallbackID, payload.UserID) {
+		slog.WarnContext(r.Context(), "User is not allowed to submit the form")
+		recordDenial(r.Context(), config, payload.UserID, payload.CallbackID, releaseInfo, audit.OutcomeNotAllowed)
+		if err := replyNotAllowed(r.Context(), pachcaClient, payload.UserID, payload.CallbackID, releaseInfo); err != nil {
+			slog.ErrorContext(r.Context(), "Error replying to user", "error", err)
+		}
+		http.Error(w, "Action not allowed", http.StatusForbidden)
+		return
+	}
+
+	available, err := checkAction(r.Context(), pachcaClient, store, payload.UserID, payload.CallbackID, releaseInfo)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !available {
+		recordDenial(r.Context(), config, payload.UserID, payload.CallbackID, releaseInfo, audit.OutcomeRejected)
+		http.Error(w, "Action not available", http.StatusConflict)
+		return
+	}
+
+	handler(w, r, pachcaClient, gitlabClient, store, config, payload.UserID, releaseInfo, payload.Data)
+}
+
+// replyNotAllowed explains to the user in a direct message why nothing happened.
+func replyNotAllowed(ctx context.Context, pachcaClient *pachca.Client, userID int, action string, releaseInfo *shared.ReleaseInfo) error {
+	_, err := pachcaClient.CreateMessage(ctx, pachca.MessageCreateRequest{
+		Message: pachca.NewMessage{
+			EntityType: "user",
+			EntityID:   userID,
+			Content: fmt.Sprintf(
+				"You are not allowed to use \"%s\" for release %s (%d). Ask a release manager for access.",
+				actionLabels[action], releaseInfo.VersionName, releaseInfo.VersionCode,
+			),
+		},
+	})
+	return err
+}
+
+// checkAction reports whether the lifecycle of the release allows the action in its current state.
+// When it does not, the user gets a direct message explaining why nothing happened.
+func checkAction(ctx context.Context, pachcaClient *pachca.Client, store release.Store, userID int, action string, releaseInfo *shared.ReleaseInfo) (bool, error) {
+	r, err := store.Get(ctx, releaseInfo.VersionCode)
+	if errors.Is(err, release.ErrNotFound) {
+		r = &release.Release{VersionCode: releaseInfo.VersionCode}
+	} else if err != nil {
+		return false, err
+	}
+
+	actionErr := r.CanStart(action)
+	if actionErr == nil {
+		return true, nil
+	}
+
+	slog.WarnContext(ctx, "Rejected action", "state", r.State, "error", actionErr)
+
+	_, err = pachcaClient.CreateMessage(ctx, pachca.MessageCreateRequest{
+		Message: pachca.NewMessage{
+			EntityType: "user",
+			EntityID:   userID,
+			Content: fmt.Sprintf(
+				"\"%s\" is not available for release %s (%d): the release is %s.",
+				actionLabels[action], releaseInfo.VersionName, releaseInfo.VersionCode, r.State.Description(),
+			),
+		},
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error replying to user", "error", err)
+	}
+
+	return false, nil
+}
 
-	errors := validatePromoteForm(payload.Data)
+func handlePromoteSubmit(w http.ResponseWriter, r *http.Request, pachcaClient *pachca.Client, gitlabClient *gitlab.Client, store release.Store, config *config.Config, userID int, releaseInfo *shared.ReleaseInfo, data map[string]any) {
+	errors := validatePromoteForm(config, data)
 	if len(errors) > 0 {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(FormValidationErrorsResponse{Errors: errors})
+		writeValidationErrors(w, errors)
 		return
 	}
 
 	var formData PromoteFormData
-	rolloutStr := payload.Data["rollout_percentage"].(string)
+	rolloutStr := data["rollout_percentage"].(string)
 	formData.RolloutPercentage, _ = strconv.Atoi(rolloutStr)
-	formData.ReleaseNotes = payload.Data["release_notes"].(string)
+	formData.ReleaseNotes = parseReleaseNotes(config, data)
 
-	log.Printf("Promote form submitted: job=%d, version=%s (%d), rollout=%d%%, notes=%s",
-		releaseInfo.JobID, releaseInfo.VersionName, releaseInfo.VersionCode,
-		formData.RolloutPercentage, formData.ReleaseNotes)
+	slog.InfoContext(r.Context(), "Promote form submitted", "job", releaseInfo.JobID,
+		"version_name", releaseInfo.VersionName, "rollout_percentage", formData.RolloutPercentage)
 
-	w.WriteHeader(http.StatusOK)
+	form := releaseNotesForm(config, formData.ReleaseNotes)
+	form["rollout_percentage"] = strconv.Itoa(formData.RolloutPercentage)
+
+	carryOut(w, r, pachcaClient, gitlabClient, store, config, PachcaJob{
+		Type:        jobPipeline,
+		UserID:      userID,
+		Action:      "promote",
+		ReleaseInfo: releaseInfo,
+		Variables:   promoteJobVariables(config, releaseInfo, formData),
+		Form:        form,
+	})
 }
 
-func validatePromoteForm(data map[string]any) map[string]string {
-	errors := make(map[string]string)
+func handleRolloutSubmit(w http.ResponseWriter, r *http.Request, pachcaClient *pachca.Client, gitlabClient *gitlab.Client, store release.Store, config *config.Config, userID int, releaseInfo *shared.ReleaseInfo, data map[string]any) {
+	errors := validateRolloutForm(data)
+	if len(errors) > 0 {
+		writeValidationErrors(w, errors)
+		return
+	}
 
-	rolloutStr, ok := data["rollout_percentage"].(string)
-	if !ok || rolloutStr == "" {
-		errors["rollout_percentage"] = "Rollout percentage is required"
-	} else {
-		rollout, err := strconv.Atoi(rolloutStr)
+	var formData RolloutFormData
+	rolloutStr := data["rollout_percentage"].(string)
+	formData.RolloutPercentage, _ = strconv.Atoi(rolloutStr)
+
+	slog.InfoContext(r.Context(), "Rollout form submitted", "job", releaseInfo.JobID,
+		"version_name", releaseInfo.VersionName, "rollout_percentage", formData.RolloutPercentage)
+
+	carryOut(w, r, pachcaClient, gitlabClient, store, config, PachcaJob{
+		Type:        jobPipeline,
+		UserID:      userID,
+		Action:      "rollout",
+		ReleaseInfo: releaseInfo,
+		Variables:   rolloutJobVariables(config, releaseInfo, formData),
+		Form:        map[string]string{"rollout_percentage": strconv.Itoa(formData.RolloutPercentage)},
+	})
+}
+
+func handleReleaseStoresSubmit(w http.ResponseWriter, r *http.Request, pachcaClient *pachca.Client, gitlabClient *gitlab.Client, store release.Store, config *config.Config, userID int, releaseInfo *shared.ReleaseInfo, data map[string]any) {
+	errors := validateReleaseStoresForm(config, data)
+	if len(errors) > 0 {
+		writeValidationErrors(w, errors)
+		return
+	}
+
+	var formData ReleaseStoresFormData
+	formData.ReleaseNotes = parseReleaseNotes(config, data)
+
+	slog.InfoContext(r.Context(), "Release to all stores form submitted", "job", releaseInfo.JobID,
+		"version_name", releaseInfo.VersionName)
+
+	carryOut(w, r, pachcaClient, gitlabClient, store, config, PachcaJob{
+		Type:        jobPipeline,
+		UserID:      userID,
+		Action:      "other_stores",
+		ReleaseInfo: releaseInfo,
+		Variables:   releaseStoresJobVariables(config, releaseInfo, formData),
+		Form:        releaseNotesForm(config, formData.ReleaseNotes),
+	})
+}
+
+func writeValidationErrors(w http.ResponseWriter, errors map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(FormValidationErrorsResponse{Errors: errors})
+}
+
+// pipelineStates lists the pipelines that move a release to a new state as soon as they start.
+var pipelineStates = map[string]release.State{
+	"other_stores": release.StateReleasingOtherStores,
+	"halt":         release.StateHalted,
+}
+
+// carryOut runs the job within the request, or queues a pipeline start and answers right away
+// when a queue is configured. Button actions always run within the request: the views they open
+// need the trigger ID of the click, which Pachca accepts only for a few seconds.
+func carryOut(w http.ResponseWriter, r *http.Request, pachcaClient *pachca.Client, gitlabClient *gitlab.Client, store release.Store, config *config.Config, job PachcaJob) {
+	if config.Queue.Store != "" && job.Type == jobPipeline {
+		if err := enqueueJob(r.Context(), config, job); err != nil {
+			slog.ErrorContext(r.Context(), "Error queueing job", "type", job.Type, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		slog.InfoContext(r.Context(), "Queued job", "type", job.Type)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	err := runJob(r.Context(), pachcaClient, gitlabClient, store, config, job)
+	// Another action claimed the release after checkAction let this one through.
+	var transitionErr *release.TransitionError
+	switch {
+	case errors.As(err, &transitionErr):
+		recordDenial(r.Context(), config, job.UserID, jobAction(job), job.ReleaseInfo, audit.OutcomeRejected)
+		http.Error(w, "Action not available", http.StatusConflict)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// jobAction names the release action of a job as the policy and the audit log do.
+func jobAction(job PachcaJob) string {
+	if job.Type == jobPipeline {
+		return shared.PipelineActions[job.Action]
+	}
+	return job.Action
+}
+
+func enqueueJob(ctx context.Context, config *config.Config, job PachcaJob) error {
+	jobs, err := queue.Open(config.Queue.Store, config.Queue.Path)
+	if err != nil {
+		return err
+	}
+
+	job.Traceparent = tracing.Traceparent(ctx)
+	payload, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	_, err = jobs.Enqueue(ctx, JobKind, payload, time.Now())
+	return err
+}
+
+// ProcessPachcaJob runs a job that HandlePachcaHook has queued.
+func ProcessPachcaJob(ctx context.Context, config *config.Config, client *http.Client, payload []byte) (err error) {
+	var job PachcaJob
+	if err := json.Unmarshal(payload, &job); err != nil {
+		return queue.Permanent(err)
+	}
+
+	ctx, span := tracing.StartJob(ctx, "pachca "+job.Type+" job", job.Traceparent)
+	defer func() { tracing.End(span, err) }()
+	tracing.SetRelease(ctx, job.ReleaseInfo)
+	tracing.Set(ctx, attribute.String("pachca.action", job.Action), attribute.Int("pachca.user_id", job.UserID))
+
+	store, err := release.OpenStore(config.Release.Store, config.Release.StorePath)
+	if err != nil {
+		return err
+	}
+
+	pachcaClient := pachca.NewClient(config.Pachca.URL, config.Pachca.Key, client, pachca.WithRetryPolicy(config.Pachca.RetryPolicy()))
+	gitlabClient := gitlab.NewClient(config.Gitlab.URL, config.Gitlab.Key, config.Gitlab.ProjectID, client)
+
+	ctx = logging.With(ctx, "user_id", job.UserID, "action", job.Action, "version_code", job.ReleaseInfo.VersionCode)
+
+	ctx, started := trackStarts(ctx)
+	err = runJob(ctx, pachcaClient, gitlabClient, store, config, job)
+	var transitionErr *release.TransitionError
+	switch {
+	case errors.As(err, &transitionErr):
+		recordDenial(ctx, config, job.UserID, jobAction(job), job.ReleaseInfo, audit.OutcomeRejected)
+		return queue.Permanent(err)
+	case err != nil && started.Load():
+		// Running the job again would start a second pipeline, so what is left is reported instead.
+		slog.ErrorContext(ctx, "Job failed after Gitlab may have started the pipeline", "error", err)
+		return queue.Permanent(err)
+	}
+	return err
+}
+
+func runJob(ctx context.Context, pachcaClient *pachca.Client, gitlabClient *gitlab.Client, store release.Store, config *config.Config, job PachcaJob) error {
+	switch job.Type {
+	case jobButton:
+		action, ok := buttonActions[job.Action]
+		if !ok {
+			return queue.Permanent(fmt.Errorf("unknown button action %q", job.Action))
+		}
+		if err := action(ctx, pachcaClient, gitlabClient, store, config, job.UserID, job.TriggerID, job.ReleaseInfo); err != nil {
+			slog.ErrorContext(ctx, "Error running button action", "error", err)
+			return err
+		}
+		return nil
+	case jobPipeline:
+		return startPipeline(ctx, gitlabClient, store, config, job)
+	default:
+		return queue.Permanent(fmt.Errorf("unknown job type %q", job.Type))
+	}
+}
+
+func startPipeline(ctx context.Context, gitlabClient *gitlab.Client, store release.Store, config *config.Config, job PachcaJob) error {
+	action, releaseInfo, variables := job.Action, job.ReleaseInfo, job.Variables
+	entry := &audit.Entry{UserID: job.UserID, Action: shared.PipelineActions[action], ReleaseInfo: *releaseInfo, Form: job.Form}
+
+	// A pipeline that moves the release on claims the new state before it starts, so that
+	// of two submissions that both passed checkAction only one reaches Gitlab.
+	claimed, claims := pipelineStates[action]
+	var from release.State
+	if claims {
+		_, err := store.Update(ctx, releaseInfo.VersionCode, func(rel *release.Release) error {
+			from = rel.State
+			return rel.Transition(claimed)
+		})
 		if err != nil {
-			errors["rollout_percentage"] = "Rollout percentage must be a number"
-		} else if rollout < 0 || rollout > 100 {
-			errors["rollout_percentage"] = "Rollout percentage must be between 0 and 100"
+			slog.WarnContext(ctx, "Error claiming release state before starting pipeline", "error", err)
+			return err
+		}
+	}
+
+	// The CI job sends the variable back, so that its result links to this action.
+	if traceparent := tracing.Traceparent(ctx); traceparent != "" {
+		variables = append(slices.Clip(variables), gitlab.Variable{Key: tracing.TraceparentVariable, Value: traceparent})
+	}
+
+	pipeline, err := gitlabClient.TriggerPipeline(ctx, gitlab.PipelineRequest{
+		Ref:       config.Gitlab.Ref,
+		Variables: variables,
+	})
+	mayHaveStarted := gitlabMayHaveActed(err)
+	if mayHaveStarted {
+		markStarted(ctx)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error triggering pipeline", "error", err)
+		recordAction(ctx, config, entry, err)
+		if claims && !mayHaveStarted {
+			revertClaim(ctx, store, releaseInfo.VersionCode, claimed, from, action+"_failed", err)
 		}
+		return err
+	}
+
+	entry.PipelineID = pipeline.ID
+	recordAction(ctx, config, entry, nil)
+
+	slog.InfoContext(ctx, "Pipeline started", "pipeline_id", pipeline.ID, "version_name", releaseInfo.VersionName)
+
+	_, err = store.Update(ctx, releaseInfo.VersionCode, func(rel *release.Release) error {
+		rel.Record(time.Now(), action+"_started", fmt.Sprintf("pipeline %d", pipeline.ID))
+		return nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error updating release after starting pipeline", "pipeline_id", pipeline.ID, "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// startedKey carries the flag that trackStarts hands out.
+type startedKey struct{}
+
+// trackStarts lets the caller learn whether a webhook or queued job went as far as asking Gitlab
+// to start a pipeline or retry a job. Running it again after that could start them twice.
+func trackStarts(ctx context.Context) (context.Context, *atomic.Bool) {
+	started := new(atomic.Bool)
+	return context.WithValue(ctx, startedKey{}, started), started
+}
+
+func markStarted(ctx context.Context) {
+	if started, ok := ctx.Value(startedKey{}).(*atomic.Bool); ok {
+		started.Store(true)
+	}
+}
+
+// gitlabMayHaveActed reports whether a call to Gitlab may have been carried out. Only an error
+// answer from Gitlab or a connection that was never made shows that it was not: a call that
+// timed out may have been accepted all the same.
+func gitlabMayHaveActed(err error) bool {
+	var apiErr *gitlab.APIError
+	var opErr *net.OpError
+	return !errors.As(err, &apiErr) && !(errors.As(err, &opErr) && opErr.Op == "dial")
+}
+
+// revertClaim gives back the state an action claimed when Gitlab did not start it,
+// and notes the failure in the history of the release.
+func revertClaim(ctx context.Context, store release.Store, versionCode int, claimed release.State, from release.State, event string, cause error) {
+	// The claim is given back even when the call failed because the request was cancelled.
+	ctx = context.WithoutCancel(ctx)
+
+	_, err := store.Update(ctx, versionCode, func(rel *release.Release) error {
+		rel.Revert(claimed, from)
+		rel.Record(time.Now(), event, cause.Error())
+		return nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error reverting release state", "state", claimed, "error", err)
+	}
+}
+
+// recordAction records the outcome of starting a release action.
+func recordAction(ctx context.Context, config *config.Config, entry *audit.Entry, actionErr error) {
+	entry.Outcome = audit.OutcomeStarted
+	if actionErr != nil {
+		entry.Outcome = audit.OutcomeFailed
+		entry.Error = actionErr.Error()
+	}
+	appendAudit(ctx, config, entry)
+}
+
+// recordDenial records an action that the release policy or lifecycle turned down.
+func recordDenial(ctx context.Context, config *config.Config, userID int, action string, releaseInfo *shared.ReleaseInfo, outcome string) {
+	appendAudit(ctx, config, &audit.Entry{UserID: userID, Action: action, ReleaseInfo: *releaseInfo, Outcome: outcome})
+}
+
+// appendAudit writes the entry to the audit log. The action has been decided by then,
+// so a log that cannot be written is reported and does not fail the webhook.
+func appendAudit(ctx context.Context, config *config.Config, entry *audit.Entry) {
+	entry.At = time.Now()
+
+	auditLog, err := audit.Open(config.Audit.Store, config.Audit.Path)
+	if err == nil {
+		err = auditLog.Append(ctx, entry)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error writing audit log", "outcome", entry.Outcome, "error", err)
+	}
+}
+
+func promoteJobVariables(config *config.Config, releaseInfo *shared.ReleaseInfo, formData PromoteFormData) []gitlab.Variable {
+	variables := []gitlab.Variable{
+		{Key: "DEPLOY_ACTION", Value: "promote"},
+		{Key: "DEPLOY_GRADLE_TASK", Value: config.DefaultApp().PromoteTask},
+		{Key: "DEPLOY_GRADLE_ARGS", Value: "--from-track internal --promote-track production " + rolloutArgs(formData.RolloutPercentage)},
+		{Key: "ROLLOUT_PERCENTAGE", Value: strconv.Itoa(formData.RolloutPercentage)},
+	}
+	variables = append(variables, releaseNotesVariables(config, formData.ReleaseNotes)...)
+
+	return append(variables, releaseVariables(releaseInfo)...)
+}
+
+func rolloutJobVariables(config *config.Config, releaseInfo *shared.ReleaseInfo, formData RolloutFormData) []gitlab.Variable {
+	variables := []gitlab.Variable{
+		{Key: "DEPLOY_ACTION", Value: "rollout"},
+		{Key: "DEPLOY_GRADLE_TASK", Value: config.DefaultApp().PromoteTask},
+		{Key: "DEPLOY_GRADLE_ARGS", Value: "--from-track production --promote-track production " + rolloutArgs(formData.RolloutPercentage)},
+		{Key: "ROLLOUT_PERCENTAGE", Value: strconv.Itoa(formData.RolloutPercentage)},
+	}
+
+	return append(variables, releaseVariables(releaseInfo)...)
+}
+
+func haltJobVariables(config *config.Config, releaseInfo *shared.ReleaseInfo) []gitlab.Variable {
+	variables := []gitlab.Variable{
+		{Key: "DEPLOY_ACTION", Value: "halt"},
+		{Key: "DEPLOY_GRADLE_TASK", Value: config.DefaultApp().PromoteTask},
+		{Key: "DEPLOY_GRADLE_ARGS", Value: "--from-track production --promote-track production --release-status halted"},
+	}
+
+	return append(variables, releaseVariables(releaseInfo)...)
+}
+
+func releaseStoresJobVariables(config *config.Config, releaseInfo *shared.ReleaseInfo, formData ReleaseStoresFormData) []gitlab.Variable {
+	variables := []gitlab.Variable{
+		{Key: "DEPLOY_ACTION", Value: "other_stores"},
+	}
+	variables = append(variables, releaseNotesVariables(config, formData.ReleaseNotes)...)
+
+	return append(variables, releaseVariables(releaseInfo)...)
+}
+
+// releaseNotesVariables passes the notes of every locale as RELEASE_NOTES_<LOCALE>, like
+// RELEASE_NOTES_EN_US, and lists the locales in RELEASE_NOTES_LOCALES. RELEASE_NOTES keeps
+// the notes of the first locale for jobs that know a single language.
+func releaseNotesVariables(config *config.Config, notes map[string]string) []gitlab.Variable {
+	locales := config.Release.Notes.Locales
+
+	variables := []gitlab.Variable{
+		{Key: "RELEASE_NOTES", Value: notes[locales[0]]},
+		{Key: "RELEASE_NOTES_LOCALES", Value: strings.Join(locales, ",")},
+	}
+	for _, locale := range locales {
+		variables = append(variables, gitlab.Variable{Key: releaseNotesVariable(locale), Value: notes[locale]})
+	}
+
+	return variables
+}
+
+func releaseNotesVariable(locale string) string {
+	return "RELEASE_NOTES_" + strings.ToUpper(strings.ReplaceAll(locale, "-", "_"))
+}
+
+// releaseVariables passes ReleaseInfo to the job so that it can be sent back
+// in the result hook.
+func releaseVariables(releaseInfo *shared.ReleaseInfo) []gitlab.Variable {
+	return []gitlab.Variable{
+		{Key: "RELEASE_JOB_ID", Value: strconv.Itoa(releaseInfo.JobID)},
+		{Key: "RELEASE_VERSION_CODE", Value: strconv.Itoa(releaseInfo.VersionCode)},
+		{Key: "RELEASE_VERSION_NAME", Value: releaseInfo.VersionName},
+		{Key: "RELEASE_MESSAGE_ID", Value: strconv.Itoa(releaseInfo.MessageID)},
+	}
+}
+
+// rolloutArgs maps a rollout percentage to Gradle Play Publisher release flags.
+// 100% completes the release, anything below is a staged rollout with the matching user fraction.
+func rolloutArgs(percentage int) string {
+	switch percentage {
+	case 100:
+		return "--release-status completed"
+	default:
+		fraction := strconv.FormatFloat(float64(percentage)/100, 'f', -1, 64)
+		return "--release-status inProgress --user-fraction " + fraction
 	}
+}
+
+func validatePromoteForm(config *config.Config, data map[string]any) map[string]string {
+	errors := validateRolloutForm(data)
+	maps.Copy(errors, validateReleaseNotes(config, data, config.Release.Notes.PlayMaxLength))
+
+	return errors
+}
+
+func validateReleaseStoresForm(config *config.Config, data map[string]any) map[string]string {
+	return validateReleaseNotes(config, data, config.Release.Notes.OtherStoresMaxLength)
+}
+
+// validateReleaseNotes requires notes in every locale. The stores limit notes in characters,
+// so the length is counted in runes rather than bytes.
+func validateReleaseNotes(config *config.Config, data map[string]any, maxLength int) map[string]string {
+	errors := make(map[string]string)
 
-	notes, ok := data["release_notes"].(string)
-	if !ok || notes == "" {
-		errors["release_notes"] = "Release notes are required"
-	} else if len(notes) > 500 {
-		errors["release_notes"] = "Release notes must be 500 characters or less"
+	for _, locale := range config.Release.Notes.Locales {
+		field := releaseNotesField(locale)
+		notes, ok := data[field].(string)
+		if !ok || notes == "" {
+			errors[field] = fmt.Sprintf("Release notes (%s) are required", locale)
+		} else if utf8.RuneCountInString(notes) > maxLength {
+			errors[field] = fmt.Sprintf("Release notes (%s) must be %d characters or less", locale, maxLength)
+		}
 	}
 
 	return errors
 }
 
-func NewConfig() (*Config, error) {
-	pachcaBaseURL := os.Getenv(shared.EnvPachcaUrl)
-	if pachcaBaseURL == "" {
-		return nil, fmt.Errorf("ENV_PACHCA_URL not set")
+// parseReleaseNotes reads the notes of a validated form, keyed by locale.
+func parseReleaseNotes(config *config.Config, data map[string]any) map[string]string {
+	notes := make(map[string]string)
+	for _, locale := range config.Release.Notes.Locales {
+		notes[locale] = data[releaseNotesField(locale)].(string)
 	}
 
-	pachcaAPIKey := os.Getenv(shared.EnvPachcaKey)
-	if pachcaAPIKey == "" {
-		return nil, fmt.Errorf("ENV_PACHCA_KEY not set")
+	return notes
+}
+
+// releaseNotesForm lists the notes under their field names for the audit log.
+func releaseNotesForm(config *config.Config, notes map[string]string) map[string]string {
+	form := make(map[string]string)
+	for _, locale := range config.Release.Notes.Locales {
+		form[releaseNotesField(locale)] = notes[locale]
 	}
 
-	return &Config{
-		PachcaBaseURL: pachcaBaseURL,
-		PachcaAPIKey:  pachcaAPIKey,
-	}, nil
+	return form
+}
+
+func releaseNotesField(locale string) string {
+	return "release_notes_" + locale
+}
+
+// releaseNotesBlocks asks for the notes in every configured locale.
+func releaseNotesBlocks(config *config.Config, maxLength int) []pachca.ViewBlock {
+	var blocks []pachca.ViewBlock
+	for _, locale := range config.Release.Notes.Locales {
+		blocks = append(blocks, pachca.ViewBlock{
+			Type:        "input",
+			Name:        releaseNotesField(locale),
+			Label:       fmt.Sprintf("Release notes (%s)", locale),
+			Placeholder: "Enter release notes",
+			Multiline:   true,
+			MaxLength:   maxLength,
+			Required:    true,
+		})
+	}
+
+	return blocks
+}
+
+func validateRolloutForm(data map[string]any) map[string]string {
+	errors := make(map[string]string)
+
+	rolloutStr, ok := data["rollout_percentage"].(string)
+	if !ok || rolloutStr == "" {
+		errors["rollout_percentage"] = "Rollout percentage is required"
+	} else {
+		rollout, err := strconv.Atoi(rolloutStr)
+		if err != nil {
+			errors["rollout_percentage"] = "Rollout percentage must be a number"
+		} else if rollout < 1 || rollout > 100 {
+			errors["rollout_percentage"] = "Rollout percentage must be between 1 and 100"
+		}
+	}
+
+	return errors
 }
 
-func parseButtonData(data string) (*shared.ReleaseInfo, error) {
+func parseButtonData(config *config.Config, data string) (string, *shared.ReleaseInfo, error) {
 	parts := strings.SplitN(data, "|", 2)
-	if len(parts) != 2 || parts[0] != "promote" {
-		return nil, fmt.Errorf("invalid button data format")
+	if len(parts) != 2 {
+		return "", nil, fmt.Errorf("invalid button data format")
+	}
+	if _, ok := buttonActions[parts[0]]; !ok {
+		return "", nil, fmt.Errorf("invalid button data format")
 	}
 
-	var releaseInfo shared.ReleaseInfo
-	if err := json.Unmarshal([]byte(parts[1]), &releaseInfo); err != nil {
-		return nil, fmt.Errorf("invalid button data json")
+	releaseInfo, err := shared.VerifyReleaseInfo(config.Release.SigningKey, parts[0], parts[1], time.Now())
+	if errors.Is(err, shared.ErrInvalidSignature) || errors.Is(err, shared.ErrWrongAction) || errors.Is(err, shared.ErrExpired) {
+		return "", nil, fmt.Errorf("invalid button data: %w", err)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid button data json")
 	}
 
-	return &releaseInfo, nil
+	return parts[0], releaseInfo, nil
+}
+
+// signPrivateMetadata carries ReleaseInfo from a button to the form it opens,
+// signed for the callback_id of that form.
+func signPrivateMetadata(config *config.Config, callbackID string, releaseInfo *shared.ReleaseInfo) string {
+	privateMetadata, _ := shared.SignReleaseInfo(config.Release.SigningKey, callbackID, *releaseInfo, time.Now().Add(config.Release.DataTTL))
+	return privateMetadata
 }
 
-func openPromoteForm(ctx context.Context, client *http.Client, config *Config, triggerID string, releaseInfo *shared.ReleaseInfo) error {
-	privateMetadata, _ := json.Marshal(releaseInfo)
+func openPromoteForm(ctx context.Context, pachcaClient *pachca.Client, gitlabClient *gitlab.Client, store release.Store, config *config.Config, userID int, triggerID string, releaseInfo *shared.ReleaseInfo) error {
+	privateMetadata := signPrivateMetadata(config, "promote", releaseInfo)
 
-	viewReq := PachcaViewRequest{
+	viewReq := pachca.ViewRequest{
 		Type:            "modal",
 		TriggerID:       triggerID,
 		CallbackID:      "promote",
-		PrivateMetadata: string(privateMetadata),
-		View: View{
+		PrivateMetadata: privateMetadata,
+		View: pachca.View{
 			Title: "Promote Release",
-			Blocks: []ViewBlock{
+			Blocks: append([]pachca.ViewBlock{
 				{
 					Type: "header",
 					Text: fmt.Sprintf("Promote %s (%d) from job %d", releaseInfo.VersionName, releaseInfo.VersionCode, releaseInfo.JobID),
@@ -255,56 +980,123 @@ func openPromoteForm(ctx context.Context, client *http.Client, config *Config, t
 					Type:        "input",
 					Name:        "rollout_percentage",
 					Label:       "Rollout percentage",
-					Placeholder: "Enter percentage (0-100)",
+					Placeholder: "Enter percentage (1-100)",
 					MinLength:   1,
 					MaxLength:   3,
 					Required:    true,
-					Hint:        "Percentage of users who will receive this update (0-100)",
+					Hint:        "Percentage of users who will receive this update (1-100)",
+				},
+			}, releaseNotesBlocks(config, config.Release.Notes.PlayMaxLength)...),
+		},
+	}
+
+	return pachcaClient.OpenView(ctx, viewReq)
+}
+
+func openRolloutForm(ctx context.Context, pachcaClient *pachca.Client, gitlabClient *gitlab.Client, store release.Store, config *config.Config, userID int, triggerID string, releaseInfo *shared.ReleaseInfo) error {
+	privateMetadata := signPrivateMetadata(config, "update_rollout", releaseInfo)
+
+	viewReq := pachca.ViewRequest{
+		Type:            "modal",
+		TriggerID:       triggerID,
+		CallbackID:      "update_rollout",
+		PrivateMetadata: privateMetadata,
+		View: pachca.View{
+			Title: "Update Rollout",
+			Blocks: []pachca.ViewBlock{
+				{
+					Type: "header",
+					Text: fmt.Sprintf("Update rollout of %s (%d)", releaseInfo.VersionName, releaseInfo.VersionCode),
 				},
 				{
 					Type:        "input",
-					Name:        "release_notes",
-					Label:       "Release notes",
-					Placeholder: "Enter release notes",
-					Multiline:   true,
-					MaxLength:   500,
+					Name:        "rollout_percentage",
+					Label:       "Rollout percentage",
+					Placeholder: "Enter percentage (1-100)",
+					MinLength:   1,
+					MaxLength:   3,
 					Required:    true,
+					Hint:        "Percentage of users who will receive this update (1-100)",
 				},
 			},
 		},
 	}
 
-	return sendView(ctx, client, config, viewReq)
+	return pachcaClient.OpenView(ctx, viewReq)
 }
 
-func sendView(ctx context.Context, client *http.Client, config *Config, viewReq PachcaViewRequest) error {
-	payloadBytes, err := json.Marshal(viewReq)
-	if err != nil {
-		return err
+func openReleaseStoresForm(ctx context.Context, pachcaClient *pachca.Client, gitlabClient *gitlab.Client, store release.Store, config *config.Config, userID int, triggerID string, releaseInfo *shared.ReleaseInfo) error {
+	privateMetadata := signPrivateMetadata(config, "release_stores", releaseInfo)
+
+	viewReq := pachca.ViewRequest{
+		Type:            "modal",
+		TriggerID:       triggerID,
+		CallbackID:      "release_stores",
+		PrivateMetadata: privateMetadata,
+		View: pachca.View{
+			Title: "Release to All Stores",
+			Blocks: append([]pachca.ViewBlock{
+				{
+					Type: "header",
+					Text: fmt.Sprintf("Release %s (%d) to all stores", releaseInfo.VersionName, releaseInfo.VersionCode),
+				},
+			}, releaseNotesBlocks(config, config.Release.Notes.OtherStoresMaxLength)...),
+		},
 	}
 
-	log.Printf("Outgoing Pachca view payload: %s", string(payloadBytes))
+	return pachcaClient.OpenView(ctx, viewReq)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", config.PachcaBaseURL+"/views/open", bytes.NewReader(payloadBytes))
+// retryFailedJob retries the Gitlab job referenced by the "Retry" button of a failure message.
+// The release leaves the failed state before the job is retried, so that a second click is rejected.
+func retryFailedJob(ctx context.Context, pachcaClient *pachca.Client, gitlabClient *gitlab.Client, store release.Store, config *config.Config, userID int, triggerID string, releaseInfo *shared.ReleaseInfo) error {
+	entry := &audit.Entry{UserID: userID, Action: shared.ActionRetry, ReleaseInfo: *releaseInfo}
+
+	var retried release.State
+	_, err := store.Update(ctx, releaseInfo.VersionCode, func(r *release.Release) error {
+		retried = r.FailedFrom
+		return r.Retry()
+	})
 	if err != nil {
+		slog.WarnContext(ctx, "Error claiming release state before retrying job", "error", err)
 		return err
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+config.PachcaAPIKey)
-
-	resp, err := client.Do(req)
+	job, err := gitlabClient.RetryJob(ctx, releaseInfo.JobID)
+	mayHaveStarted := gitlabMayHaveActed(err)
+	if mayHaveStarted {
+		markStarted(ctx)
+	}
 	if err != nil {
+		recordAction(ctx, config, entry, err)
+		if !mayHaveStarted {
+			revertClaim(ctx, store, releaseInfo.VersionCode, retried, release.StateFailed, "retry_failed", err)
+		}
 		return err
 	}
-	defer resp.Body.Close()
 
-	respBody, _ := io.ReadAll(resp.Body)
-	log.Printf("Pachca view response: %s", string(respBody))
+	entry.JobID = job.ID
+	recordAction(ctx, config, entry, nil)
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("Pachca view API returned status %d", resp.StatusCode)
-	}
+	slog.InfoContext(ctx, "Job retried", "failed_job_id", releaseInfo.JobID, "retry_job_id", job.ID, "version_name", releaseInfo.VersionName)
 
-	return nil
+	_, err = store.Update(ctx, releaseInfo.VersionCode, func(r *release.Release) error {
+		r.Record(time.Now(), "retry", fmt.Sprintf("job %d as job %d", releaseInfo.JobID, job.ID))
+		return nil
+	})
+	return err
+}
+
+// haltRollout starts the pipeline that halts the staged rollout behind the "Halt rollout" button.
+// There is nothing to fill in, so no form is opened first.
+func haltRollout(ctx context.Context, pachcaClient *pachca.Client, gitlabClient *gitlab.Client, store release.Store, config *config.Config, userID int, triggerID string, releaseInfo *shared.ReleaseInfo) error {
+	slog.InfoContext(ctx, "Halt rollout clicked", "version_name", releaseInfo.VersionName)
+
+	return startPipeline(ctx, gitlabClient, store, config, PachcaJob{
+		Type:        jobPipeline,
+		UserID:      userID,
+		Action:      "halt",
+		ReleaseInfo: releaseInfo,
+		Variables:   haltJobVariables(config, releaseInfo),
+	})
 }
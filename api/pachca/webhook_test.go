@@ -2,16 +2,36 @@ package handler
 
 import (
 	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync/atomic"
 	"testing"
+	"time"
 
+	"pachca.com/android-deployment/audit"
+	"pachca.com/android-deployment/config"
+	"pachca.com/android-deployment/gitlab"
+	"pachca.com/android-deployment/metrics"
+	"pachca.com/android-deployment/pachca"
+	"pachca.com/android-deployment/queue"
+	"pachca.com/android-deployment/release"
 	"pachca.com/android-deployment/shared"
+	"pachca.com/android-deployment/tracing"
 )
 
 func TestPachcaNotifiesPromoteBuildButtonClicked(t *testing.T) {
+	resetReplayCache()
+
 	var viewCalls atomic.Int32
 
 	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -23,7 +43,7 @@ func TestPachcaNotifiesPromoteBuildButtonClicked(t *testing.T) {
 				t.Errorf("Expected POST method, got %s", r.Method)
 			}
 
-			var viewReq PachcaViewRequest
+			var viewReq pachca.ViewRequest
 			json.NewDecoder(r.Body).Decode(&viewReq)
 
 			if viewReq.TriggerID == "" {
@@ -79,11 +99,11 @@ func TestPachcaNotifiesPromoteBuildButtonClicked(t *testing.T) {
 			if notesBlock.Type != "input" {
 				t.Errorf("Expected block[2] type 'input', got '%s'", notesBlock.Type)
 			}
-			if notesBlock.Name != "release_notes" {
-				t.Errorf("Expected block[2] name 'release_notes', got '%s'", notesBlock.Name)
+			if notesBlock.Name != "release_notes_ru-RU" {
+				t.Errorf("Expected block[2] name 'release_notes_ru-RU', got '%s'", notesBlock.Name)
 			}
-			if notesBlock.Label != "Release notes" {
-				t.Errorf("Expected block[2] label 'Release notes', got '%s'", notesBlock.Label)
+			if notesBlock.Label != "Release notes (ru-RU)" {
+				t.Errorf("Expected block[2] label 'Release notes (ru-RU)', got '%s'", notesBlock.Label)
 			}
 			if !notesBlock.Multiline {
 				t.Error("Expected release_notes to be multiline")
@@ -95,10 +115,7 @@ func TestPachcaNotifiesPromoteBuildButtonClicked(t *testing.T) {
 				t.Errorf("Expected release_notes max_length 500, got %d", notesBlock.MaxLength)
 			}
 
-			var privateMeta shared.ReleaseInfo
-			if err := json.Unmarshal([]byte(viewReq.PrivateMetadata), &privateMeta); err != nil {
-				t.Errorf("Failed to unmarshal private_metadata: %v", err)
-			}
+			privateMeta := verifyPrivateMetadata(t, "promote", viewReq.PrivateMetadata)
 			if privateMeta.JobID != 12345 {
 				t.Errorf("Expected private_metadata job_id 12345, got %d", privateMeta.JobID)
 			}
@@ -108,6 +125,9 @@ func TestPachcaNotifiesPromoteBuildButtonClicked(t *testing.T) {
 			if privateMeta.VersionName != "1.0.1" {
 				t.Errorf("Expected private_metadata version_name '1.0.1', got '%s'", privateMeta.VersionName)
 			}
+			if privateMeta.MessageID != 194275 {
+				t.Errorf("Expected private_metadata message_id 194275, got %d", privateMeta.MessageID)
+			}
 
 			w.WriteHeader(http.StatusOK)
 		default:
@@ -117,24 +137,26 @@ func TestPachcaNotifiesPromoteBuildButtonClicked(t *testing.T) {
 	defer mockPachca.Close()
 
 	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
-	t.Setenv(shared.EnvPachcaKey, "test-api-key")
+	seedRelease(t, 1001, release.StateInternal)
 
 	pachcaPayload := map[string]any{
-		"type":       "button",
-		"event":      "click",
-		"trigger_id": "550e8400-e29b-41d4-a716-446655440000",
-		"data":       "promote|{\"job_id\":12345,\"version_code\":1001,\"version_name\":\"1.0.1\"}",
-		"message_id": 194275,
-		"user_id":    123,
-		"chat_id":    198,
+		"type":              "button",
+		"event":             "click",
+		"trigger_id":        "550e8400-e29b-41d4-a716-446655440000",
+		"data":              "promote|" + signReleaseInfo("promote", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1"}),
+		"message_id":        194275,
+		"user_id":           123,
+		"chat_id":           198,
+		"webhook_timestamp": time.Now().Unix(),
 	}
 	payloadBytes, _ := json.Marshal(pachcaPayload)
 
 	req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
 	w := httptest.NewRecorder()
 
-	HandlePachcaHook(w, req, mockPachca.Client())
+	HandlePachcaHook(w, req, testConfig(t), mockPachca.Client())
 
 	if w.Code != http.StatusOK {
 		t.Errorf("Expected status 200, got %d", w.Code)
@@ -145,38 +167,97 @@ func TestPachcaNotifiesPromoteBuildButtonClicked(t *testing.T) {
 }
 
 func TestPachcaNotifiesPromoteBuildFormFilled(t *testing.T) {
+	resetReplayCache()
+
 	t.Run("successful submission", func(t *testing.T) {
+		var pipelineCalls atomic.Int32
+
 		mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
 		}))
 		defer mockPachca.Close()
 
+		mockGitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/projects/42/pipeline":
+				pipelineCalls.Add(1)
+
+				if r.Method != "POST" {
+					t.Errorf("Expected POST method, got %s", r.Method)
+				}
+				if r.Header.Get("PRIVATE-TOKEN") != "test-gitlab-key" {
+					t.Errorf("Expected PRIVATE-TOKEN 'test-gitlab-key', got '%s'", r.Header.Get("PRIVATE-TOKEN"))
+				}
+
+				var pipelineReq gitlab.PipelineRequest
+				json.NewDecoder(r.Body).Decode(&pipelineReq)
+
+				if pipelineReq.Ref != "release" {
+					t.Errorf("Expected ref 'release', got '%s'", pipelineReq.Ref)
+				}
+
+				variables := make(map[string]string)
+				for _, v := range pipelineReq.Variables {
+					variables[v.Key] = v.Value
+				}
+				expected := map[string]string{
+					"DEPLOY_ACTION":         "promote",
+					"DEPLOY_GRADLE_TASK":    ":app_pachca:play:promoteProdArtifact",
+					"DEPLOY_GRADLE_ARGS":    "--from-track internal --promote-track production --release-status inProgress --user-fraction 0.25",
+					"ROLLOUT_PERCENTAGE":    "25",
+					"RELEASE_NOTES":         "Bug fixes and improvements",
+					"RELEASE_NOTES_RU_RU":   "Bug fixes and improvements",
+					"RELEASE_NOTES_LOCALES": "ru-RU",
+					"RELEASE_JOB_ID":        "12345",
+					"RELEASE_VERSION_CODE":  "1001",
+					"RELEASE_VERSION_NAME":  "1.0.1",
+					"RELEASE_MESSAGE_ID":    "194275",
+				}
+				for key, value := range expected {
+					if variables[key] != value {
+						t.Errorf("Expected variable %s '%s', got '%s'", key, value, variables[key])
+					}
+				}
+
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(map[string]any{"id": 777})
+			default:
+				t.Errorf("Unexpected path: %s", r.URL.Path)
+			}
+		}))
+		defer mockGitlab.Close()
+
 		t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
-		t.Setenv(shared.EnvPachcaKey, "test-api-key")
+		t.Setenv(shared.EnvGitlabUrl, mockGitlab.URL)
+		seedRelease(t, 1001, release.StateInternal)
 
 		submitPayload := map[string]any{
 			"type":             "view",
 			"event":            "submit",
 			"callback_id":      "promote",
-			"private_metadata": "{\"job_id\":12345,\"version_code\":1001,\"version_name\":\"1.0.1\"}",
+			"private_metadata": signReleaseInfo("promote", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
 			"user_id":          123,
 			"data": map[string]any{
-				"rollout_percentage": "25",
-				"release_notes":      "Bug fixes and improvements",
+				"rollout_percentage":  "25",
+				"release_notes_ru-RU": "Bug fixes and improvements",
 			},
-			"webhook_timestamp": 1755075544,
+			"webhook_timestamp": time.Now().Unix(),
 		}
 		payloadBytes, _ := json.Marshal(submitPayload)
 
 		req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
 		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
 		w := httptest.NewRecorder()
 
-		HandlePachcaHook(w, req, mockPachca.Client())
+		HandlePachcaHook(w, req, testConfig(t), mockPachca.Client())
 
 		if w.Code != http.StatusOK {
 			t.Errorf("Expected status 200, got %d", w.Code)
 		}
+		if pipelineCalls.Load() != 1 {
+			t.Errorf("Expected 1 call to Gitlab pipeline API, got %d", pipelineCalls.Load())
+		}
 	})
 
 	t.Run("validation error - invalid rollout percentage", func(t *testing.T) {
@@ -186,27 +267,28 @@ func TestPachcaNotifiesPromoteBuildFormFilled(t *testing.T) {
 		defer mockPachca.Close()
 
 		t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
-		t.Setenv(shared.EnvPachcaKey, "test-api-key")
+		seedRelease(t, 1001, release.StateInternal)
 
 		submitPayload := map[string]any{
 			"type":             "view",
 			"event":            "submit",
 			"callback_id":      "promote",
-			"private_metadata": "{\"job_id\":12345,\"version_code\":1001,\"version_name\":\"1.0.1\"}",
+			"private_metadata": signReleaseInfo("promote", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
 			"user_id":          123,
 			"data": map[string]any{
-				"rollout_percentage": "150",
-				"release_notes":      "Bug fixes",
+				"rollout_percentage":  "150",
+				"release_notes_ru-RU": "Bug fixes",
 			},
-			"webhook_timestamp": 1755075544,
+			"webhook_timestamp": time.Now().Unix(),
 		}
 		payloadBytes, _ := json.Marshal(submitPayload)
 
 		req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
 		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
 		w := httptest.NewRecorder()
 
-		HandlePachcaHook(w, req, mockPachca.Client())
+		HandlePachcaHook(w, req, testConfig(t), mockPachca.Client())
 
 		if w.Code != http.StatusBadRequest {
 			t.Errorf("Expected status 400, got %d", w.Code)
@@ -215,7 +297,7 @@ func TestPachcaNotifiesPromoteBuildFormFilled(t *testing.T) {
 		var resp FormValidationErrorsResponse
 		json.NewDecoder(w.Body).Decode(&resp)
 
-		if resp.Errors["rollout_percentage"] != "Rollout percentage must be between 0 and 100" {
+		if resp.Errors["rollout_percentage"] != "Rollout percentage must be between 1 and 100" {
 			t.Errorf("Expected rollout error message, got '%s'", resp.Errors["rollout_percentage"])
 		}
 	})
@@ -227,27 +309,28 @@ func TestPachcaNotifiesPromoteBuildFormFilled(t *testing.T) {
 		defer mockPachca.Close()
 
 		t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
-		t.Setenv(shared.EnvPachcaKey, "test-api-key")
+		seedRelease(t, 1001, release.StateInternal)
 
 		submitPayload := map[string]any{
 			"type":             "view",
 			"event":            "submit",
 			"callback_id":      "promote",
-			"private_metadata": "{\"job_id\":12345,\"version_code\":1001,\"version_name\":\"1.0.1\"}",
+			"private_metadata": signReleaseInfo("promote", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
 			"user_id":          123,
 			"data": map[string]any{
-				"rollout_percentage": "25",
-				"release_notes":      "",
+				"rollout_percentage":  "25",
+				"release_notes_ru-RU": "",
 			},
-			"webhook_timestamp": 1755075544,
+			"webhook_timestamp": time.Now().Unix(),
 		}
 		payloadBytes, _ := json.Marshal(submitPayload)
 
 		req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
 		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
 		w := httptest.NewRecorder()
 
-		HandlePachcaHook(w, req, mockPachca.Client())
+		HandlePachcaHook(w, req, testConfig(t), mockPachca.Client())
 
 		if w.Code != http.StatusBadRequest {
 			t.Errorf("Expected status 400, got %d", w.Code)
@@ -256,8 +339,8 @@ func TestPachcaNotifiesPromoteBuildFormFilled(t *testing.T) {
 		var resp FormValidationErrorsResponse
 		json.NewDecoder(w.Body).Decode(&resp)
 
-		if resp.Errors["release_notes"] != "Release notes are required" {
-			t.Errorf("Expected release notes error message, got '%s'", resp.Errors["release_notes"])
+		if resp.Errors["release_notes_ru-RU"] != "Release notes (ru-RU) are required" {
+			t.Errorf("Expected release notes error message, got '%s'", resp.Errors["release_notes_ru-RU"])
 		}
 	})
 
@@ -268,27 +351,28 @@ func TestPachcaNotifiesPromoteBuildFormFilled(t *testing.T) {
 		defer mockPachca.Close()
 
 		t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
-		t.Setenv(shared.EnvPachcaKey, "test-api-key")
+		seedRelease(t, 1001, release.StateInternal)
 
 		submitPayload := map[string]any{
 			"type":             "view",
 			"event":            "submit",
 			"callback_id":      "promote",
-			"private_metadata": "{\"job_id\":12345,\"version_code\":1001,\"version_name\":\"1.0.1\"}",
+			"private_metadata": signReleaseInfo("promote", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
 			"user_id":          123,
 			"data": map[string]any{
-				"rollout_percentage": "150",
-				"release_notes":      "",
+				"rollout_percentage":  "150",
+				"release_notes_ru-RU": "",
 			},
-			"webhook_timestamp": 1755075544,
+			"webhook_timestamp": time.Now().Unix(),
 		}
 		payloadBytes, _ := json.Marshal(submitPayload)
 
 		req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
 		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
 		w := httptest.NewRecorder()
 
-		HandlePachcaHook(w, req, mockPachca.Client())
+		HandlePachcaHook(w, req, testConfig(t), mockPachca.Client())
 
 		if w.Code != http.StatusBadRequest {
 			t.Errorf("Expected status 400, got %d", w.Code)
@@ -297,27 +381,1891 @@ func TestPachcaNotifiesPromoteBuildFormFilled(t *testing.T) {
 		var resp FormValidationErrorsResponse
 		json.NewDecoder(w.Body).Decode(&resp)
 
-		if resp.Errors["rollout_percentage"] != "Rollout percentage must be between 0 and 100" {
+		if resp.Errors["rollout_percentage"] != "Rollout percentage must be between 1 and 100" {
 			t.Errorf("Expected rollout error message, got '%s'", resp.Errors["rollout_percentage"])
 		}
-		if resp.Errors["release_notes"] != "Release notes are required" {
-			t.Errorf("Expected release notes error message, got '%s'", resp.Errors["release_notes"])
+		if resp.Errors["release_notes_ru-RU"] != "Release notes (ru-RU) are required" {
+			t.Errorf("Expected release notes error message, got '%s'", resp.Errors["release_notes_ru-RU"])
 		}
 	})
 }
 
 func TestPachcaNotifiesUpdateRolloutButtonClicked(t *testing.T) {
+	resetReplayCache()
+
+	var viewCalls atomic.Int32
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/views/open":
+			viewCalls.Add(1)
+
+			var viewReq pachca.ViewRequest
+			json.NewDecoder(r.Body).Decode(&viewReq)
+
+			if viewReq.CallbackID != "update_rollout" {
+				t.Errorf("Expected callback_id 'update_rollout', got '%s'", viewReq.CallbackID)
+			}
+
+			if viewReq.View.Title != "Update Rollout" {
+				t.Errorf("Expected title 'Update Rollout', got '%s'", viewReq.View.Title)
+			}
+
+			if len(viewReq.View.Blocks) != 2 {
+				t.Errorf("Expected 2 blocks, got %d", len(viewReq.View.Blocks))
+				return
+			}
+
+			expectedHeader := "Update rollout of 1.0.1 (1001)"
+			if viewReq.View.Blocks[0].Text != expectedHeader {
+				t.Errorf("Expected header '%s', got '%s'", expectedHeader, viewReq.View.Blocks[0].Text)
+			}
+
+			rolloutBlock := viewReq.View.Blocks[1]
+			if rolloutBlock.Name != "rollout_percentage" {
+				t.Errorf("Expected block[1] name 'rollout_percentage', got '%s'", rolloutBlock.Name)
+			}
+			if !rolloutBlock.Required {
+				t.Error("Expected rollout_percentage to be required")
+			}
+
+			privateMeta := verifyPrivateMetadata(t, "update_rollout", viewReq.PrivateMetadata)
+			if privateMeta.VersionCode != 1001 {
+				t.Errorf("Expected private_metadata version_code 1001, got %d", privateMeta.VersionCode)
+			}
+			if privateMeta.MessageID != 194275 {
+				t.Errorf("Expected private_metadata message_id 194275, got %d", privateMeta.MessageID)
+			}
+
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+	seedRelease(t, 1001, release.StateProductionInProgress)
+
+	pachcaPayload := map[string]any{
+		"type":              "button",
+		"event":             "click",
+		"trigger_id":        "550e8400-e29b-41d4-a716-446655440001",
+		"data":              "update_rollout|" + signReleaseInfo("update_rollout", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+		"message_id":        194275,
+		"user_id":           123,
+		"chat_id":           198,
+		"webhook_timestamp": time.Now().Unix(),
+	}
+	payloadBytes, _ := json.Marshal(pachcaPayload)
+
+	req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+	w := httptest.NewRecorder()
+
+	HandlePachcaHook(w, req, testConfig(t), mockPachca.Client())
 
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if viewCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Pachca view API, got %d", viewCalls.Load())
+	}
 }
 
 func TestPachcaNotifiesUpdateRolloutFormFilled(t *testing.T) {
+	resetReplayCache()
+
+	t.Run("successful submission", func(t *testing.T) {
+		var pipelineCalls atomic.Int32
+
+		mockGitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/projects/42/pipeline":
+				pipelineCalls.Add(1)
+
+				var pipelineReq gitlab.PipelineRequest
+				json.NewDecoder(r.Body).Decode(&pipelineReq)
+
+				variables := make(map[string]string)
+				for _, v := range pipelineReq.Variables {
+					variables[v.Key] = v.Value
+				}
+				expected := map[string]string{
+					"DEPLOY_ACTION":        "rollout",
+					"DEPLOY_GRADLE_TASK":   ":app_pachca:play:promoteProdArtifact",
+					"DEPLOY_GRADLE_ARGS":   "--from-track production --promote-track production --release-status inProgress --user-fraction 0.5",
+					"ROLLOUT_PERCENTAGE":   "50",
+					"RELEASE_VERSION_CODE": "1001",
+					"RELEASE_MESSAGE_ID":   "194275",
+				}
+				for key, value := range expected {
+					if variables[key] != value {
+						t.Errorf("Expected variable %s '%s', got '%s'", key, value, variables[key])
+					}
+				}
+				if _, ok := variables["RELEASE_NOTES"]; ok {
+					t.Error("Expected no RELEASE_NOTES variable for rollout update")
+				}
+
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(map[string]any{"id": 778})
+			default:
+				t.Errorf("Unexpected path: %s", r.URL.Path)
+			}
+		}))
+		defer mockGitlab.Close()
+
+		t.Setenv(shared.EnvGitlabUrl, mockGitlab.URL)
+		seedRelease(t, 1001, release.StateProductionInProgress)
+
+		submitPayload := map[string]any{
+			"type":             "view",
+			"event":            "submit",
+			"callback_id":      "update_rollout",
+			"private_metadata": signReleaseInfo("update_rollout", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+			"user_id":          123,
+			"data": map[string]any{
+				"rollout_percentage": "50",
+			},
+			"webhook_timestamp": time.Now().Unix(),
+		}
+		payloadBytes, _ := json.Marshal(submitPayload)
+
+		req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+		w := httptest.NewRecorder()
+
+		HandlePachcaHook(w, req, testConfig(t), mockGitlab.Client())
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+		if pipelineCalls.Load() != 1 {
+			t.Errorf("Expected 1 call to Gitlab pipeline API, got %d", pipelineCalls.Load())
+		}
+	})
+
+	t.Run("validation error - invalid rollout percentage", func(t *testing.T) {
+		seedRelease(t, 1001, release.StateProductionInProgress)
+
+		submitPayload := map[string]any{
+			"type":             "view",
+			"event":            "submit",
+			"callback_id":      "update_rollout",
+			"private_metadata": signReleaseInfo("update_rollout", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+			"user_id":          123,
+			"data": map[string]any{
+				"rollout_percentage": "half",
+			},
+			"webhook_timestamp": time.Now().Unix(),
+		}
+		payloadBytes, _ := json.Marshal(submitPayload)
+
+		req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+		w := httptest.NewRecorder()
+
+		HandlePachcaHook(w, req, testConfig(t), http.DefaultClient)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+
+		var resp FormValidationErrorsResponse
+		json.NewDecoder(w.Body).Decode(&resp)
 
+		if resp.Errors["rollout_percentage"] != "Rollout percentage must be a number" {
+			t.Errorf("Expected rollout error message, got '%s'", resp.Errors["rollout_percentage"])
+		}
+		if _, ok := resp.Errors["release_notes_ru-RU"]; ok {
+			t.Error("Expected no release notes error for rollout form")
+		}
+	})
 }
 
 func TestPachcaNotifiesReleaseToOtherStoresButtonClicked(t *testing.T) {
+	resetReplayCache()
+
+	var viewCalls atomic.Int32
 
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/views/open":
+			viewCalls.Add(1)
+
+			var viewReq pachca.ViewRequest
+			json.NewDecoder(r.Body).Decode(&viewReq)
+
+			if viewReq.CallbackID != "release_stores" {
+				t.Errorf("Expected callback_id 'release_stores', got '%s'", viewReq.CallbackID)
+			}
+
+			if viewReq.View.Title != "Release to All Stores" {
+				t.Errorf("Expected title 'Release to All Stores', got '%s'", viewReq.View.Title)
+			}
+
+			if len(viewReq.View.Blocks) != 2 {
+				t.Errorf("Expected 2 blocks, got %d", len(viewReq.View.Blocks))
+				return
+			}
+
+			notesBlock := viewReq.View.Blocks[1]
+			if notesBlock.Name != "release_notes_ru-RU" {
+				t.Errorf("Expected block[1] name 'release_notes_ru-RU', got '%s'", notesBlock.Name)
+			}
+			if !notesBlock.Multiline {
+				t.Error("Expected release_notes to be multiline")
+			}
+			if !notesBlock.Required {
+				t.Error("Expected release_notes to be required")
+			}
+
+			privateMeta := verifyPrivateMetadata(t, "release_stores", viewReq.PrivateMetadata)
+			if privateMeta.MessageID != 194275 {
+				t.Errorf("Expected private_metadata message_id 194275, got %d", privateMeta.MessageID)
+			}
+
+			w.WriteHeader(http.StatusOK)
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+	seedRelease(t, 1001, release.StateProductionInProgress)
+
+	pachcaPayload := map[string]any{
+		"type":              "button",
+		"event":             "click",
+		"trigger_id":        "550e8400-e29b-41d4-a716-446655440002",
+		"data":              "release_stores|" + signReleaseInfo("release_stores", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+		"message_id":        194275,
+		"user_id":           123,
+		"chat_id":           198,
+		"webhook_timestamp": time.Now().Unix(),
+	}
+	payloadBytes, _ := json.Marshal(pachcaPayload)
+
+	req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+	w := httptest.NewRecorder()
+
+	HandlePachcaHook(w, req, testConfig(t), mockPachca.Client())
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if viewCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Pachca view API, got %d", viewCalls.Load())
+	}
 }
 
 func TestPachcaNotifiesReleaseToOtherStoresFormFilled(t *testing.T) {
+	resetReplayCache()
+
+	t.Run("successful submission", func(t *testing.T) {
+		var pipelineCalls atomic.Int32
+
+		mockGitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/projects/42/pipeline":
+				pipelineCalls.Add(1)
+
+				var pipelineReq gitlab.PipelineRequest
+				json.NewDecoder(r.Body).Decode(&pipelineReq)
+
+				variables := make(map[string]string)
+				for _, v := range pipelineReq.Variables {
+					variables[v.Key] = v.Value
+				}
+				expected := map[string]string{
+					"DEPLOY_ACTION":         "other_stores",
+					"RELEASE_NOTES":         "Bug fixes and improvements",
+					"RELEASE_NOTES_RU_RU":   "Bug fixes and improvements",
+					"RELEASE_NOTES_LOCALES": "ru-RU",
+					"RELEASE_JOB_ID":        "12345",
+					"RELEASE_VERSION_CODE":  "1001",
+					"RELEASE_VERSION_NAME":  "1.0.1",
+					"RELEASE_MESSAGE_ID":    "194275",
+				}
+				for key, value := range expected {
+					if variables[key] != value {
+						t.Errorf("Expected variable %s '%s', got '%s'", key, value, variables[key])
+					}
+				}
+
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(map[string]any{"id": 779})
+			default:
+				t.Errorf("Unexpected path: %s", r.URL.Path)
+			}
+		}))
+		defer mockGitlab.Close()
+
+		t.Setenv(shared.EnvGitlabUrl, mockGitlab.URL)
+		seedRelease(t, 1001, release.StateProductionInProgress)
+
+		submitPayload := map[string]any{
+			"type":             "view",
+			"event":            "submit",
+			"callback_id":      "release_stores",
+			"private_metadata": signReleaseInfo("release_stores", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+			"user_id":          123,
+			"data": map[string]any{
+				"release_notes_ru-RU": "Bug fixes and improvements",
+			},
+			"webhook_timestamp": time.Now().Unix(),
+		}
+		payloadBytes, _ := json.Marshal(submitPayload)
+
+		req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+		w := httptest.NewRecorder()
+
+		HandlePachcaHook(w, req, testConfig(t), mockGitlab.Client())
+
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+		if pipelineCalls.Load() != 1 {
+			t.Errorf("Expected 1 call to Gitlab pipeline API, got %d", pipelineCalls.Load())
+		}
+	})
+
+	t.Run("validation error - missing release notes", func(t *testing.T) {
+		seedRelease(t, 1001, release.StateProductionInProgress)
+
+		submitPayload := map[string]any{
+			"type":             "view",
+			"event":            "submit",
+			"callback_id":      "release_stores",
+			"private_metadata": signReleaseInfo("release_stores", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+			"user_id":          123,
+			"data": map[string]any{
+				"release_notes_ru-RU": "",
+			},
+			"webhook_timestamp": time.Now().Unix(),
+		}
+		payloadBytes, _ := json.Marshal(submitPayload)
+
+		req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+		w := httptest.NewRecorder()
+
+		HandlePachcaHook(w, req, testConfig(t), http.DefaultClient)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400, got %d", w.Code)
+		}
+
+		var resp FormValidationErrorsResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+
+		if resp.Errors["release_notes_ru-RU"] != "Release notes (ru-RU) are required" {
+			t.Errorf("Expected release notes error message, got '%s'", resp.Errors["release_notes_ru-RU"])
+		}
+		if _, ok := resp.Errors["rollout_percentage"]; ok {
+			t.Error("Expected no rollout error for release to all stores form")
+		}
+	})
+}
+
+func TestPachcaNotifiesHaltButtonClicked(t *testing.T) {
+	resetReplayCache()
+
+	var pipelineCalls atomic.Int32
+
+	mockGitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/projects/42/pipeline":
+			pipelineCalls.Add(1)
+
+			var pipelineReq gitlab.PipelineRequest
+			json.NewDecoder(r.Body).Decode(&pipelineReq)
+
+			variables := make(map[string]string)
+			for _, v := range pipelineReq.Variables {
+				variables[v.Key] = v.Value
+			}
+			expected := map[string]string{
+				"DEPLOY_ACTION":        "halt",
+				"DEPLOY_GRADLE_TASK":   ":app_pachca:play:promoteProdArtifact",
+				"DEPLOY_GRADLE_ARGS":   "--from-track production --promote-track production --release-status halted",
+				"RELEASE_JOB_ID":       "12345",
+				"RELEASE_VERSION_CODE": "1001",
+				"RELEASE_VERSION_NAME": "1.0.1",
+				"RELEASE_MESSAGE_ID":   "194275",
+			}
+			for key, value := range expected {
+				if variables[key] != value {
+					t.Errorf("Expected variable %s '%s', got '%s'", key, value, variables[key])
+				}
+			}
+
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{"id": 780})
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockGitlab.Close()
+
+	t.Setenv(shared.EnvGitlabUrl, mockGitlab.URL)
+	seedRelease(t, 1001, release.StateProductionInProgress)
+
+	pachcaPayload := map[string]any{
+		"type":              "button",
+		"event":             "click",
+		"trigger_id":        "550e8400-e29b-41d4-a716-446655440005",
+		"data":              "halt|" + signReleaseInfo("halt", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+		"message_id":        194275,
+		"user_id":           123,
+		"chat_id":           198,
+		"webhook_timestamp": time.Now().Unix(),
+	}
+	payloadBytes, _ := json.Marshal(pachcaPayload)
+
+	req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+	w := httptest.NewRecorder()
+
+	HandlePachcaHook(w, req, testConfig(t), mockGitlab.Client())
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if pipelineCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Gitlab pipeline API, got %d", pipelineCalls.Load())
+	}
+	if state := releaseState(t, 1001); state != release.StateHalted {
+		t.Errorf("Expected state %s, got %s", release.StateHalted, state)
+	}
+}
+
+func TestPachcaNotifiesRetryButtonClicked(t *testing.T) {
+	resetReplayCache()
+
+	var retryCalls atomic.Int32
+
+	mockGitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/projects/42/jobs/12400/retry":
+			retryCalls.Add(1)
+
+			if r.Method != "POST" {
+				t.Errorf("Expected POST method, got %s", r.Method)
+			}
+			if r.Header.Get("PRIVATE-TOKEN") != "test-gitlab-key" {
+				t.Errorf("Expected PRIVATE-TOKEN 'test-gitlab-key', got '%s'", r.Header.Get("PRIVATE-TOKEN"))
+			}
+
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{"id": 12401, "status": "pending"})
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockGitlab.Close()
+
+	t.Setenv(shared.EnvGitlabUrl, mockGitlab.URL)
+	seedRelease(t, 1001, release.StateFailed)
+
+	pachcaPayload := map[string]any{
+		"type":              "button",
+		"event":             "click",
+		"trigger_id":        "550e8400-e29b-41d4-a716-446655440003",
+		"data":              "retry|" + signReleaseInfo("retry", shared.ReleaseInfo{JobID: 12400, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+		"message_id":        194275,
+		"user_id":           123,
+		"chat_id":           198,
+		"webhook_timestamp": time.Now().Unix(),
+	}
+	payloadBytes, _ := json.Marshal(pachcaPayload)
+
+	req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+	w := httptest.NewRecorder()
+
+	HandlePachcaHook(w, req, testConfig(t), mockGitlab.Client())
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if retryCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Gitlab job retry API, got %d", retryCalls.Load())
+	}
+	if state := releaseState(t, 1001); state != release.StateInternal {
+		t.Errorf("Expected release to go back to %q, got %q", release.StateInternal, state)
+	}
+}
+
+func TestPachcaClaimsReleaseBeforeCallingGitlab(t *testing.T) {
+	tests := []struct {
+		name           string
+		seed           release.State
+		path           string
+		payload        map[string]any
+		gitlabStatus   int
+		claimed        release.State
+		expectedStatus int
+		expectedState  release.State
+	}{
+		{
+			name: "release to all stores",
+			seed: release.StateProductionInProgress,
+			path: "/projects/42/pipeline",
+			payload: map[string]any{
+				"type":             "view",
+				"event":            "submit",
+				"callback_id":      "release_stores",
+				"private_metadata": signReleaseInfo("release_stores", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+				"user_id":          123,
+				"data":             map[string]any{"release_notes_ru-RU": "Bug fixes"},
+			},
+			gitlabStatus:   http.StatusCreated,
+			claimed:        release.StateReleasingOtherStores,
+			expectedStatus: http.StatusOK,
+			expectedState:  release.StateReleasingOtherStores,
+		},
+		{
+			name: "release to all stores that Gitlab refuses",
+			seed: release.StateProductionInProgress,
+			path: "/projects/42/pipeline",
+			payload: map[string]any{
+				"type":             "view",
+				"event":            "submit",
+				"callback_id":      "release_stores",
+				"private_metadata": signReleaseInfo("release_stores", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+				"user_id":          123,
+				"data":             map[string]any{"release_notes_ru-RU": "Bug fixes"},
+			},
+			gitlabStatus:   http.StatusBadRequest,
+			claimed:        release.StateReleasingOtherStores,
+			expectedStatus: http.StatusInternalServerError,
+			expectedState:  release.StateProductionInProgress,
+		},
+		{
+			name: "retry",
+			seed: release.StateFailed,
+			path: "/projects/42/jobs/12400/retry",
+			payload: map[string]any{
+				"type":       "button",
+				"event":      "click",
+				"trigger_id": "550e8400-e29b-41d4-a716-446655440010",
+				"data":       "retry|" + signReleaseInfo("retry", shared.ReleaseInfo{JobID: 12400, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+				"message_id": 194275,
+				"user_id":    123,
+			},
+			gitlabStatus:   http.StatusCreated,
+			claimed:        release.StateInternal,
+			expectedStatus: http.StatusOK,
+			expectedState:  release.StateInternal,
+		},
+		{
+			name: "retry that Gitlab refuses",
+			seed: release.StateFailed,
+			path: "/projects/42/jobs/12400/retry",
+			payload: map[string]any{
+				"type":       "button",
+				"event":      "click",
+				"trigger_id": "550e8400-e29b-41d4-a716-446655440011",
+				"data":       "retry|" + signReleaseInfo("retry", shared.ReleaseInfo{JobID: 12400, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+				"message_id": 194275,
+				"user_id":    123,
+			},
+			gitlabStatus:   http.StatusForbidden,
+			claimed:        release.StateInternal,
+			expectedStatus: http.StatusInternalServerError,
+			expectedState:  release.StateFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetReplayCache()
+			seedRelease(t, 1001, tt.seed)
+			config := testConfig(t)
+			store, err := release.OpenStore(config.Release.Store, config.Release.StorePath)
+			if err != nil {
+				t.Fatalf("Failed to open release store: %v", err)
+			}
+
+			var stateAtCall release.State
+			mockGitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != tt.path {
+					t.Errorf("Unexpected path: %s", r.URL.Path)
+				}
+				if rel, err := store.Get(r.Context(), 1001); err == nil {
+					stateAtCall = rel.State
+				}
+				w.WriteHeader(tt.gitlabStatus)
+				json.NewEncoder(w).Encode(map[string]any{"id": 779})
+			}))
+			defer mockGitlab.Close()
+			config.Gitlab.URL = mockGitlab.URL
+
+			tt.payload["webhook_timestamp"] = time.Now().Unix()
+			payloadBytes, _ := json.Marshal(tt.payload)
+
+			req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+			w := httptest.NewRecorder()
+
+			HandlePachcaHook(w, req, config, mockGitlab.Client())
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if stateAtCall != tt.claimed {
+				t.Errorf("Expected release to be %q when Gitlab was called, got %q", tt.claimed, stateAtCall)
+			}
+			if state := releaseState(t, 1001); state != tt.expectedState {
+				t.Errorf("Expected release state %q, got %q", tt.expectedState, state)
+			}
+		})
+	}
+}
+
+func TestPachcaFollowsReleaseLifecycle(t *testing.T) {
+	resetReplayCache()
+
+	tests := []struct {
+		name           string
+		state          release.State
+		payload        map[string]any
+		expectedStatus int
+		expectedReply  string
+		expectedState  release.State
+	}{
+		{
+			name:  "release to all stores before promotion is rejected",
+			state: release.StateInternal,
+			payload: map[string]any{
+				"type":       "button",
+				"event":      "click",
+				"trigger_id": "lifecycle-trigger-1",
+				"data":       "release_stores|" + signReleaseInfo("release_stores", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1"}),
+				"message_id": 194275,
+				"user_id":    123,
+			},
+			expectedStatus: http.StatusOK,
+			expectedReply:  "\"Release to all stores\" is not available for release 1.0.1 (1001): the release is on the internal track.",
+			expectedState:  release.StateInternal,
+		},
+		{
+			name:  "rollout update of a release that is not in production is rejected",
+			state: release.StateInternal,
+			payload: map[string]any{
+				"type":             "view",
+				"event":            "submit",
+				"callback_id":      "update_rollout",
+				"private_metadata": signReleaseInfo("update_rollout", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+				"user_id":          123,
+				"data":             map[string]any{"rollout_percentage": "50"},
+			},
+			expectedStatus: http.StatusConflict,
+			expectedReply:  "\"Update rollout\" is not available for release 1.0.1 (1001): the release is on the internal track.",
+			expectedState:  release.StateInternal,
+		},
+		{
+			name:  "promotion of a release missing from the store is started",
+			state: release.StateNone,
+			payload: map[string]any{
+				"type":             "view",
+				"event":            "submit",
+				"callback_id":      "promote",
+				"private_metadata": signReleaseInfo("promote", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+				"user_id":          123,
+				"data":             map[string]any{"rollout_percentage": "10", "release_notes_ru-RU": "Bug fixes"},
+			},
+			expectedStatus: http.StatusOK,
+			expectedState:  release.StateNone,
+		},
+		{
+			name:  "release to all stores of a release missing from the store is rejected",
+			state: release.StateNone,
+			payload: map[string]any{
+				"type":             "view",
+				"event":            "submit",
+				"callback_id":      "release_stores",
+				"private_metadata": signReleaseInfo("release_stores", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+				"user_id":          123,
+				"data":             map[string]any{"release_notes_ru-RU": "Bug fixes"},
+			},
+			expectedStatus: http.StatusConflict,
+			expectedReply:  "\"Release to all stores\" is not available for release 1.0.1 (1001): the release is not known yet.",
+			expectedState:  release.StateNone,
+		},
+		{
+			name:  "release to all stores moves the release on",
+			state: release.StateProductionComplete,
+			payload: map[string]any{
+				"type":             "view",
+				"event":            "submit",
+				"callback_id":      "release_stores",
+				"private_metadata": signReleaseInfo("release_stores", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+				"user_id":          123,
+				"data":             map[string]any{"release_notes_ru-RU": "Bug fixes and improvements"},
+			},
+			expectedStatus: http.StatusOK,
+			expectedState:  release.StateReleasingOtherStores,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var messageCalls atomic.Int32
+
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/messages":
+					messageCalls.Add(1)
+
+					var msg pachca.MessageCreateRequest
+					json.NewDecoder(r.Body).Decode(&msg)
+					if msg.Message.EntityType != "user" || msg.Message.EntityID != 123 {
+						t.Errorf("Expected a direct message to user 123, got %s %d", msg.Message.EntityType, msg.Message.EntityID)
+					}
+					if msg.Message.Content != tt.expectedReply {
+						t.Errorf("Expected content '%s', got '%s'", tt.expectedReply, msg.Message.Content)
+					}
+					w.WriteHeader(http.StatusCreated)
+				case "/projects/42/pipeline":
+					w.WriteHeader(http.StatusCreated)
+					json.NewEncoder(w).Encode(map[string]any{"id": 1001})
+				default:
+					t.Errorf("Unexpected path: %s", r.URL.Path)
+				}
+			}))
+			defer mockServer.Close()
+
+			t.Setenv(shared.EnvPachcaUrl, mockServer.URL)
+			t.Setenv(shared.EnvGitlabUrl, mockServer.URL)
+			if tt.state != release.StateNone {
+				seedRelease(t, 1001, tt.state)
+			}
+
+			tt.payload["webhook_timestamp"] = time.Now().Unix()
+			payloadBytes, _ := json.Marshal(tt.payload)
+
+			req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+			w := httptest.NewRecorder()
+
+			HandlePachcaHook(w, req, testConfig(t), mockServer.Client())
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+			if tt.expectedReply != "" && messageCalls.Load() != 1 {
+				t.Errorf("Expected 1 reply to the user, got %d", messageCalls.Load())
+			}
+			if tt.expectedReply == "" && messageCalls.Load() != 0 {
+				t.Errorf("Expected no replies to the user, got %d", messageCalls.Load())
+			}
+			if state := releaseState(t, 1001); state != tt.expectedState {
+				t.Errorf("Expected release state %q, got %q", tt.expectedState, state)
+			}
+		})
+	}
+}
+
+func TestPachcaVerifiesSignature(t *testing.T) {
+	resetReplayCache()
+
+	tests := []struct {
+		name           string
+		body           string
+		signature      string
+		expectedStatus int
+	}{
+		{
+			name:           "valid signature",
+			body:           `{"type":"unknown","webhook_timestamp":1755075544}`,
+			signature:      "4d30962a3b4d82f0eea5cc991f0b3695579a06da51894598e0bbaa05606ee8e9",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "valid signature of a button payload with unsigned data",
+			body:           `{"type":"button","event":"click","trigger_id":"550e8400-e29b-41d4-a716-446655440000","data":"promote|{}","message_id":194275,"user_id":123,"chat_id":198,"webhook_timestamp":1755075544}`,
+			signature:      "17b056bb2fe9f1c4d32e7ddfb15cebeaf323b53556c5221bc8d71d3f397a538d",
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "tampered body",
+			body:           `{"type":"unknown","webhook_timestamp":1755075545}`,
+			signature:      "4d30962a3b4d82f0eea5cc991f0b3695579a06da51894598e0bbaa05606ee8e9",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "signature made with another secret",
+			body:           `{"type":"unknown","webhook_timestamp":1755075544}`,
+			signature:      "0000000000000000000000000000000000000000000000000000000000000000",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "malformed signature",
+			body:           `{"type":"unknown","webhook_timestamp":1755075544}`,
+			signature:      "not-a-hex-signature",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "missing signature",
+			body:           `{"type":"unknown","webhook_timestamp":1755075544}`,
+			signature:      "",
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The known payloads carry a fixed timestamp, so freshness is not checked here.
+			t.Setenv(shared.EnvPachcaWebhookMaxAge, "1000000000")
+
+			req := httptest.NewRequest("POST", "/pachca/webhook", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.signature != "" {
+				req.Header.Set("Pachca-Signature", tt.signature)
+			}
+			w := httptest.NewRecorder()
+
+			HandlePachcaHook(w, req, testConfig(t), http.DefaultClient)
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+		})
+	}
+}
+
+func TestPachcaRejectsReplayedWebhooks(t *testing.T) {
+	resetReplayCache()
+
+	t.Setenv(shared.EnvPachcaWebhookMaxAge, "60")
+
+	send := func(payload map[string]any) int {
+		payloadBytes, _ := json.Marshal(payload)
+
+		req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+		w := httptest.NewRecorder()
+
+		HandlePachcaHook(w, req, testConfig(t), http.DefaultClient)
+
+		return w.Code
+	}
+
+	t.Run("fresh webhook is accepted once", func(t *testing.T) {
+		payload := map[string]any{
+			"type":              "unknown",
+			"webhook_timestamp": time.Now().Unix(),
+		}
+
+		if code := send(payload); code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", code)
+		}
+		if code := send(payload); code != http.StatusConflict {
+			t.Errorf("Expected status 409 for replayed payload, got %d", code)
+		}
+	})
+
+	t.Run("repeated trigger_id is rejected", func(t *testing.T) {
+		first := map[string]any{
+			"type":              "button",
+			"event":             "click",
+			"trigger_id":        "replayed-trigger",
+			"data":              "promote|" + signReleaseInfo("promote", shared.ReleaseInfo{}),
+			"webhook_timestamp": time.Now().Unix(),
+		}
+		second := map[string]any{
+			"type":              "button",
+			"event":             "click",
+			"trigger_id":        "replayed-trigger",
+			"data":              "promote|" + signReleaseInfo("promote", shared.ReleaseInfo{}),
+			"user_id":           456,
+			"webhook_timestamp": time.Now().Unix(),
+		}
+
+		if code := send(first); code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", code)
+		}
+		if code := send(second); code != http.StatusConflict {
+			t.Errorf("Expected status 409 for repeated trigger_id, got %d", code)
+		}
+	})
+
+	t.Run("failed webhook can be retried", func(t *testing.T) {
+		payload := map[string]any{
+			"type":             "view",
+			"event":            "submit",
+			"callback_id":      "promote",
+			"private_metadata": signReleaseInfo("promote", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+			"user_id":          123,
+			"data": map[string]any{
+				"rollout_percentage":  "10",
+				"release_notes_ru-RU": "Bug fixes",
+			},
+			"webhook_timestamp": time.Now().Unix(),
+		}
+
+		// Gitlab cannot be reached, so the pipeline does not start.
+		if code := send(payload); code != http.StatusInternalServerError {
+			t.Errorf("Expected status 500, got %d", code)
+		}
+		if code := send(payload); code != http.StatusInternalServerError {
+			t.Errorf("Expected status 500 for retried payload, got %d", code)
+		}
+	})
+
+	t.Run("webhook that may have started a pipeline is not retried", func(t *testing.T) {
+		var pipelineCalls atomic.Int32
+		mockGitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pipelineCalls.Add(1)
+			time.Sleep(200 * time.Millisecond)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{"id": 777})
+		}))
+		defer mockGitlab.Close()
+		t.Setenv(shared.EnvGitlabUrl, mockGitlab.URL)
+
+		payload := map[string]any{
+			"type":             "view",
+			"event":            "submit",
+			"callback_id":      "promote",
+			"private_metadata": signReleaseInfo("promote", shared.ReleaseInfo{JobID: 12345, VersionCode: 1002, VersionName: "1.0.2", MessageID: 194276}),
+			"user_id":          123,
+			"data": map[string]any{
+				"rollout_percentage":  "10",
+				"release_notes_ru-RU": "Bug fixes",
+			},
+			"webhook_timestamp": time.Now().Unix(),
+		}
+		payloadBytes, _ := json.Marshal(payload)
+
+		// The call times out after Gitlab got it, so the pipeline may be running.
+		client := &http.Client{Timeout: 50 * time.Millisecond}
+		for _, expected := range []int{http.StatusInternalServerError, http.StatusConflict} {
+			req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+			req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+			w := httptest.NewRecorder()
+
+			HandlePachcaHook(w, req, testConfig(t), client)
+
+			if w.Code != expected {
+				t.Errorf("Expected status %d, got %d", expected, w.Code)
+			}
+		}
+		if pipelineCalls.Load() != 1 {
+			t.Errorf("Expected 1 call to Gitlab pipeline API, got %d", pipelineCalls.Load())
+		}
+	})
+
+	t.Run("stale webhook is rejected", func(t *testing.T) {
+		payload := map[string]any{
+			"type":              "unknown",
+			"webhook_timestamp": time.Now().Add(-2 * time.Minute).Unix(),
+		}
+
+		if code := send(payload); code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401, got %d", code)
+		}
+	})
+
+	t.Run("webhook without timestamp is rejected", func(t *testing.T) {
+		payload := map[string]any{
+			"type": "unknown",
+		}
+
+		if code := send(payload); code != http.StatusUnauthorized {
+			t.Errorf("Expected status 401, got %d", code)
+		}
+	})
+}
+
+func TestPachcaAuthorizesReleaseActions(t *testing.T) {
+	resetReplayCache()
+
+	policy := `{
+		"groups": {"release-managers": [123]},
+		"actions": {
+			"promote": {"groups": ["release-managers"]},
+			"update_rollout": {"users": [456], "groups": ["release-managers"]},
+			"halt": {"groups": ["release-managers"]}
+		}
+	}`
+
+	tests := []struct {
+		name          string
+		data          string
+		userID        int
+		state         release.State
+		expectedView  bool
+		expectedReply string
+	}{
+		{
+			name:         "group member can promote",
+			data:         "promote|" + signReleaseInfo("promote", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1"}),
+			userID:       123,
+			state:        release.StateInternal,
+			expectedView: true,
+		},
+		{
+			name:         "listed user can update rollout",
+			data:         "update_rollout|" + signReleaseInfo("update_rollout", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1"}),
+			userID:       456,
+			state:        release.StateProductionInProgress,
+			expectedView: true,
+		},
+		{
+			name:          "other user cannot promote",
+			data:          "promote|" + signReleaseInfo("promote", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1"}),
+			userID:        456,
+			state:         release.StateInternal,
+			expectedReply: "You are not allowed to use \"Promote release\" for release 1.0.1 (1001). Ask a release manager for access.",
+		},
+		{
+			name:          "other user cannot halt rollout",
+			data:          "halt|" + signReleaseInfo("halt", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1"}),
+			userID:        456,
+			state:         release.StateProductionInProgress,
+			expectedReply: "You are not allowed to use \"Halt rollout\" for release 1.0.1 (1001). Ask a release manager for access.",
+		},
+		{
+			name:          "action missing from policy is denied",
+			data:          "release_stores|" + signReleaseInfo("release_stores", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1"}),
+			userID:        123,
+			state:         release.StateProductionInProgress,
+			expectedReply: "You are not allowed to use \"Release to all stores\" for release 1.0.1 (1001). Ask a release manager for access.",
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var viewCalls atomic.Int32
+			var messageCalls atomic.Int32
+
+			mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/views/open":
+					viewCalls.Add(1)
+					w.WriteHeader(http.StatusOK)
+				case "/messages":
+					messageCalls.Add(1)
+
+					var msg struct {
+						Message struct {
+							EntityType string `json:"entity_type"`
+							EntityID   int    `json:"entity_id"`
+							Content    string `json:"content"`
+						} `json:"message"`
+					}
+					json.NewDecoder(r.Body).Decode(&msg)
+					if msg.Message.EntityType != "user" {
+						t.Errorf("Expected entity_type 'user', got '%s'", msg.Message.EntityType)
+					}
+					if msg.Message.EntityID != tt.userID {
+						t.Errorf("Expected entity_id %d, got %d", tt.userID, msg.Message.EntityID)
+					}
+					if msg.Message.Content != tt.expectedReply {
+						t.Errorf("Expected content '%s', got '%s'", tt.expectedReply, msg.Message.Content)
+					}
+					w.WriteHeader(http.StatusCreated)
+				default:
+					t.Errorf("Unexpected path: %s", r.URL.Path)
+				}
+			}))
+			defer mockPachca.Close()
+
+			t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+			seedRelease(t, 1001, tt.state)
+			t.Setenv(shared.EnvReleasePolicy, policy)
+
+			pachcaPayload := map[string]any{
+				"type":              "button",
+				"event":             "click",
+				"trigger_id":        fmt.Sprintf("authorization-trigger-%d", i),
+				"data":              tt.data,
+				"message_id":        194275,
+				"user_id":           tt.userID,
+				"chat_id":           198,
+				"webhook_timestamp": time.Now().Unix(),
+			}
+			payloadBytes, _ := json.Marshal(pachcaPayload)
+
+			req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+			w := httptest.NewRecorder()
+
+			HandlePachcaHook(w, req, testConfig(t), mockPachca.Client())
+
+			if w.Code != http.StatusOK {
+				t.Errorf("Expected status 200, got %d", w.Code)
+			}
+			if tt.expectedView && viewCalls.Load() != 1 {
+				t.Errorf("Expected 1 call to Pachca view API, got %d", viewCalls.Load())
+			}
+			if !tt.expectedView && viewCalls.Load() != 0 {
+				t.Errorf("Expected no calls to Pachca view API, got %d", viewCalls.Load())
+			}
+			if tt.expectedReply != "" && messageCalls.Load() != 1 {
+				t.Errorf("Expected 1 reply to the user, got %d", messageCalls.Load())
+			}
+		})
+	}
+
+	t.Run("form submitted by other user is rejected", func(t *testing.T) {
+		mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/messages" {
+				t.Errorf("Unexpected path: %s", r.URL.Path)
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))
+		defer mockPachca.Close()
+
+		t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+		seedRelease(t, 1001, release.StateInternal)
+		t.Setenv(shared.EnvReleasePolicy, policy)
+
+		submitPayload := map[string]any{
+			"type":             "view",
+			"event":            "submit",
+			"callback_id":      "promote",
+			"private_metadata": signReleaseInfo("promote", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+			"user_id":          789,
+			"data": map[string]any{
+				"rollout_percentage":  "25",
+				"release_notes_ru-RU": "Bug fixes and improvements",
+			},
+			"webhook_timestamp": time.Now().Unix(),
+		}
+		payloadBytes, _ := json.Marshal(submitPayload)
+
+		req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+		w := httptest.NewRecorder()
+
+		HandlePachcaHook(w, req, testConfig(t), mockPachca.Client())
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status 403, got %d", w.Code)
+		}
+	})
+}
+
+func TestPachcaRejectsTamperedReleaseInfo(t *testing.T) {
+	resetReplayCache()
+
+	validInfo := signReleaseInfo("promote", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275})
+	tamperedInfo := strings.Replace(validInfo, "12345", "99999", 1)
+	expiredInfo, _ := shared.SignReleaseInfo("test-release-key", "promote", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1"}, time.Now().Add(-time.Minute))
+	foreignInfo, _ := shared.SignReleaseInfo("another-release-key", "promote", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1"}, time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name    string
+		payload map[string]any
+	}{
+		{
+			name: "tampered button data",
+			payload: map[string]any{
+				"type":       "button",
+				"event":      "click",
+				"trigger_id": "tampered-button",
+				"data":       "promote|" + tamperedInfo,
+			},
+		},
+		{
+			name: "expired button data",
+			payload: map[string]any{
+				"type":       "button",
+				"event":      "click",
+				"trigger_id": "expired-button",
+				"data":       "promote|" + expiredInfo,
+			},
+		},
+		{
+			name: "button data signed with another key",
+			payload: map[string]any{
+				"type":       "button",
+				"event":      "click",
+				"trigger_id": "foreign-button",
+				"data":       "promote|" + foreignInfo,
+			},
+		},
+		{
+			name: "button data signed for another action",
+			payload: map[string]any{
+				"type":       "button",
+				"event":      "click",
+				"trigger_id": "swapped-button",
+				"data":       "release_stores|" + validInfo,
+			},
+		},
+		{
+			name: "unsigned private_metadata",
+			payload: map[string]any{
+				"type":             "view",
+				"event":            "submit",
+				"callback_id":      "promote",
+				"private_metadata": "{\"job_id\":12345,\"version_code\":1001,\"version_name\":\"1.0.1\"}",
+				"data": map[string]any{
+					"rollout_percentage":  "25",
+					"release_notes_ru-RU": "Bug fixes",
+				},
+			},
+		},
+		{
+			name: "tampered private_metadata",
+			payload: map[string]any{
+				"type":             "view",
+				"event":            "submit",
+				"callback_id":      "promote",
+				"private_metadata": tamperedInfo,
+				"data": map[string]any{
+					"rollout_percentage":  "25",
+					"release_notes_ru-RU": "Bug fixes",
+				},
+			},
+		},
+		{
+			name: "private_metadata signed for another form",
+			payload: map[string]any{
+				"type":             "view",
+				"event":            "submit",
+				"callback_id":      "release_stores",
+				"private_metadata": validInfo,
+				"data": map[string]any{
+					"release_notes_ru-RU": "Bug fixes",
+				},
+			},
+		},
+		{
+			name: "expired private_metadata",
+			payload: map[string]any{
+				"type":             "view",
+				"event":            "submit",
+				"callback_id":      "promote",
+				"private_metadata": expiredInfo,
+				"data": map[string]any{
+					"rollout_percentage":  "25",
+					"release_notes_ru-RU": "Bug fixes",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				t.Errorf("Unexpected call: %s %s", r.Method, r.URL.Path)
+			}))
+			defer mockServer.Close()
+
+			t.Setenv(shared.EnvPachcaUrl, mockServer.URL)
+			t.Setenv(shared.EnvGitlabUrl, mockServer.URL)
+
+			tt.payload["user_id"] = 123
+			tt.payload["webhook_timestamp"] = time.Now().Unix()
+			payloadBytes, _ := json.Marshal(tt.payload)
+
+			req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+			w := httptest.NewRecorder()
+
+			HandlePachcaHook(w, req, testConfig(t), mockServer.Client())
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Expected status 400, got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestPachcaQueuesFormSubmit(t *testing.T) {
+	resetReplayCache()
+
+	var pipelineCalls atomic.Int32
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/projects/42/pipeline":
+			pipelineCalls.Add(1)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{"id": 777})
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	queuePath := filepath.Join(t.TempDir(), "queue.json")
+
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+	t.Setenv(shared.EnvGitlabUrl, mockPachca.URL)
+	t.Setenv(shared.EnvQueueStore, "file")
+	t.Setenv(shared.EnvQueuePath, queuePath)
+	seedRelease(t, 1001, release.StateProductionInProgress)
+
+	submitPayload := map[string]any{
+		"type":             "view",
+		"event":            "submit",
+		"callback_id":      "release_stores",
+		"private_metadata": signReleaseInfo("release_stores", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+		"user_id":          123,
+		"data": map[string]any{
+			"release_notes_ru-RU": "Bug fixes and improvements",
+		},
+		"webhook_timestamp": time.Now().Unix(),
+	}
+	payloadBytes, _ := json.Marshal(submitPayload)
+
+	req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+	w := httptest.NewRecorder()
+
+	config := testConfig(t)
+	HandlePachcaHook(w, req, config, mockPachca.Client())
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if pipelineCalls.Load() != 0 {
+		t.Errorf("Expected no calls to Gitlab pipeline API before the job runs, got %d", pipelineCalls.Load())
+	}
+
+	jobs, _ := queue.Open(queue.StoreFile, queuePath)
+	job, err := jobs.Claim(context.Background(), time.Now(), time.Minute)
+	if err != nil {
+		t.Fatalf("Expected queued job, got %v", err)
+	}
+
+	if err := ProcessPachcaJob(context.Background(), config, mockPachca.Client(), job.Payload); err != nil {
+		t.Fatalf("Expected job to be processed, got %v", err)
+	}
+	if pipelineCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Gitlab pipeline API, got %d", pipelineCalls.Load())
+	}
+	if state := releaseState(t, 1001); state != release.StateReleasingOtherStores {
+		t.Errorf("Expected state %s, got %s", release.StateReleasingOtherStores, state)
+	}
+}
+
+func TestPachcaDoesNotRepeatStartedPipelineJob(t *testing.T) {
+	var pipelineCalls atomic.Int32
+
+	mockGitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pipelineCalls.Add(1)
+		// Gitlab accepts the pipeline after the lease of the job has run out.
+		time.Sleep(200 * time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"id": 777})
+	}))
+	defer mockGitlab.Close()
+
+	t.Setenv(shared.EnvGitlabUrl, mockGitlab.URL)
+	t.Setenv(shared.EnvQueueStore, "file")
+	t.Setenv(shared.EnvQueuePath, filepath.Join(t.TempDir(), "queue.json"))
+	seedRelease(t, 1001, release.StateInternal)
+	config := testConfig(t)
+
+	job := PachcaJob{
+		Type:        jobPipeline,
+		UserID:      123,
+		Action:      "promote",
+		ReleaseInfo: &shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275},
+	}
+	if err := enqueueJob(context.Background(), config, job); err != nil {
+		t.Fatalf("Failed to queue job: %v", err)
+	}
+
+	jobs, _ := queue.Open(config.Queue.Store, config.Queue.Path)
+	worker := &queue.Worker{
+		Queue: jobs,
+		Handlers: map[string]queue.Handler{
+			JobKind: func(ctx context.Context, payload []byte) error {
+				return ProcessPachcaJob(ctx, config, mockGitlab.Client(), payload)
+			},
+		},
+		MaxAttempts: 8,
+		Lease:       50 * time.Millisecond,
+	}
+
+	if processed, err := worker.RunOnce(context.Background()); !processed || err != nil {
+		t.Fatalf("Expected job to be processed, got %v, %v", processed, err)
+	}
+	if processed, _ := worker.RunOnce(context.Background()); processed {
+		t.Error("Expected the job not to be retried")
+	}
+
+	dead, err := jobs.DeadLetters(context.Background())
+	if err != nil || len(dead) != 1 {
+		t.Errorf("Expected 1 dead letter, got %d, %v", len(dead), err)
+	}
+	if pipelineCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Gitlab pipeline API, got %d", pipelineCalls.Load())
+	}
+}
+
+func TestPachcaOpensViewsWithinRequestWithQueue(t *testing.T) {
+	resetReplayCache()
+
+	var viewCalls atomic.Int32
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/views/open":
+			viewCalls.Add(1)
+			var viewReq pachca.ViewRequest
+			json.NewDecoder(r.Body).Decode(&viewReq)
+			if viewReq.TriggerID != "queue-trigger" {
+				t.Errorf("Expected trigger_id 'queue-trigger', got '%s'", viewReq.TriggerID)
+			}
+			w.WriteHeader(http.StatusCreated)
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	queuePath := filepath.Join(t.TempDir(), "queue.json")
+
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+	t.Setenv(shared.EnvGitlabUrl, mockPachca.URL)
+	t.Setenv(shared.EnvQueueStore, "file")
+	t.Setenv(shared.EnvQueuePath, queuePath)
+	seedRelease(t, 1001, release.StateInternal)
+
+	clickPayload := map[string]any{
+		"type":              "button",
+		"event":             "click",
+		"trigger_id":        "queue-trigger",
+		"data":              "promote|" + signReleaseInfo("promote", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1"}),
+		"message_id":        194275,
+		"user_id":           123,
+		"webhook_timestamp": time.Now().Unix(),
+	}
+	payloadBytes, _ := json.Marshal(clickPayload)
+
+	req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+	w := httptest.NewRecorder()
+
+	HandlePachcaHook(w, req, testConfig(t), mockPachca.Client())
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if viewCalls.Load() != 1 {
+		t.Errorf("Expected 1 call to Pachca views API within the request, got %d", viewCalls.Load())
+	}
+
+	jobs, _ := queue.Open(queue.StoreFile, queuePath)
+	if job, err := jobs.Claim(context.Background(), time.Now(), time.Minute); !errors.Is(err, queue.ErrEmpty) {
+		t.Errorf("Expected no queued job, got %+v, %v", job, err)
+	}
+}
+
+func TestPachcaCarriesTraceInPipelineVariables(t *testing.T) {
+	resetReplayCache()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	var traceparent string
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/projects/42/pipeline":
+			var pipelineRequest gitlab.PipelineRequest
+			json.NewDecoder(r.Body).Decode(&pipelineRequest)
+			for _, variable := range pipelineRequest.Variables {
+				if variable.Key == tracing.TraceparentVariable {
+					traceparent = variable.Value
+				}
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{"id": 777})
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+	t.Setenv(shared.EnvGitlabUrl, mockPachca.URL)
+	seedRelease(t, 1001, release.StateProductionInProgress)
+
+	submitPayload := map[string]any{
+		"type":             "view",
+		"event":            "submit",
+		"callback_id":      "release_stores",
+		"private_metadata": signReleaseInfo("release_stores", shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+		"user_id":          123,
+		"data": map[string]any{
+			"release_notes_ru-RU": "Bug fixes and improvements",
+		},
+		"webhook_timestamp": time.Now().Unix(),
+	}
+	payloadBytes, _ := json.Marshal(submitPayload)
+
+	req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+
+	HandlePachcaHook(w, req, testConfig(t), mockPachca.Client())
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+	if !strings.HasPrefix(traceparent, "00-"+traceID+"-") {
+		t.Errorf("Expected %s variable in trace %s, got %q", tracing.TraceparentVariable, traceID, traceparent)
+	}
+}
+
+func TestPachcaRecordsAuditLog(t *testing.T) {
+	resetReplayCache()
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/projects/42/pipeline":
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{"id": 777})
+		case "/messages":
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"id": 1}})
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+	t.Setenv(shared.EnvGitlabUrl, mockPachca.URL)
+	t.Setenv(shared.EnvAuditStore, audit.StoreFile)
+	t.Setenv(shared.EnvAuditPath, auditPath)
+	seedRelease(t, 1001, release.StateInternal)
+
+	config := testConfig(t)
+	submit := func(callbackID string, data map[string]any) {
+		submitPayload := map[string]any{
+			"type":              "view",
+			"event":             "submit",
+			"callback_id":       callbackID,
+			"private_metadata":  signReleaseInfo(callbackID, shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}),
+			"user_id":           123,
+			"data":              data,
+			"webhook_timestamp": time.Now().Unix(),
+		}
+		payloadBytes, _ := json.Marshal(submitPayload)
+
+		req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+		HandlePachcaHook(httptest.NewRecorder(), req, config, mockPachca.Client())
+	}
+
+	promoted := map[string]string{"source": "pachca", "type": "view_submit", "action": "promote", "outcome": "ok"}
+	rejected := map[string]string{"source": "pachca", "type": "view_submit", "action": "update_rollout", "outcome": "conflict"}
+	promotedBefore, rejectedBefore := webhookCount(t, promoted), webhookCount(t, rejected)
+
+	submit("promote", map[string]any{"rollout_percentage": "10", "release_notes_ru-RU": "Bug fixes"})
+	// The release stays on the internal track until the promotion pipeline reports back.
+	submit("update_rollout", map[string]any{"rollout_percentage": "20"})
+
+	if count := webhookCount(t, promoted) - promotedBefore; count != 1 {
+		t.Errorf("Expected 1 promotion counted, got %v", count)
+	}
+	if count := webhookCount(t, rejected) - rejectedBefore; count != 1 {
+		t.Errorf("Expected 1 rejected rollout update counted, got %v", count)
+	}
+
+	auditLog, _ := audit.Open(audit.StoreFile, auditPath)
+	entries, err := auditLog.Query(context.Background(), audit.Filter{VersionCode: 1001, UserID: 123})
+	if err != nil {
+		t.Fatalf("Expected audit entries, got %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 audit entries, got %+v", entries)
+	}
+
+	started := entries[0]
+	if started.Action != shared.ActionPromote || started.Outcome != audit.OutcomeStarted || started.PipelineID != 777 {
+		t.Errorf("Expected started promotion with pipeline 777, got %+v", started)
+	}
+	if started.Form["rollout_percentage"] != "10" || started.Form["release_notes_ru-RU"] != "Bug fixes" || started.ReleaseInfo.JobID != 12345 {
+		t.Errorf("Expected form data and release info, got %+v", started)
+	}
+	if rejected := entries[1]; rejected.Action != shared.ActionUpdateRollout || rejected.Outcome != audit.OutcomeRejected {
+		t.Errorf("Expected rejected rollout update, got %+v", rejected)
+	}
+}
+
+func TestPachcaAsksReleaseNotesPerLocale(t *testing.T) {
+	resetReplayCache()
+
+	var variables map[string]string
+	var blocks []pachca.ViewBlock
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/views/open":
+			var viewReq pachca.ViewRequest
+			json.NewDecoder(r.Body).Decode(&viewReq)
+			blocks = viewReq.View.Blocks
+			w.WriteHeader(http.StatusCreated)
+		case "/projects/42/pipeline":
+			var pipelineReq gitlab.PipelineRequest
+			json.NewDecoder(r.Body).Decode(&pipelineReq)
+			variables = make(map[string]string)
+			for _, v := range pipelineReq.Variables {
+				variables[v.Key] = v.Value
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{"id": 777})
+		case "/messages":
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"id": 1}})
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	t.Setenv(shared.EnvPachcaUrl, mockPachca.URL)
+	t.Setenv(shared.EnvGitlabUrl, mockPachca.URL)
+	t.Setenv(shared.EnvReleaseNotesLocales, "ru-RU,en-US")
+	t.Setenv(shared.EnvReleaseNotesPlayMaxLength, "500")
+	t.Setenv(shared.EnvReleaseNotesOtherStoresMaxLength, "20")
+	seedRelease(t, 1001, release.StateInternal)
+
+	config := testConfig(t)
+	releaseInfo := shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1", MessageID: 194275}
+	post := func(payload map[string]any) *httptest.ResponseRecorder {
+		payload["user_id"] = 123
+		payload["webhook_timestamp"] = time.Now().Unix()
+		payloadBytes, _ := json.Marshal(payload)
+
+		req := httptest.NewRequest("POST", "/pachca/webhook", bytes.NewReader(payloadBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Pachca-Signature", signPayload(payloadBytes))
+		w := httptest.NewRecorder()
+		HandlePachcaHook(w, req, config, mockPachca.Client())
+		return w
+	}
+
+	post(map[string]any{"type": "button", "event": "click", "trigger_id": "trigger", "data": "promote|" + signReleaseInfo("promote", releaseInfo)})
+	if len(blocks) != 4 {
+		t.Fatalf("Expected header, rollout and 2 release notes blocks, got %+v", blocks)
+	}
+	for i, locale := range []string{"ru-RU", "en-US"} {
+		block := blocks[2+i]
+		if block.Name != "release_notes_"+locale || block.Label != "Release notes ("+locale+")" || block.MaxLength != 500 {
+			t.Errorf("Expected release notes input for %s, got %+v", locale, block)
+		}
+	}
+
+	// 400 characters of Cyrillic take 800 bytes, which is still within the limit.
+	russian := strings.Repeat("ю", 400)
+	w := post(map[string]any{
+		"type":             "view",
+		"event":            "submit",
+		"callback_id":      "promote",
+		"private_metadata": signReleaseInfo("promote", releaseInfo),
+		"data": map[string]any{
+			"rollout_percentage":  "10",
+			"release_notes_ru-RU": russian,
+			"release_notes_en-US": "Bug fixes",
+		},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	expected := map[string]string{
+		"RELEASE_NOTES":         russian,
+		"RELEASE_NOTES_LOCALES": "ru-RU,en-US",
+		"RELEASE_NOTES_RU_RU":   russian,
+		"RELEASE_NOTES_EN_US":   "Bug fixes",
+	}
+	for key, value := range expected {
+		if variables[key] != value {
+			t.Errorf("Expected variable %s %q, got %q", key, value, variables[key])
+		}
+	}
+
+	// The other stores have a limit of their own.
+	seedRelease(t, 1002, release.StateProductionComplete)
+	w = post(map[string]any{
+		"type":             "view",
+		"event":            "submit",
+		"callback_id":      "release_stores",
+		"private_metadata": signReleaseInfo("release_stores", shared.ReleaseInfo{JobID: 12346, VersionCode: 1002, VersionName: "1.0.2", MessageID: 194276}),
+		"data": map[string]any{
+			"release_notes_ru-RU": strings.Repeat("ю", 21),
+		},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", w.Code)
+	}
+	var resp FormValidationErrorsResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Errors["release_notes_ru-RU"] != "Release notes (ru-RU) must be 20 characters or less" {
+		t.Errorf("Expected ru-RU length error, got '%s'", resp.Errors["release_notes_ru-RU"])
+	}
+	if resp.Errors["release_notes_en-US"] != "Release notes (en-US) are required" {
+		t.Errorf("Expected en-US required error, got '%s'", resp.Errors["release_notes_en-US"])
+	}
+}
+
+func signReleaseInfo(action string, releaseInfo shared.ReleaseInfo) string {
+	signed, _ := shared.SignReleaseInfo("test-release-key", action, releaseInfo, time.Now().Add(time.Hour))
+	return signed
+}
+
+func verifyPrivateMetadata(t *testing.T, callbackID string, privateMetadata string) shared.ReleaseInfo {
+	t.Helper()
+
+	releaseInfo, err := shared.VerifyReleaseInfo("test-release-key", callbackID, privateMetadata, time.Now())
+	if err != nil {
+		t.Errorf("Failed to verify private_metadata '%s': %v", privateMetadata, err)
+		return shared.ReleaseInfo{}
+	}
+
+	return *releaseInfo
+}
+
+// testConfig loads the configuration from the environment set up by the test, filling in
+// the required settings the test left out. Releases go to a file store of the test.
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+
+	defaults := map[string]string{
+		shared.EnvPachcaUrl:            "http://pachca.invalid",
+		shared.EnvPachcaKey:            "test-api-key",
+		shared.EnvPachcaSigningSecret:  "test-signing-secret",
+		shared.EnvPachcaInternalChatId: "198",
+		shared.EnvGitlabUrl:            "http://gitlab.invalid",
+		shared.EnvGitlabKey:            "test-gitlab-key",
+		shared.EnvGitlabProjectId:      "42",
+		shared.EnvGitlabRef:            "release",
+		shared.EnvGitlabWebhookToken:   "test-webhook-token",
+		shared.EnvReleaseSigningKey:    "test-release-key",
+		shared.EnvReleaseStore:         release.StoreFile,
+		shared.EnvAuditStore:           audit.StoreMemory,
+	}
+	for key, value := range defaults {
+		if os.Getenv(key) == "" {
+			t.Setenv(key, value)
+		}
+	}
+	if os.Getenv(shared.EnvReleaseStorePath) == "" {
+		t.Setenv(shared.EnvReleaseStorePath, filepath.Join(t.TempDir(), "releases.json"))
+	}
+
+	config, err := config.Load("")
+	if err != nil {
+		t.Fatalf("Config error: %v", err)
+	}
+
+	return config
+}
+
+// seedRelease saves a release in the given state to the store configured by the test.
+func seedRelease(t *testing.T, versionCode int, state release.State) {
+	t.Helper()
+
+	config := testConfig(t)
+	store, err := release.OpenStore(config.Release.Store, config.Release.StorePath)
+	if err != nil {
+		t.Fatalf("Failed to open release store: %v", err)
+	}
+
+	_, err = store.Update(context.Background(), versionCode, func(r *release.Release) error {
+		r.VersionName = "1.0.1"
+		r.MessageID = 194275
+		r.State = state
+		if state == release.StateFailed {
+			r.FailedFrom = release.StateInternal
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to seed release: %v", err)
+	}
+}
+
+func releaseState(t *testing.T, versionCode int) release.State {
+	t.Helper()
+
+	config := testConfig(t)
+	store, err := release.OpenStore(config.Release.Store, config.Release.StorePath)
+	if err != nil {
+		t.Fatalf("Failed to open release store: %v", err)
+	}
+
+	r, err := store.Get(context.Background(), versionCode)
+	if errors.Is(err, release.ErrNotFound) {
+		return release.StateNone
+	}
+	if err != nil {
+		t.Fatalf("Failed to read release: %v", err)
+	}
+
+	return r.State
+}
+
+func resetReplayCache() {
+	replayCache = shared.NewReplayCache()
+}
+
+func signPayload(body []byte) string {
+	mac := hmac.New(sha256.New, []byte("test-signing-secret"))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookCount reads release_bot_webhooks_total for the labels, an empty value for those left out.
+func webhookCount(t *testing.T, labels map[string]string) float64 {
+	t.Helper()
+
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "release_bot_webhooks_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			matched := 0
+			for _, label := range metric.GetLabel() {
+				if labels[label.GetName()] == label.GetValue() {
+					matched++
+				}
+			}
+			if matched == len(metric.GetLabel()) {
+				return metric.GetCounter().GetValue()
+			}
+		}
+	}
 
+	return 0
 }
@@ -0,0 +1,120 @@
+// Package audit keeps an append-only trail of the release actions people start from Pachca:
+// who asked for what, for which version, with which form data, and what came of it.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"pachca.com/android-deployment/shared"
+)
+
+// Outcomes of a release action.
+const (
+	// OutcomeStarted means the Gitlab pipeline or job of the action was started.
+	OutcomeStarted string = "started"
+	// OutcomeFailed means starting the action failed; a queued action may be tried again.
+	OutcomeFailed string = "failed"
+	// OutcomeNotAllowed means the release policy does not let the user run the action.
+	OutcomeNotAllowed string = "not_allowed"
+	// OutcomeRejected means the release lifecycle does not allow the action in the current state.
+	OutcomeRejected string = "rejected"
+	// OutcomeSucceeded means the Gitlab pipeline of the action reported success.
+	OutcomeSucceeded string = "succeeded"
+	// OutcomeJobFailed means a job of the Gitlab pipeline of the action failed.
+	OutcomeJobFailed string = "job_failed"
+)
+
+// Entry is a release action and its outcome.
+type Entry struct {
+	ID          int64              `json:"id"`
+	At          time.Time          `json:"at"`
+	UserID      int                `json:"user_id"`
+	Action      string             `json:"action"`
+	ReleaseInfo shared.ReleaseInfo `json:"release_info"`
+	Form        map[string]string  `json:"form,omitempty"`
+	PipelineID  int                `json:"pipeline_id,omitempty"`
+	// JobID is the Gitlab job the action started, such as the retry of a failed job.
+	JobID   int    `json:"job_id,omitempty"`
+	Outcome string `json:"outcome"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Filter selects entries by version and user. Zero fields match every entry.
+type Filter struct {
+	VersionCode int
+	UserID      int
+}
+
+func (f Filter) matches(entry *Entry) bool {
+	return (f.VersionCode == 0 || entry.ReleaseInfo.VersionCode == f.VersionCode) &&
+		(f.UserID == 0 || entry.UserID == f.UserID)
+}
+
+// Log stores entries. Entries are never changed or removed once appended.
+type Log interface {
+	// Append numbers the entry and saves it.
+	Append(ctx context.Context, entry *Entry) error
+	// Query returns the entries that match the filter, oldest first.
+	Query(ctx context.Context, filter Filter) ([]Entry, error)
+	Close() error
+}
+
+// Log kinds selectable by configuration.
+const (
+	StoreMemory string = "memory"
+	StoreFile   string = "file"
+	StoreSQLite string = "sqlite"
+)
+
+var (
+	logsMu sync.Mutex
+	logs   = make(map[string]Log)
+)
+
+// Open returns the log of the given kind at path. Like release stores, logs are opened once per process.
+func Open(kind string, path string) (Log, error) {
+	if kind == "" {
+		kind = StoreMemory
+	}
+
+	logsMu.Lock()
+	defer logsMu.Unlock()
+
+	key := kind + ":" + path
+	if log, ok := logs[key]; ok {
+		return log, nil
+	}
+
+	var log Log
+	var err error
+	switch kind {
+	case StoreMemory:
+		log = NewMemoryLog()
+	case StoreFile:
+		log, err = NewFileLog(path)
+	case StoreSQLite:
+		log, err = NewSQLiteLog(path)
+	default:
+		return nil, fmt.Errorf("unknown audit store %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logs[key] = log
+	return log, nil
+}
+
+func clone(entry Entry) Entry {
+	if entry.Form != nil {
+		form := make(map[string]string, len(entry.Form))
+		for key, value := range entry.Form {
+			form[key] = value
+		}
+		entry.Form = form
+	}
+	return entry
+}
@@ -0,0 +1,168 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"pachca.com/android-deployment/shared"
+)
+
+func TestLogs(t *testing.T) {
+	tests := []struct {
+		name string
+		open func(t *testing.T, path string) Log
+	}{
+		{
+			name: "memory",
+			open: func(t *testing.T, path string) Log { return NewMemoryLog() },
+		},
+		{
+			name: "file",
+			open: func(t *testing.T, path string) Log {
+				log, err := NewFileLog(filepath.Join(path, "audit.jsonl"))
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				return log
+			},
+		},
+		{
+			name: "sqlite",
+			open: func(t *testing.T, path string) Log {
+				log, err := NewSQLiteLog(filepath.Join(path, "audit.db"))
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				return log
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			log := tt.open(t, t.TempDir())
+			defer log.Close()
+
+			now := time.Unix(1755075544, 0).UTC()
+			entries := []Entry{
+				{At: now, UserID: 123, Action: shared.ActionPromote, ReleaseInfo: shared.ReleaseInfo{JobID: 100, VersionCode: 1001, VersionName: "1.0.1"},
+					Form: map[string]string{"rollout_percentage": "10", "release_notes": "Fixes"}, PipelineID: 777, Outcome: OutcomeStarted},
+				{At: now, UserID: 456, Action: shared.ActionUpdateRollout, ReleaseInfo: shared.ReleaseInfo{VersionCode: 1001}, Outcome: OutcomeNotAllowed},
+				{At: now, UserID: 123, Action: shared.ActionRetry, ReleaseInfo: shared.ReleaseInfo{JobID: 200, VersionCode: 1002}, JobID: 201, Outcome: OutcomeStarted},
+			}
+			for i := range entries {
+				if err := log.Append(ctx, &entries[i]); err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if entries[i].ID != int64(i+1) {
+					t.Errorf("Expected entry ID %d, got %d", i+1, entries[i].ID)
+				}
+			}
+
+			all, err := log.Query(ctx, Filter{})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(all) != 3 {
+				t.Fatalf("Expected 3 entries, got %d", len(all))
+			}
+			if all[0].Form["release_notes"] != "Fixes" || all[0].PipelineID != 777 || !all[0].At.Equal(now) {
+				t.Errorf("Unexpected first entry: %+v", all[0])
+			}
+
+			byVersion, err := log.Query(ctx, Filter{VersionCode: 1001})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(byVersion) != 2 || byVersion[0].ID != 1 || byVersion[1].ID != 2 {
+				t.Errorf("Expected entries 1 and 2 for version 1001, got %+v", byVersion)
+			}
+
+			byUser, err := log.Query(ctx, Filter{UserID: 123, VersionCode: 1002})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(byUser) != 1 || byUser[0].JobID != 201 {
+				t.Errorf("Expected retry of user 123, got %+v", byUser)
+			}
+
+			// Entries returned by a query do not change the log.
+			all[0].Form["release_notes"] = "Changed"
+			again, _ := log.Query(ctx, Filter{})
+			if again[0].Form["release_notes"] != "Fixes" {
+				t.Errorf("Expected stored entry to stay unchanged, got %+v", again[0])
+			}
+		})
+	}
+}
+
+func TestSQLiteLogRejectsChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.db")
+	log, err := NewSQLiteLog(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer log.Close()
+
+	if err := log.Append(context.Background(), &Entry{UserID: 123, Action: shared.ActionPromote, Outcome: OutcomeStarted}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer db.Close()
+
+	if _, err := db.Exec(`UPDATE audit_log SET user_id = 456`); err == nil {
+		t.Error("Expected update to be rejected")
+	}
+	if _, err := db.Exec(`DELETE FROM audit_log`); err == nil {
+		t.Error("Expected delete to be rejected")
+	}
+}
+
+func TestFileLogsShareFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	// Each FileLog stands for a process: they share only the file.
+	logs := make([]*FileLog, 4)
+	for i := range logs {
+		log, err := NewFileLog(path)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		logs[i] = log
+	}
+
+	const entries = 20
+	var wg sync.WaitGroup
+	for i := range entries {
+		wg.Go(func() {
+			entry := &Entry{UserID: i, Action: shared.ActionPromote, Outcome: OutcomeStarted}
+			if err := logs[i%len(logs)].Append(ctx, entry); err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	all, err := logs[0].Query(ctx, Filter{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(all) != entries {
+		t.Fatalf("Expected %d entries, got %d", entries, len(all))
+	}
+	for i, entry := range all {
+		if entry.ID != int64(i+1) {
+			t.Errorf("Expected entry %d to have ID %d, got %d", i, i+1, entry.ID)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"pachca.com/android-deployment/filelock"
+)
+
+// FileLog writes one JSON entry per line and only ever appends to the file. Appends hold
+// a lock on the file, so that processes sharing it never give two entries the same ID.
+type FileLog struct {
+	mu   sync.Mutex
+	path string
+	// count and size are the entries and bytes of the file as of the last append,
+	// so that the next one only reads what other processes appended since.
+	count int64
+	size  int64
+}
+
+func NewFileLog(path string) (*FileLog, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file audit store needs a path")
+	}
+
+	l := &FileLog{path: path}
+	if _, err := l.load(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *FileLog) Append(ctx context.Context, entry *Entry) (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	unlock, err := filelock.Lock(l.path)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, unlock()) }()
+
+	if err := l.catchUp(); err != nil {
+		return err
+	}
+
+	entry.ID = l.count + 1
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	l.count++
+	l.size += int64(len(line)) + 1
+	return nil
+}
+
+// catchUp counts the entries appended after the last known size of the file.
+func (l *FileLog) catchUp() error {
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(l.size, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		l.size += int64(len(line))
+		if len(line) > 1 {
+			l.count++
+		}
+	}
+}
+
+func (l *FileLog) Query(ctx context.Context, filter Filter) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries, err := l.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []Entry
+	for i := range entries {
+		if filter.matches(&entries[i]) {
+			matched = append(matched, entries[i])
+		}
+	}
+	return matched, nil
+}
+
+func (l *FileLog) Close() error {
+	return nil
+}
+
+// load reads the file on every call, so that several processes sharing it see each other's entries.
+func (l *FileLog) load() ([]Entry, error) {
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("invalid audit log %s at line %d: %w", l.path, line, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
@@ -0,0 +1,42 @@
+package audit
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryLog keeps entries for the lifetime of the process.
+type MemoryLog struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func NewMemoryLog() *MemoryLog {
+	return &MemoryLog{}
+}
+
+func (l *MemoryLog) Append(ctx context.Context, entry *Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry.ID = int64(len(l.entries)) + 1
+	l.entries = append(l.entries, clone(*entry))
+	return nil
+}
+
+func (l *MemoryLog) Query(ctx context.Context, filter Filter) ([]Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var entries []Entry
+	for i := range l.entries {
+		if filter.matches(&l.entries[i]) {
+			entries = append(entries, clone(l.entries[i]))
+		}
+	}
+	return entries, nil
+}
+
+func (l *MemoryLog) Close() error {
+	return nil
+}
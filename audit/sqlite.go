@@ -0,0 +1,111 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteLog keeps entries as rows indexed by version and user. Triggers reject
+// updates and deletes, so that the log stays append-only.
+type SQLiteLog struct {
+	db *sql.DB
+}
+
+func NewSQLiteLog(path string) (*SQLiteLog, error) {
+	if path == "" {
+		return nil, fmt.Errorf("sqlite audit store needs a path")
+	}
+
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY,
+		at INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		version_code INTEGER NOT NULL,
+		data TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS audit_log_version_code ON audit_log (version_code);
+	CREATE INDEX IF NOT EXISTS audit_log_user_id ON audit_log (user_id);
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END;
+	CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+	BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteLog{db: db}, nil
+}
+
+func (l *SQLiteLog) Append(ctx context.Context, entry *Entry) error {
+	tx, err := l.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The ID is part of the document, so the row is numbered before the document is written.
+	var id int64
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) + 1 FROM audit_log`).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	entry.ID = id
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO audit_log (id, at, user_id, version_code, data) VALUES (?, ?, ?, ?, ?)`,
+		id, entry.At.UnixNano(), entry.UserID, entry.ReleaseInfo.VersionCode, string(data),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (l *SQLiteLog) Query(ctx context.Context, filter Filter) ([]Entry, error) {
+	rows, err := l.db.QueryContext(ctx,
+		`SELECT data FROM audit_log
+		WHERE (? = 0 OR version_code = ?) AND (? = 0 OR user_id = ?)
+		ORDER BY id`,
+		filter.VersionCode, filter.VersionCode, filter.UserID, filter.UserID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var entry Entry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (l *SQLiteLog) Close() error {
+	return l.db.Close()
+}
@@ -0,0 +1,55 @@
+// Command audit prints the audit log of release actions as JSON lines, oldest first.
+// It reads the same configuration as the server:
+//
+//	go run ./cmd/audit -version 1001
+//	go run ./cmd/audit -user 123
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"pachca.com/android-deployment/audit"
+	"pachca.com/android-deployment/config"
+)
+
+func main() {
+	var filter audit.Filter
+	flag.IntVar(&filter.VersionCode, "version", 0, "only actions on this versionCode")
+	flag.IntVar(&filter.UserID, "user", 0, "only actions of this Pachca user ID")
+	flag.Parse()
+
+	config, err := config.LoadFromEnv()
+	if err != nil {
+		log.Fatalf("Config error: %s", err.Error())
+	}
+
+	auditLog, err := audit.Open(config.Audit.Store, config.Audit.Path)
+	if err != nil {
+		log.Fatalf("Audit log error: %s", err.Error())
+	}
+	defer auditLog.Close()
+
+	if err := printEntries(context.Background(), os.Stdout, auditLog, filter); err != nil {
+		log.Fatalf("Audit log error: %s", err.Error())
+	}
+}
+
+func printEntries(ctx context.Context, w io.Writer, auditLog audit.Log, filter audit.Filter) error {
+	entries, err := auditLog.Query(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"pachca.com/android-deployment/audit"
+	"pachca.com/android-deployment/shared"
+)
+
+func TestPrintEntriesFiltersByUser(t *testing.T) {
+	auditLog := audit.NewMemoryLog()
+	for _, userID := range []int{123, 456, 123} {
+		auditLog.Append(context.Background(), &audit.Entry{
+			UserID:      userID,
+			Action:      shared.ActionPromote,
+			ReleaseInfo: shared.ReleaseInfo{VersionCode: 1001},
+			Outcome:     audit.OutcomeStarted,
+		})
+	}
+
+	var out bytes.Buffer
+	if err := printEntries(context.Background(), &out, auditLog, audit.Filter{UserID: 123}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var ids []int64
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var entry audit.Entry
+		if err := decoder.Decode(&entry); err != nil {
+			t.Fatalf("Expected JSON lines, got %v", err)
+		}
+		ids = append(ids, entry.ID)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+		t.Errorf("Expected entries 1 and 3, got %v", ids)
+	}
+}
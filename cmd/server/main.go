@@ -0,0 +1,168 @@
+// Command server runs the Gitlab and Pachca webhook handlers as a standalone HTTP server,
+// for hosts that are not a serverless platform.
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	gitlabhook "pachca.com/android-deployment/api/gitlab"
+	pachcahook "pachca.com/android-deployment/api/pachca"
+	"pachca.com/android-deployment/config"
+	"pachca.com/android-deployment/health"
+	"pachca.com/android-deployment/logging"
+	"pachca.com/android-deployment/metrics"
+	"pachca.com/android-deployment/queue"
+	"pachca.com/android-deployment/release"
+	"pachca.com/android-deployment/tracing"
+)
+
+// jobLease bounds the time a worker spends on one queued webhook.
+const jobLease = time.Minute
+
+func main() {
+	config, err := config.LoadFromEnv()
+	if err != nil {
+		log.Fatalf("Config error: %s", err.Error())
+	}
+	if err := logging.Setup(config.Log); err != nil {
+		log.Fatalf("Config error: %s", err.Error())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, config.Tracing)
+	if err != nil {
+		log.Fatalf("Tracing error: %s", err.Error())
+	}
+
+	listener, err := net.Listen("tcp", config.Server.Addr)
+	if err != nil {
+		log.Fatalf("Listen error: %s", err.Error())
+	}
+
+	store, err := release.OpenStore(config.Release.Store, config.Release.StorePath)
+	if err != nil {
+		log.Fatalf("Release store error: %s", err.Error())
+	}
+	if err := metrics.RegisterReleases(store); err != nil {
+		log.Fatalf("Metrics error: %s", err.Error())
+	}
+
+	var workers sync.WaitGroup
+	if config.Queue.Store != "" {
+		worker, err := newWorker(config, http.DefaultClient)
+		if err != nil {
+			log.Fatalf("Queue error: %s", err.Error())
+		}
+		for range config.Queue.Workers {
+			workers.Go(func() { worker.Run(ctx) })
+		}
+	}
+
+	if err := run(ctx, config.Server, listener, newMux(config, http.DefaultClient)); err != nil {
+		log.Fatalf("Server error: %s", err.Error())
+	}
+
+	// Workers stop after the job in hand, which goes back to the queue if it was not done.
+	workers.Wait()
+
+	flushCtx, cancel := context.WithTimeout(context.Background(), config.Server.ShutdownTimeout)
+	defer cancel()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("Error exporting spans", "error", err)
+	}
+}
+
+// newWorker processes the webhooks the handlers queue.
+func newWorker(config *config.Config, client *http.Client) (*queue.Worker, error) {
+	jobs, err := queue.Open(config.Queue.Store, config.Queue.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &queue.Worker{
+		Queue: jobs,
+		Handlers: map[string]queue.Handler{
+			gitlabhook.JobKind: func(ctx context.Context, payload []byte) error {
+				return gitlabhook.ProcessGitlabJob(ctx, config, client, payload)
+			},
+			pachcahook.JobKind: func(ctx context.Context, payload []byte) error {
+				return pachcahook.ProcessPachcaJob(ctx, config, client, payload)
+			},
+		},
+		MaxAttempts:  config.Queue.MaxAttempts,
+		Backoff:      config.Queue.Backoff,
+		MaxBackoff:   config.Queue.MaxBackoff,
+		Lease:        jobLease,
+		PollInterval: time.Second,
+	}, nil
+}
+
+// newMux mounts the webhook handlers on the paths Gitlab and Pachca are configured to call,
+// the metrics for Prometheus to scrape and the health probes.
+func newMux(config *config.Config, client *http.Client) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /gitlab/webhook", func(w http.ResponseWriter, r *http.Request) {
+		gitlabhook.HandleGitlabHook(w, r, config, client)
+	})
+	mux.HandleFunc("POST /pachca/webhook", func(w http.ResponseWriter, r *http.Request) {
+		pachcahook.HandlePachcaHook(w, r, config, client)
+	})
+	mux.Handle("GET /metrics", metrics.Handler())
+	mux.Handle("GET /healthz", health.LiveHandler())
+	mux.Handle("GET /readyz", health.ReadyHandler(health.Checks(config, client)))
+
+	return mux
+}
+
+// run serves until ctx is cancelled, then stops accepting connections and waits
+// up to the shutdown timeout for webhooks in flight to finish.
+func run(ctx context.Context, config config.Server, listener net.Listener, handler http.Handler) error {
+	server := &http.Server{
+		Handler:      handler,
+		ReadTimeout:  config.ReadTimeout,
+		WriteTimeout: config.WriteTimeout,
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Listening", "addr", listener.Addr().String())
+		if config.TLSCert != "" {
+			serveErr <- server.ServeTLS(listener, config.TLSCert, config.TLSKey)
+		} else {
+			serveErr <- server.Serve(listener)
+		}
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
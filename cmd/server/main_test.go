@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pachca.com/android-deployment/config"
+	"pachca.com/android-deployment/shared"
+)
+
+func TestServerMountsWebhooks(t *testing.T) {
+	t.Setenv(shared.EnvPachcaUrl, "http://pachca.invalid")
+	t.Setenv(shared.EnvPachcaKey, "test-api-key")
+	t.Setenv(shared.EnvPachcaInternalChatId, "198")
+	t.Setenv(shared.EnvGitlabUrl, "http://gitlab.invalid")
+	t.Setenv(shared.EnvGitlabKey, "test-gitlab-key")
+	t.Setenv(shared.EnvGitlabProjectId, "42")
+	t.Setenv(shared.EnvGitlabRef, "release")
+	t.Setenv(shared.EnvGitlabWebhookToken, "test-webhook-token")
+	t.Setenv(shared.EnvPachcaSigningSecret, "test-signing-secret")
+	t.Setenv(shared.EnvReleaseSigningKey, "test-release-key")
+	t.Setenv(shared.EnvAuditStore, "memory")
+
+	tests := []struct {
+		method         string
+		path           string
+		expectedStatus int
+	}{
+		{method: "POST", path: "/gitlab/webhook", expectedStatus: http.StatusUnauthorized},
+		{method: "POST", path: "/pachca/webhook", expectedStatus: http.StatusUnauthorized},
+		{method: "GET", path: "/gitlab/webhook", expectedStatus: http.StatusMethodNotAllowed},
+		{method: "GET", path: "/metrics", expectedStatus: http.StatusOK},
+		{method: "GET", path: "/healthz", expectedStatus: http.StatusOK},
+		{method: "GET", path: "/readyz", expectedStatus: http.StatusServiceUnavailable},
+		{method: "POST", path: "/unknown", expectedStatus: http.StatusNotFound},
+	}
+
+	config, err := config.Load("")
+	if err != nil {
+		t.Fatalf("Config error: %v", err)
+	}
+
+	mux := newMux(config, http.DefaultClient)
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader("{}"))
+		w := httptest.NewRecorder()
+
+		mux.ServeHTTP(w, req)
+
+		if w.Code != tt.expectedStatus {
+			t.Errorf("Expected status %d for %s %s, got %d", tt.expectedStatus, tt.method, tt.path, w.Code)
+		}
+	}
+}
+
+func TestServerShutsDownGracefully(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen error: %v", err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	config := config.Server{ReadTimeout: time.Second, WriteTimeout: time.Second, ShutdownTimeout: 5 * time.Second}
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- run(ctx, config, listener, handler)
+	}()
+
+	respStatus := make(chan int, 1)
+	go func() {
+		resp, err := http.Post("http://"+listener.Addr().String()+"/gitlab/webhook", "application/json", nil)
+		if err != nil {
+			t.Errorf("Request error: %v", err)
+			respStatus <- 0
+			return
+		}
+		resp.Body.Close()
+		respStatus <- resp.StatusCode
+	}()
+
+	<-started
+	cancel()
+	close(release)
+
+	if status := <-respStatus; status != http.StatusOK {
+		t.Errorf("Expected in-flight request to finish with 200, got %d", status)
+	}
+	if err := <-runErr; err != nil {
+		t.Errorf("Expected clean shutdown, got %v", err)
+	}
+}
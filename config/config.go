@@ -0,0 +1,393 @@
+// Package config loads the settings of the release bot from an optional YAML or TOML file
+// and environment variables, which take precedence over the file.
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+
+	"pachca.com/android-deployment/audit"
+	"pachca.com/android-deployment/logging"
+	"pachca.com/android-deployment/pachca"
+	"pachca.com/android-deployment/queue"
+	"pachca.com/android-deployment/release"
+	"pachca.com/android-deployment/shared"
+	"pachca.com/android-deployment/tracing"
+)
+
+// Config is shared by both webhook handlers and the standalone server.
+// Durations in files are written as Go durations ("60s", "720h"), while
+// environment variables keep taking whole seconds.
+type Config struct {
+	Pachca  Pachca          `yaml:"pachca" toml:"pachca"`
+	Gitlab  Gitlab          `yaml:"gitlab" toml:"gitlab"`
+	Linear  Linear          `yaml:"linear" toml:"linear"`
+	Release Release         `yaml:"release" toml:"release"`
+	Server  Server          `yaml:"server" toml:"server"`
+	Queue   Queue           `yaml:"queue" toml:"queue"`
+	Audit   Audit           `yaml:"audit" toml:"audit"`
+	Log     logging.Options `yaml:"log" toml:"log"`
+	Tracing tracing.Options `yaml:"tracing" toml:"tracing"`
+	Apps    []App           `yaml:"apps" toml:"apps"`
+	Policy  *shared.Policy  `yaml:"policy" toml:"policy"`
+}
+
+type Pachca struct {
+	URL            string        `yaml:"url" toml:"url"`
+	Key            string        `yaml:"key" toml:"key"`
+	SigningSecret  string        `yaml:"signing_secret" toml:"signing_secret"`
+	WebhookMaxAge  time.Duration `yaml:"webhook_max_age" toml:"webhook_max_age"`
+	InternalChatID int           `yaml:"internal_chat_id" toml:"internal_chat_id"`
+	PublicChatID   int           `yaml:"public_chat_id" toml:"public_chat_id"`
+	// Timeout bounds every call to Pachca, and MaxAttempts limits how often a failed call is made.
+	// RetryBudget bounds a call with its retries and has to stay below the server write timeout.
+	Timeout     time.Duration `yaml:"timeout" toml:"timeout"`
+	MaxAttempts int           `yaml:"max_attempts" toml:"max_attempts"`
+	RetryBudget time.Duration `yaml:"retry_budget" toml:"retry_budget"`
+}
+
+// RetryPolicy applies the timeout, attempts and budget to the client's default policy.
+func (p Pachca) RetryPolicy() pachca.RetryPolicy {
+	policy := pachca.DefaultRetryPolicy
+	policy.Timeout = p.Timeout
+	policy.MaxAttempts = p.MaxAttempts
+	policy.Budget = p.RetryBudget
+	return policy
+}
+
+type Gitlab struct {
+	URL          string `yaml:"url" toml:"url"`
+	Key          string `yaml:"key" toml:"key"`
+	ProjectID    string `yaml:"project_id" toml:"project_id"`
+	Ref          string `yaml:"ref" toml:"ref"`
+	WebhookToken string `yaml:"webhook_token" toml:"webhook_token"`
+}
+
+type Linear struct {
+	URL    string `yaml:"url" toml:"url"`
+	Key    string `yaml:"key" toml:"key"`
+	TeamID string `yaml:"team_id" toml:"team_id"`
+}
+
+type Release struct {
+	SigningKey string        `yaml:"signing_key" toml:"signing_key"`
+	DataTTL    time.Duration `yaml:"data_ttl" toml:"data_ttl"`
+	Store      string        `yaml:"store" toml:"store"`
+	StorePath  string        `yaml:"store_path" toml:"store_path"`
+	Notes      ReleaseNotes  `yaml:"notes" toml:"notes"`
+}
+
+// ReleaseNotes are asked for in the promote and release forms, one input per locale.
+// Limits count characters, as the stores do.
+type ReleaseNotes struct {
+	// Locales are Google Play language codes, such as ru-RU or en-US. The first one is
+	// the default language of the app.
+	Locales []string `yaml:"locales" toml:"locales"`
+	// PlayMaxLength limits the notes of a promotion in Google Play.
+	PlayMaxLength int `yaml:"play_max_length" toml:"play_max_length"`
+	// OtherStoresMaxLength limits the notes of a release to the other stores.
+	OtherStoresMaxLength int `yaml:"other_stores_max_length" toml:"other_stores_max_length"`
+}
+
+type Server struct {
+	Addr            string        `yaml:"addr" toml:"addr"`
+	TLSCert         string        `yaml:"tls_cert" toml:"tls_cert"`
+	TLSKey          string        `yaml:"tls_key" toml:"tls_key"`
+	ReadTimeout     time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout    time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+}
+
+// Queue makes the handlers acknowledge webhooks right away and leave the work to background workers.
+// Webhooks are processed within the request while Store is empty.
+type Queue struct {
+	Store       string        `yaml:"store" toml:"store"`
+	Path        string        `yaml:"path" toml:"path"`
+	Workers     int           `yaml:"workers" toml:"workers"`
+	MaxAttempts int           `yaml:"max_attempts" toml:"max_attempts"`
+	Backoff     time.Duration `yaml:"backoff" toml:"backoff"`
+	MaxBackoff  time.Duration `yaml:"max_backoff" toml:"max_backoff"`
+}
+
+// Audit is where the release actions started from Pachca are recorded. The store has no default,
+// so that a log kept only in memory and lost on restart is a deliberate choice.
+type Audit struct {
+	Store string `yaml:"store" toml:"store"`
+	Path  string `yaml:"path" toml:"path"`
+}
+
+// App is an Android application released through the bot.
+type App struct {
+	Name        string `yaml:"name" toml:"name"`
+	PromoteTask string `yaml:"promote_task" toml:"promote_task"`
+}
+
+// localePattern matches the language codes of Google Play, like en-US, es-419 or fil.
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,4})?$`)
+
+// ValidationError lists every problem found in the configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid config: " + strings.Join(e.Problems, "; ")
+}
+
+// Default returns the settings used for everything the file and the environment leave out.
+func Default() *Config {
+	return &Config{
+		Pachca: Pachca{
+			WebhookMaxAge: time.Minute,
+			Timeout:       pachca.DefaultRetryPolicy.Timeout,
+			MaxAttempts:   pachca.DefaultRetryPolicy.MaxAttempts,
+			RetryBudget:   pachca.DefaultRetryPolicy.Budget,
+		},
+		Release: Release{
+			// Keeps buttons of a pinned release message usable through a staged rollout.
+			DataTTL: 30 * 24 * time.Hour,
+			Store:   release.StoreMemory,
+			Notes: ReleaseNotes{
+				Locales:              []string{"ru-RU"},
+				PlayMaxLength:        500,
+				OtherStoresMaxLength: 500,
+			},
+		},
+		Server: Server{
+			Addr:            ":8080",
+			ReadTimeout:     10 * time.Second,
+			WriteTimeout:    30 * time.Second,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Queue: Queue{
+			Workers:     2,
+			MaxAttempts: 8,
+			Backoff:     5 * time.Second,
+			MaxBackoff:  10 * time.Minute,
+		},
+		Apps: []App{
+			{Name: "pachca", PromoteTask: ":app_pachca:play:promoteProdArtifact"},
+		},
+	}
+}
+
+// Load reads the file at path, when it is not empty, then the environment,
+// and validates the result. All problems are reported in a single ValidationError.
+func Load(path string) (*Config, error) {
+	config := Default()
+
+	var problems []string
+	if path != "" {
+		if err := config.readFile(path); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	problems = append(problems, config.readEnv()...)
+	problems = append(problems, config.validate()...)
+
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	return config, nil
+}
+
+// LoadFromEnv loads the file named by ENV_CONFIG_FILE, if any, and the environment.
+func LoadFromEnv() (*Config, error) {
+	return Load(os.Getenv(shared.EnvConfigFile))
+}
+
+// ValidateServerless reports settings that only cmd/server can serve. Queued jobs are
+// processed by the workers it runs, so a serverless function would queue jobs that never run.
+func (c *Config) ValidateServerless() error {
+	if c.Queue.Store != "" {
+		return &ValidationError{Problems: []string{"queue store is not supported by serverless handlers, run cmd/server to process queued jobs"}}
+	}
+	return nil
+}
+
+// DefaultApp is the app the release buttons and forms act on.
+func (c *Config) DefaultApp() App {
+	return c.Apps[0]
+}
+
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("config file %s: unknown keys %v", path, undecoded)
+		}
+	default:
+		return fmt.Errorf("config file %s: unsupported format, use .yaml, .yml or .toml", path)
+	}
+
+	return nil
+}
+
+func (c *Config) validate() []string {
+	var problems []string
+	required := func(value string, name string) {
+		if value == "" {
+			problems = append(problems, name+" not set")
+		}
+	}
+	validURL := func(value string, name string) {
+		if value == "" {
+			return
+		}
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, "invalid "+name)
+		}
+	}
+	positive := func(value time.Duration, name string) {
+		if value <= 0 {
+			problems = append(problems, "invalid "+name)
+		}
+	}
+
+	required(c.Pachca.URL, "pachca url")
+	validURL(c.Pachca.URL, "pachca url")
+	required(c.Pachca.Key, "pachca key")
+	required(c.Pachca.SigningSecret, "pachca signing_secret")
+	positive(c.Pachca.WebhookMaxAge, "pachca webhook_max_age")
+	positive(c.Pachca.Timeout, "pachca timeout")
+	if c.Pachca.MaxAttempts <= 0 {
+		problems = append(problems, "invalid pachca max_attempts")
+	}
+	positive(c.Pachca.RetryBudget, "pachca retry_budget")
+	if c.Pachca.RetryBudget >= c.Server.WriteTimeout && c.Server.WriteTimeout > 0 {
+		problems = append(problems, "pachca retry_budget must be shorter than server write_timeout")
+	}
+	if c.Pachca.InternalChatID == 0 {
+		problems = append(problems, "pachca internal_chat_id not set")
+	}
+
+	required(c.Gitlab.URL, "gitlab url")
+	validURL(c.Gitlab.URL, "gitlab url")
+	required(c.Gitlab.Key, "gitlab key")
+	required(c.Gitlab.ProjectID, "gitlab project_id")
+	required(c.Gitlab.Ref, "gitlab ref")
+	required(c.Gitlab.WebhookToken, "gitlab webhook_token")
+
+	validURL(c.Linear.URL, "linear url")
+
+	required(c.Release.SigningKey, "release signing_key")
+	positive(c.Release.DataTTL, "release data_ttl")
+	switch c.Release.Store {
+	case release.StoreMemory:
+	case release.StoreFile, release.StoreSQLite:
+		required(c.Release.StorePath, "release store_path")
+	default:
+		problems = append(problems, fmt.Sprintf("unknown release store %q", c.Release.Store))
+	}
+
+	if len(c.Release.Notes.Locales) == 0 {
+		problems = append(problems, "no release notes locales defined")
+	}
+	locales := make(map[string]bool)
+	for _, locale := range c.Release.Notes.Locales {
+		if !localePattern.MatchString(locale) {
+			problems = append(problems, fmt.Sprintf("invalid release notes locale %q", locale))
+		} else if locales[locale] {
+			problems = append(problems, fmt.Sprintf("release notes locale %q defined twice", locale))
+		}
+		locales[locale] = true
+	}
+	if c.Release.Notes.PlayMaxLength <= 0 {
+		problems = append(problems, "invalid release notes play_max_length")
+	}
+	if c.Release.Notes.OtherStoresMaxLength <= 0 {
+		problems = append(problems, "invalid release notes other_stores_max_length")
+	}
+
+	if (c.Server.TLSCert == "") != (c.Server.TLSKey == "") {
+		problems = append(problems, "server tls_cert and tls_key must be set together")
+	}
+	positive(c.Server.ReadTimeout, "server read_timeout")
+	positive(c.Server.WriteTimeout, "server write_timeout")
+	positive(c.Server.ShutdownTimeout, "server shutdown_timeout")
+
+	switch c.Queue.Store {
+	case "":
+	case queue.StoreFile, queue.StoreSQLite:
+		required(c.Queue.Path, "queue path")
+	default:
+		problems = append(problems, fmt.Sprintf("unknown queue store %q", c.Queue.Store))
+	}
+	if c.Queue.Workers <= 0 {
+		problems = append(problems, "invalid queue workers")
+	}
+	if c.Queue.MaxAttempts <= 0 {
+		problems = append(problems, "invalid queue max_attempts")
+	}
+	positive(c.Queue.Backoff, "queue backoff")
+	positive(c.Queue.MaxBackoff, "queue max_backoff")
+
+	switch c.Audit.Store {
+	case "":
+		problems = append(problems, "audit store not set")
+	case audit.StoreMemory:
+	case audit.StoreFile, audit.StoreSQLite:
+		required(c.Audit.Path, "audit path")
+	default:
+		problems = append(problems, fmt.Sprintf("unknown audit store %q", c.Audit.Store))
+	}
+
+	if len(c.Apps) == 0 {
+		problems = append(problems, "no apps defined")
+	}
+	names := make(map[string]bool)
+	for i, app := range c.Apps {
+		if app.Name == "" {
+			problems = append(problems, fmt.Sprintf("app %d has no name", i+1))
+		} else if names[app.Name] {
+			problems = append(problems, fmt.Sprintf("app %q defined twice", app.Name))
+		}
+		names[app.Name] = true
+		if app.PromoteTask == "" {
+			problems = append(problems, fmt.Sprintf("app %q has no promote_task", app.Name))
+		}
+	}
+
+	if err := c.Log.Validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if err := c.Tracing.Validate(); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if c.Policy != nil {
+		if err := c.Policy.Validate(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	return problems
+}
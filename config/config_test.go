@@ -0,0 +1,228 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pachca.com/android-deployment/shared"
+)
+
+const yamlConfig = `
+pachca:
+  url: https://api.pachca.com/api/shared/v1
+  key: pachca-key
+  signing_secret: pachca-secret
+  webhook_max_age: 2m
+  internal_chat_id: 198
+gitlab:
+  url: https://gitlab.example.com/api/v4
+  key: gitlab-key
+  project_id: android/app
+  ref: release
+  webhook_token: gitlab-token
+release:
+  signing_key: release-key
+  store: sqlite
+  store_path: /var/lib/release-bot/releases.db
+  notes:
+    locales: [ru-RU, en-US]
+    other_stores_max_length: 4000
+audit:
+  store: file
+  path: /var/lib/release-bot/audit.jsonl
+apps:
+  - name: pachca
+    promote_task: ":app_pachca:play:promoteProdArtifact"
+policy:
+  groups:
+    release-managers: [123]
+  actions:
+    promote:
+      groups: [release-managers]
+`
+
+const tomlConfig = `
+[pachca]
+url = "https://api.pachca.com/api/shared/v1"
+key = "pachca-key"
+signing_secret = "pachca-secret"
+webhook_max_age = "2m"
+internal_chat_id = 198
+
+[gitlab]
+url = "https://gitlab.example.com/api/v4"
+key = "gitlab-key"
+project_id = "android/app"
+ref = "release"
+webhook_token = "gitlab-token"
+
+[release]
+signing_key = "release-key"
+store = "sqlite"
+store_path = "/var/lib/release-bot/releases.db"
+
+[release.notes]
+locales = ["ru-RU", "en-US"]
+other_stores_max_length = 4000
+
+[audit]
+store = "file"
+path = "/var/lib/release-bot/audit.jsonl"
+
+[[apps]]
+name = "pachca"
+promote_task = ":app_pachca:play:promoteProdArtifact"
+
+[policy.groups]
+release-managers = [123]
+
+[policy.actions.promote]
+groups = ["release-managers"]
+`
+
+func TestLoadReadsFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{name: "yaml", file: "config.yaml", content: yamlConfig},
+		{name: "toml", file: "config.toml", content: tomlConfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			os.WriteFile(path, []byte(tt.content), 0o600)
+
+			config, err := Load(path)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			if config.Pachca.WebhookMaxAge != 2*time.Minute {
+				t.Errorf("Expected webhook max age 2m, got %s", config.Pachca.WebhookMaxAge)
+			}
+			if config.Pachca.InternalChatID != 198 {
+				t.Errorf("Expected internal chat 198, got %d", config.Pachca.InternalChatID)
+			}
+			if config.Gitlab.ProjectID != "android/app" {
+				t.Errorf("Expected project 'android/app', got '%s'", config.Gitlab.ProjectID)
+			}
+			if config.Release.Store != "sqlite" {
+				t.Errorf("Expected sqlite store, got '%s'", config.Release.Store)
+			}
+			if config.Release.DataTTL != 30*24*time.Hour {
+				t.Errorf("Expected default release data TTL, got %s", config.Release.DataTTL)
+			}
+			notes := config.Release.Notes
+			if strings.Join(notes.Locales, ",") != "ru-RU,en-US" || notes.PlayMaxLength != 500 || notes.OtherStoresMaxLength != 4000 {
+				t.Errorf("Expected release notes in ru-RU and en-US limited to 500 and 4000, got %+v", notes)
+			}
+			if !config.Policy.Allows(shared.ActionPromote, 123) {
+				t.Error("Expected policy to allow promote for user 123")
+			}
+			if config.DefaultApp().PromoteTask != ":app_pachca:play:promoteProdArtifact" {
+				t.Errorf("Unexpected default app: %+v", config.DefaultApp())
+			}
+		})
+	}
+}
+
+func TestLoadPrefersEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(yamlConfig), 0o600)
+
+	t.Setenv(shared.EnvPachcaKey, "env-pachca-key")
+	t.Setenv(shared.EnvPachcaWebhookMaxAge, "30")
+	t.Setenv(shared.EnvReleasePolicy, `{"actions":{"promote":{"users":[456]}}}`)
+	t.Setenv(shared.EnvReleaseNotesLocales, "en-US, de-DE")
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if config.Pachca.Key != "env-pachca-key" {
+		t.Errorf("Expected pachca key from env, got '%s'", config.Pachca.Key)
+	}
+	if config.Pachca.WebhookMaxAge != 30*time.Second {
+		t.Errorf("Expected webhook max age 30s, got %s", config.Pachca.WebhookMaxAge)
+	}
+	if config.Policy.Allows(shared.ActionPromote, 123) || !config.Policy.Allows(shared.ActionPromote, 456) {
+		t.Error("Expected policy from env to replace the file policy")
+	}
+	if strings.Join(config.Release.Notes.Locales, ",") != "en-US,de-DE" {
+		t.Errorf("Expected release notes locales from env, got %v", config.Release.Notes.Locales)
+	}
+}
+
+func TestLoadReportsAllProblems(t *testing.T) {
+	t.Setenv(shared.EnvPachcaUrl, "not a url")
+	t.Setenv(shared.EnvPachcaInternalChatId, "general")
+	t.Setenv(shared.EnvReleaseStore, "file")
+	t.Setenv(shared.EnvServerTLSCert, "cert.pem")
+	t.Setenv(shared.EnvQueueStore, "sqlite")
+	t.Setenv(shared.EnvReleaseNotesLocales, "ru-RU,Russian,ru-RU")
+	t.Setenv(shared.EnvReleaseNotesPlayMaxLength, "0")
+	t.Setenv(shared.EnvServerWriteTimeout, "20")
+
+	_, err := Load("")
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+
+	expected := []string{
+		"invalid ENV_PACHCA_INTERNAL_CHAT_ID: not a number",
+		"invalid pachca url",
+		"pachca key not set",
+		"pachca signing_secret not set",
+		"pachca retry_budget must be shorter than server write_timeout",
+		"pachca internal_chat_id not set",
+		"gitlab url not set",
+		"gitlab key not set",
+		"gitlab project_id not set",
+		"gitlab ref not set",
+		"gitlab webhook_token not set",
+		"release signing_key not set",
+		"release store_path not set",
+		`invalid release notes locale "Russian"`,
+		`release notes locale "ru-RU" defined twice`,
+		"invalid release notes play_max_length",
+		"server tls_cert and tls_key must be set together",
+		"queue path not set",
+		"audit store not set",
+	}
+	if strings.Join(validationErr.Problems, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected problems:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(validationErr.Problems, "\n"))
+	}
+}
+
+func TestLoadRejectsUnknownFileKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	os.WriteFile(path, []byte(yamlConfig+"\nslack:\n  url: https://slack.com\n"), 0o600)
+
+	_, err := Load(path)
+	if err == nil || !strings.Contains(err.Error(), "slack") {
+		t.Errorf("Expected error naming the unknown key, got %v", err)
+	}
+}
+
+func TestValidateServerlessRejectsQueue(t *testing.T) {
+	config := Default()
+	if err := config.ValidateServerless(); err != nil {
+		t.Errorf("Expected no error without a queue, got %v", err)
+	}
+
+	config.Queue.Store = "sqlite"
+	var validationErr *ValidationError
+	if err := config.ValidateServerless(); !errors.As(err, &validationErr) {
+		t.Errorf("Expected ValidationError with a queue, got %v", err)
+	}
+}
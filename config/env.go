@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"pachca.com/android-deployment/shared"
+)
+
+// envVar overrides one setting when the environment variable is set.
+type envVar struct {
+	name  string
+	apply func(c *Config, value string) error
+}
+
+var envVars = []envVar{
+	{shared.EnvPachcaUrl, setString(func(c *Config) *string { return &c.Pachca.URL })},
+	{shared.EnvPachcaKey, setString(func(c *Config) *string { return &c.Pachca.Key })},
+	{shared.EnvPachcaSigningSecret, setString(func(c *Config) *string { return &c.Pachca.SigningSecret })},
+	{shared.EnvPachcaWebhookMaxAge, setSeconds(func(c *Config) *time.Duration { return &c.Pachca.WebhookMaxAge })},
+	{shared.EnvPachcaInternalChatId, setInt(func(c *Config) *int { return &c.Pachca.InternalChatID })},
+	{shared.EnvPachcaPublicChatId, setInt(func(c *Config) *int { return &c.Pachca.PublicChatID })},
+	{shared.EnvPachcaTimeout, setSeconds(func(c *Config) *time.Duration { return &c.Pachca.Timeout })},
+	{shared.EnvPachcaMaxAttempts, setInt(func(c *Config) *int { return &c.Pachca.MaxAttempts })},
+	{shared.EnvPachcaRetryBudget, setSeconds(func(c *Config) *time.Duration { return &c.Pachca.RetryBudget })},
+
+	{shared.EnvGitlabUrl, setString(func(c *Config) *string { return &c.Gitlab.URL })},
+	{shared.EnvGitlabKey, setString(func(c *Config) *string { return &c.Gitlab.Key })},
+	{shared.EnvGitlabProjectId, setString(func(c *Config) *string { return &c.Gitlab.ProjectID })},
+	{shared.EnvGitlabRef, setString(func(c *Config) *string { return &c.Gitlab.Ref })},
+	{shared.EnvGitlabWebhookToken, setString(func(c *Config) *string { return &c.Gitlab.WebhookToken })},
+
+	{shared.EnvLinearUrl, setString(func(c *Config) *string { return &c.Linear.URL })},
+	{shared.EnvLinearKey, setString(func(c *Config) *string { return &c.Linear.Key })},
+	{shared.EnvLinearTeamId, setString(func(c *Config) *string { return &c.Linear.TeamID })},
+
+	{shared.EnvReleaseSigningKey, setString(func(c *Config) *string { return &c.Release.SigningKey })},
+	{shared.EnvReleaseDataTTL, setSeconds(func(c *Config) *time.Duration { return &c.Release.DataTTL })},
+	{shared.EnvReleaseStore, setString(func(c *Config) *string { return &c.Release.Store })},
+	{shared.EnvReleaseStorePath, setString(func(c *Config) *string { return &c.Release.StorePath })},
+	{shared.EnvReleaseNotesLocales, setList(func(c *Config) *[]string { return &c.Release.Notes.Locales })},
+	{shared.EnvReleaseNotesPlayMaxLength, setInt(func(c *Config) *int { return &c.Release.Notes.PlayMaxLength })},
+	{shared.EnvReleaseNotesOtherStoresMaxLength, setInt(func(c *Config) *int { return &c.Release.Notes.OtherStoresMaxLength })},
+	{shared.EnvReleasePolicy, func(c *Config, value string) error {
+		policy, err := shared.ParsePolicy(value)
+		if err != nil {
+			return err
+		}
+		c.Policy = policy
+		return nil
+	}},
+
+	{shared.EnvServerAddr, setString(func(c *Config) *string { return &c.Server.Addr })},
+	{shared.EnvServerTLSCert, setString(func(c *Config) *string { return &c.Server.TLSCert })},
+	{shared.EnvServerTLSKey, setString(func(c *Config) *string { return &c.Server.TLSKey })},
+	{shared.EnvServerReadTimeout, setSeconds(func(c *Config) *time.Duration { return &c.Server.ReadTimeout })},
+	{shared.EnvServerWriteTimeout, setSeconds(func(c *Config) *time.Duration { return &c.Server.WriteTimeout })},
+	{shared.EnvServerShutdownTimeout, setSeconds(func(c *Config) *time.Duration { return &c.Server.ShutdownTimeout })},
+
+	{shared.EnvQueueStore, setString(func(c *Config) *string { return &c.Queue.Store })},
+	{shared.EnvQueuePath, setString(func(c *Config) *string { return &c.Queue.Path })},
+	{shared.EnvQueueWorkers, setInt(func(c *Config) *int { return &c.Queue.Workers })},
+	{shared.EnvQueueMaxAttempts, setInt(func(c *Config) *int { return &c.Queue.MaxAttempts })},
+	{shared.EnvQueueBackoff, setSeconds(func(c *Config) *time.Duration { return &c.Queue.Backoff })},
+	{shared.EnvQueueMaxBackoff, setSeconds(func(c *Config) *time.Duration { return &c.Queue.MaxBackoff })},
+
+	{shared.EnvAuditStore, setString(func(c *Config) *string { return &c.Audit.Store })},
+	{shared.EnvAuditPath, setString(func(c *Config) *string { return &c.Audit.Path })},
+
+	{shared.EnvLogLevel, setString(func(c *Config) *string { return &c.Log.Level })},
+	{shared.EnvLogFormat, setString(func(c *Config) *string { return &c.Log.Format })},
+	{shared.EnvLogDumpPayloads, setBool(func(c *Config) *bool { return &c.Log.DumpPayloads })},
+
+	{shared.EnvTracingEndpoint, setString(func(c *Config) *string { return &c.Tracing.Endpoint })},
+	{shared.EnvTracingServiceName, setString(func(c *Config) *string { return &c.Tracing.ServiceName })},
+}
+
+func (c *Config) readEnv() []string {
+	var problems []string
+	for _, v := range envVars {
+		value := os.Getenv(v.name)
+		if value == "" {
+			continue
+		}
+
+		if err := v.apply(c, value); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid %s: %s", v.name, err.Error()))
+		}
+	}
+
+	return problems
+}
+
+func setString(field func(c *Config) *string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func setInt(field func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("not a number")
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+// setList reads a comma-separated list.
+func setList(field func(c *Config) *[]string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}
+}
+
+func setBool(field func(c *Config) *bool) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("not a boolean")
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+// setSeconds reads a positive whole number of seconds.
+func setSeconds(field func(c *Config) *time.Duration) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return fmt.Errorf("not a positive number of seconds")
+		}
+		*field(c) = time.Duration(seconds) * time.Second
+		return nil
+	}
+}
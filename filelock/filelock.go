@@ -0,0 +1,26 @@
+// Package filelock serialises changes to the files of the file stores between processes.
+package filelock
+
+import "os"
+
+// Lock takes an exclusive lock on path with ".lock" appended, waiting while another process
+// holds it. The file stores replace their file on every change, so the lock lives next to it.
+func Lock(path string) (unlock func() error, err error) {
+	file, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lockFile(file); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return func() error {
+		unlockErr := unlockFile(file)
+		if err := file.Close(); unlockErr == nil {
+			unlockErr = err
+		}
+		return unlockErr
+	}, nil
+}
@@ -0,0 +1,43 @@
+package filelock
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockWaitsForHolder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatalf("Expected lock, got %v", err)
+	}
+
+	locked := make(chan struct{})
+	go func() {
+		unlock, err := Lock(path)
+		if err != nil {
+			t.Errorf("Expected second lock, got %v", err)
+			close(locked)
+			return
+		}
+		close(locked)
+		unlock()
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("Expected second lock to wait for the first one")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatalf("Expected unlock, got %v", err)
+	}
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("Expected second lock once the first one is released")
+	}
+}
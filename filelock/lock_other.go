@@ -0,0 +1,14 @@
+//go:build !unix
+
+package filelock
+
+import "os"
+
+// lockFile does nothing where flock is not available: the file stores are safe within one process only.
+func lockFile(file *os.File) error {
+	return nil
+}
+
+func unlockFile(file *os.File) error {
+	return nil
+}
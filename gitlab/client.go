@@ -0,0 +1,146 @@
+// Package gitlab is a client for the parts of the GitLab REST API used to drive release pipelines.
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"pachca.com/android-deployment/logging"
+	"pachca.com/android-deployment/metrics"
+	"pachca.com/android-deployment/tracing"
+)
+
+// Client works with a single project, identified by its numeric ID or its full path.
+type Client struct {
+	baseURL    string
+	token      string
+	projectID  string
+	httpClient *http.Client
+}
+
+func NewClient(baseURL string, token string, projectID string, httpClient *http.Client) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		projectID:  projectID,
+		httpClient: httpClient,
+	}
+}
+
+// APIError is returned for non-2xx responses. GitLab reports errors either as
+// a plain message or as a map of field names to messages.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("Gitlab API returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("Gitlab API returned status %d: %s", e.StatusCode, e.Message)
+}
+
+func newAPIError(statusCode int, body []byte) *APIError {
+	var errorBody struct {
+		Message json.RawMessage `json:"message"`
+		Error   string          `json:"error"`
+	}
+	json.Unmarshal(body, &errorBody)
+
+	apiErr := &APIError{StatusCode: statusCode, Message: errorBody.Error}
+
+	var message string
+	if err := json.Unmarshal(errorBody.Message, &message); err == nil {
+		apiErr.Message = message
+	} else if len(errorBody.Message) > 0 {
+		apiErr.Message = string(errorBody.Message)
+	}
+
+	return apiErr
+}
+
+func (c *Client) projectPath(format string, args ...any) string {
+	return "/projects/" + url.PathEscape(c.projectID) + fmt.Sprintf(format, args...)
+}
+
+// do sends a JSON request and decodes a JSON response into out, when both are present.
+func (c *Client) do(ctx context.Context, method string, path string, in any, out any) error {
+	resp, err := c.send(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	logging.Payload(ctx, "Gitlab response", respBody, "method", method, "path", path, "status", resp.StatusCode)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newAPIError(resp.StatusCode, respBody)
+	}
+
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(respBody, out)
+}
+
+// stream sends a request and returns the body of a successful response for the caller to close.
+func (c *Client) stream(ctx context.Context, method string, path string) (io.ReadCloser, error) {
+	resp, err := c.send(ctx, method, path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, newAPIError(resp.StatusCode, respBody)
+	}
+
+	return resp.Body, nil
+}
+
+func (c *Client) send(ctx context.Context, method string, path string, in any) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		payloadBytes, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+
+		logging.Payload(ctx, "Outgoing Gitlab request", payloadBytes, "method", method, "path", path)
+		body = bytes.NewReader(payloadBytes)
+	}
+
+	ctx, span := tracing.StartCall(ctx, metrics.ServiceGitlab, method, path)
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		tracing.End(span, err)
+		return nil, err
+	}
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("PRIVATE-TOKEN", c.token)
+
+	started := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		metrics.ObserveCall(metrics.ServiceGitlab, method, started, 0, err)
+		tracing.EndCall(span, 0, err)
+		return nil, err
+	}
+	metrics.ObserveCall(metrics.ServiceGitlab, method, started, resp.StatusCode, nil)
+	tracing.EndCall(span, resp.StatusCode, nil)
+	return resp, nil
+}
@@ -0,0 +1,306 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientTriggersPipeline(t *testing.T) {
+	mockGitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.EscapedPath() != "/projects/group%2Fapp/pipeline" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.EscapedPath())
+		}
+		if r.Header.Get("PRIVATE-TOKEN") != "test-gitlab-key" {
+			t.Errorf("Expected PRIVATE-TOKEN header, got '%s'", r.Header.Get("PRIVATE-TOKEN"))
+		}
+
+		var pipelineReq PipelineRequest
+		json.NewDecoder(r.Body).Decode(&pipelineReq)
+		if pipelineReq.Ref != "release" {
+			t.Errorf("Expected ref 'release', got '%s'", pipelineReq.Ref)
+		}
+		if len(pipelineReq.Variables) != 1 || pipelineReq.Variables[0].Key != "DEPLOY_ACTION" || pipelineReq.Variables[0].Value != "promote" {
+			t.Errorf("Unexpected variables: %+v", pipelineReq.Variables)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{"id": 1001, "status": "created", "ref": "release"})
+	}))
+	defer mockGitlab.Close()
+
+	client := NewClient(mockGitlab.URL, "test-gitlab-key", "group/app", mockGitlab.Client())
+
+	pipeline, err := client.TriggerPipeline(context.Background(), PipelineRequest{
+		Ref:       "release",
+		Variables: []Variable{{Key: "DEPLOY_ACTION", Value: "promote"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if pipeline.ID != 1001 {
+		t.Errorf("Expected pipeline id 1001, got %d", pipeline.ID)
+	}
+}
+
+func TestClientManagesJobs(t *testing.T) {
+	tests := []struct {
+		name         string
+		expectedPath string
+		call         func(client *Client) (*Job, error)
+	}{
+		{
+			name:         "play",
+			expectedPath: "/projects/42/jobs/7/play",
+			call: func(client *Client) (*Job, error) {
+				return client.PlayJob(context.Background(), 7, []Variable{{Key: "ROLLOUT_PERCENTAGE", Value: "10"}})
+			},
+		},
+		{
+			name:         "retry",
+			expectedPath: "/projects/42/jobs/7/retry",
+			call: func(client *Client) (*Job, error) {
+				return client.RetryJob(context.Background(), 7)
+			},
+		},
+		{
+			name:         "cancel",
+			expectedPath: "/projects/42/jobs/7/cancel",
+			call: func(client *Client) (*Job, error) {
+				return client.CancelJob(context.Background(), 7)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockGitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != "POST" || r.URL.Path != tt.expectedPath {
+					t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+				}
+
+				w.WriteHeader(http.StatusCreated)
+				json.NewEncoder(w).Encode(map[string]any{"id": 8, "name": "promote", "status": "pending"})
+			}))
+			defer mockGitlab.Close()
+
+			client := NewClient(mockGitlab.URL, "test-gitlab-key", "42", mockGitlab.Client())
+
+			job, err := tt.call(client)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if job.ID != 8 || job.Status != "pending" {
+				t.Errorf("Unexpected job: %+v", job)
+			}
+		})
+	}
+}
+
+func TestClientReadsJobTraceAndArtifacts(t *testing.T) {
+	mockGitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/projects/42/jobs/7/trace":
+			w.Write([]byte("BUILD SUCCESSFUL"))
+		case "/projects/42/jobs/7/artifacts/app/build/mapping%20file.txt":
+			w.Write([]byte("mapping"))
+		default:
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.EscapedPath())
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer mockGitlab.Close()
+
+	client := NewClient(mockGitlab.URL, "test-gitlab-key", "42", mockGitlab.Client())
+
+	trace, err := client.GetJobTrace(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if trace != "BUILD SUCCESSFUL" {
+		t.Errorf("Expected trace 'BUILD SUCCESSFUL', got '%s'", trace)
+	}
+
+	artifact, err := client.DownloadArtifactFile(context.Background(), 7, "app/build/mapping file.txt")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer artifact.Close()
+
+	content, _ := io.ReadAll(artifact)
+	if string(content) != "mapping" {
+		t.Errorf("Expected artifact content 'mapping', got '%s'", string(content))
+	}
+}
+
+func TestClientGetsProject(t *testing.T) {
+	mockGitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" || r.URL.EscapedPath() != "/projects/group%2Fapp" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.EscapedPath())
+		}
+
+		json.NewEncoder(w).Encode(map[string]any{"id": 42, "path_with_namespace": "group/app", "default_branch": "main"})
+	}))
+	defer mockGitlab.Close()
+
+	client := NewClient(mockGitlab.URL, "test-gitlab-key", "group/app", mockGitlab.Client())
+
+	project, err := client.GetProject(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if project.ID != 42 || project.PathWithNamespace != "group/app" {
+		t.Errorf("Unexpected project: %+v", project)
+	}
+}
+
+func TestClientReadsAndCommitsFiles(t *testing.T) {
+	mockGitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.EscapedPath() == "/projects/42/repository/files/app%2Fversion.properties":
+			if r.URL.Query().Get("ref") != "release" {
+				t.Errorf("Expected ref 'release', got '%s'", r.URL.Query().Get("ref"))
+			}
+			json.NewEncoder(w).Encode(map[string]any{
+				"file_path": "app/version.properties",
+				"encoding":  "base64",
+				"content":   base64.StdEncoding.EncodeToString([]byte("versionCode=42\n")),
+			})
+		case r.Method == "POST" && r.URL.Path == "/projects/42/repository/commits":
+			var commitReq CommitRequest
+			json.NewDecoder(r.Body).Decode(&commitReq)
+			if len(commitReq.Actions) != 1 || commitReq.Actions[0].Action != "update" || commitReq.Actions[0].Content != "versionCode=43\n" {
+				t.Errorf("Unexpected commit actions: %+v", commitReq.Actions)
+			}
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{"id": "abc123", "title": commitReq.CommitMessage})
+		default:
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.EscapedPath())
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer mockGitlab.Close()
+
+	client := NewClient(mockGitlab.URL, "test-gitlab-key", "42", mockGitlab.Client())
+
+	file, err := client.GetFile(context.Background(), "app/version.properties", "release")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	content, err := file.Decoded()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if string(content) != "versionCode=42\n" {
+		t.Errorf("Expected decoded content, got '%s'", string(content))
+	}
+
+	commit, err := client.CreateCommit(context.Background(), CommitRequest{
+		Branch:        "release",
+		CommitMessage: "Bump version code",
+		Actions:       []CommitAction{{Action: "update", FilePath: "app/version.properties", Content: "versionCode=43\n"}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if commit.ID != "abc123" {
+		t.Errorf("Expected commit id 'abc123', got '%s'", commit.ID)
+	}
+}
+
+func TestClientCreatesTagAndRelease(t *testing.T) {
+	mockGitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		switch r.URL.Path {
+		case "/projects/42/repository/tags":
+			json.NewEncoder(w).Encode(map[string]any{"name": "v1.0.0", "target": "abc123"})
+		case "/projects/42/releases":
+			json.NewEncoder(w).Encode(map[string]any{"tag_name": "v1.0.0", "name": "1.0.0"})
+		default:
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer mockGitlab.Close()
+
+	client := NewClient(mockGitlab.URL, "test-gitlab-key", "42", mockGitlab.Client())
+
+	tag, err := client.CreateTag(context.Background(), TagRequest{TagName: "v1.0.0", Ref: "release"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if tag.Name != "v1.0.0" {
+		t.Errorf("Expected tag 'v1.0.0', got '%s'", tag.Name)
+	}
+
+	release, err := client.CreateRelease(context.Background(), ReleaseRequest{TagName: "v1.0.0", Name: "1.0.0"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if release.Name != "1.0.0" {
+		t.Errorf("Expected release name '1.0.0', got '%s'", release.Name)
+	}
+}
+
+func TestClientDecodesAPIErrors(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int
+		body            string
+		expectedMessage string
+	}{
+		{
+			name:            "message",
+			status:          http.StatusForbidden,
+			body:            `{"message":"403 Forbidden"}`,
+			expectedMessage: "Gitlab API returned status 403: 403 Forbidden",
+		},
+		{
+			name:            "field errors",
+			status:          http.StatusBadRequest,
+			body:            `{"message":{"base":["Reference not found"]}}`,
+			expectedMessage: `Gitlab API returned status 400: {"base":["Reference not found"]}`,
+		},
+		{
+			name:            "error",
+			status:          http.StatusUnauthorized,
+			body:            `{"error":"invalid_token"}`,
+			expectedMessage: "Gitlab API returned status 401: invalid_token",
+		},
+		{
+			name:            "empty body",
+			status:          http.StatusBadGateway,
+			body:            ``,
+			expectedMessage: "Gitlab API returned status 502",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockGitlab := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer mockGitlab.Close()
+
+			client := NewClient(mockGitlab.URL, "test-gitlab-key", "42", mockGitlab.Client())
+
+			_, err := client.RetryJob(context.Background(), 7)
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("Expected APIError, got %v", err)
+			}
+			if apiErr.StatusCode != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, apiErr.StatusCode)
+			}
+			if apiErr.Error() != tt.expectedMessage {
+				t.Errorf("Expected message '%s', got '%s'", tt.expectedMessage, apiErr.Error())
+			}
+		})
+	}
+}
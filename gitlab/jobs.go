@@ -0,0 +1,97 @@
+package gitlab
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+type Job struct {
+	ID         int      `json:"id"`
+	Name       string   `json:"name"`
+	Stage      string   `json:"stage"`
+	Status     string   `json:"status"`
+	Ref        string   `json:"ref"`
+	WebURL     string   `json:"web_url"`
+	Pipeline   Pipeline `json:"pipeline"`
+	CreatedAt  string   `json:"created_at"`
+	StartedAt  string   `json:"started_at"`
+	FinishedAt string   `json:"finished_at"`
+}
+
+type playJobRequest struct {
+	JobVariables []Variable `json:"job_variables_attributes,omitempty"`
+}
+
+// PlayJob starts a manual job, optionally overriding its variables.
+func (c *Client) PlayJob(ctx context.Context, jobID int, variables []Variable) (*Job, error) {
+	var job Job
+	if err := c.do(ctx, http.MethodPost, c.projectPath("/jobs/%d/play", jobID), playJobRequest{JobVariables: variables}, &job); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// RetryJob runs the job again and returns the new job.
+func (c *Client) RetryJob(ctx context.Context, jobID int) (*Job, error) {
+	var job Job
+	if err := c.do(ctx, http.MethodPost, c.projectPath("/jobs/%d/retry", jobID), nil, &job); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (c *Client) CancelJob(ctx context.Context, jobID int) (*Job, error) {
+	var job Job
+	if err := c.do(ctx, http.MethodPost, c.projectPath("/jobs/%d/cancel", jobID), nil, &job); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+func (c *Client) GetJob(ctx context.Context, jobID int) (*Job, error) {
+	var job Job
+	if err := c.do(ctx, http.MethodGet, c.projectPath("/jobs/%d", jobID), nil, &job); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// GetJobTrace returns the log of the job.
+func (c *Client) GetJobTrace(ctx context.Context, jobID int) (string, error) {
+	body, err := c.stream(ctx, http.MethodGet, c.projectPath("/jobs/%d/trace", jobID))
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	trace, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(trace), nil
+}
+
+// DownloadArtifacts returns the artifacts archive of the job as a zip stream.
+// The caller must close it.
+func (c *Client) DownloadArtifacts(ctx context.Context, jobID int) (io.ReadCloser, error) {
+	return c.stream(ctx, http.MethodGet, c.projectPath("/jobs/%d/artifacts", jobID))
+}
+
+// DownloadArtifactFile returns a single file from the artifacts archive of the job.
+// The caller must close it.
+func (c *Client) DownloadArtifactFile(ctx context.Context, jobID int, path string) (io.ReadCloser, error) {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return c.stream(ctx, http.MethodGet, c.projectPath("/jobs/%d/artifacts/%s", jobID, strings.Join(segments, "/")))
+}
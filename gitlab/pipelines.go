@@ -0,0 +1,44 @@
+package gitlab
+
+import (
+	"context"
+	"net/http"
+)
+
+type Variable struct {
+	Key          string `json:"key"`
+	Value        string `json:"value"`
+	VariableType string `json:"variable_type,omitempty"`
+}
+
+type PipelineRequest struct {
+	Ref       string     `json:"ref"`
+	Variables []Variable `json:"variables,omitempty"`
+}
+
+type Pipeline struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+	Ref    string `json:"ref"`
+	SHA    string `json:"sha"`
+	WebURL string `json:"web_url"`
+}
+
+// TriggerPipeline starts a new pipeline for the ref with the given variables.
+func (c *Client) TriggerPipeline(ctx context.Context, pipelineReq PipelineRequest) (*Pipeline, error) {
+	var pipeline Pipeline
+	if err := c.do(ctx, http.MethodPost, c.projectPath("/pipeline"), pipelineReq, &pipeline); err != nil {
+		return nil, err
+	}
+
+	return &pipeline, nil
+}
+
+func (c *Client) GetPipeline(ctx context.Context, pipelineID int) (*Pipeline, error) {
+	var pipeline Pipeline
+	if err := c.do(ctx, http.MethodGet, c.projectPath("/pipelines/%d", pipelineID), nil, &pipeline); err != nil {
+		return nil, err
+	}
+
+	return &pipeline, nil
+}
@@ -0,0 +1,23 @@
+package gitlab
+
+import (
+	"context"
+	"net/http"
+)
+
+type Project struct {
+	ID                int    `json:"id"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	DefaultBranch     string `json:"default_branch"`
+	WebURL            string `json:"web_url"`
+}
+
+// GetProject returns the project the client works on, which also proves the token can read it.
+func (c *Client) GetProject(ctx context.Context) (*Project, error) {
+	var project Project
+	if err := c.do(ctx, http.MethodGet, c.projectPath(""), nil, &project); err != nil {
+		return nil, err
+	}
+
+	return &project, nil
+}
@@ -0,0 +1,31 @@
+package gitlab
+
+import (
+	"context"
+	"net/http"
+)
+
+type ReleaseRequest struct {
+	TagName     string `json:"tag_name"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	Ref         string `json:"ref,omitempty"`
+}
+
+type Release struct {
+	TagName     string `json:"tag_name"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	CreatedAt   string `json:"created_at"`
+	ReleasedAt  string `json:"released_at"`
+}
+
+// CreateRelease creates a release for the tag. Ref is used to create the tag when it does not exist yet.
+func (c *Client) CreateRelease(ctx context.Context, releaseReq ReleaseRequest) (*Release, error) {
+	var release Release
+	if err := c.do(ctx, http.MethodPost, c.projectPath("/releases"), releaseReq, &release); err != nil {
+		return nil, err
+	}
+
+	return &release, nil
+}
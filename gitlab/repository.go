@@ -0,0 +1,102 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type File struct {
+	FileName     string `json:"file_name"`
+	FilePath     string `json:"file_path"`
+	Size         int    `json:"size"`
+	Encoding     string `json:"encoding"`
+	Content      string `json:"content"`
+	Ref          string `json:"ref"`
+	BlobID       string `json:"blob_id"`
+	CommitID     string `json:"commit_id"`
+	LastCommitID string `json:"last_commit_id"`
+}
+
+// Decoded returns the file content, decoding it when GitLab sent it as base64.
+func (f *File) Decoded() ([]byte, error) {
+	if f.Encoding != "base64" {
+		return []byte(f.Content), nil
+	}
+
+	return base64.StdEncoding.DecodeString(f.Content)
+}
+
+type CommitRequest struct {
+	Branch        string         `json:"branch"`
+	CommitMessage string         `json:"commit_message"`
+	StartBranch   string         `json:"start_branch,omitempty"`
+	AuthorName    string         `json:"author_name,omitempty"`
+	AuthorEmail   string         `json:"author_email,omitempty"`
+	Actions       []CommitAction `json:"actions"`
+}
+
+// CommitAction changes one file. Action is one of "create", "update", "delete", "move" or "chmod".
+type CommitAction struct {
+	Action       string `json:"action"`
+	FilePath     string `json:"file_path"`
+	PreviousPath string `json:"previous_path,omitempty"`
+	Content      string `json:"content,omitempty"`
+	Encoding     string `json:"encoding,omitempty"`
+}
+
+type Commit struct {
+	ID      string `json:"id"`
+	ShortID string `json:"short_id"`
+	Title   string `json:"title"`
+	WebURL  string `json:"web_url"`
+}
+
+type TagRequest struct {
+	TagName string `json:"tag_name"`
+	Ref     string `json:"ref"`
+	Message string `json:"message,omitempty"`
+}
+
+type Tag struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+	Target  string `json:"target"`
+	Commit  Commit `json:"commit"`
+}
+
+func (c *Client) GetFile(ctx context.Context, path string, ref string) (*File, error) {
+	query := url.Values{"ref": {ref}}
+
+	var file File
+	if err := c.do(ctx, http.MethodGet, c.projectPath("/repository/files/%s?%s", url.PathEscape(path), query.Encode()), nil, &file); err != nil {
+		return nil, err
+	}
+
+	return &file, nil
+}
+
+// CreateCommit commits several file changes at once.
+func (c *Client) CreateCommit(ctx context.Context, commitReq CommitRequest) (*Commit, error) {
+	if len(commitReq.Actions) == 0 {
+		return nil, fmt.Errorf("commit has no actions")
+	}
+
+	var commit Commit
+	if err := c.do(ctx, http.MethodPost, c.projectPath("/repository/commits"), commitReq, &commit); err != nil {
+		return nil, err
+	}
+
+	return &commit, nil
+}
+
+func (c *Client) CreateTag(ctx context.Context, tagReq TagRequest) (*Tag, error) {
+	var tag Tag
+	if err := c.do(ctx, http.MethodPost, c.projectPath("/repository/tags"), tagReq, &tag); err != nil {
+		return nil, err
+	}
+
+	return &tag, nil
+}
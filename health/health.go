@@ -0,0 +1,181 @@
+// Package health answers liveness and readiness probes. Readiness checks every dependency
+// the bot needs to move a release forward and reports each one, so that broken credentials
+// show up before a release does.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"pachca.com/android-deployment/config"
+	"pachca.com/android-deployment/gitlab"
+	"pachca.com/android-deployment/pachca"
+	"pachca.com/android-deployment/queue"
+	"pachca.com/android-deployment/release"
+)
+
+// checkTimeout bounds every check, so that a hanging dependency fails the probe instead of timing it out.
+const checkTimeout = 5 * time.Second
+
+// reportTTL is how long ReadyHandler serves a report before checking again, so that probes
+// of the public endpoint do not call the Pachca and Gitlab APIs on every hit.
+const reportTTL = 5 * time.Second
+
+// Statuses of a check and of the report.
+const (
+	StatusOK    string = "ok"
+	StatusError string = "error"
+)
+
+// Check reports whether a dependency works.
+type Check func(ctx context.Context) error
+
+// Result is the outcome of one check. The error is logged rather than served,
+// since the probe is public and errors can describe the deployment.
+type Result struct {
+	Status   string `json:"status"`
+	Error    string `json:"-"`
+	Duration string `json:"duration"`
+}
+
+// Report is the readiness of the bot, which is ok only when every check passed.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Checks returns the readiness checks of the bot: the configuration, the release store,
+// the queue when one is configured, and the Pachca and Gitlab APIs with the configured keys.
+func Checks(config *config.Config, client *http.Client) map[string]Check {
+	checks := map[string]Check{
+		"config": checkConfig,
+		"release_store": func(ctx context.Context) error {
+			return checkReleaseStore(ctx, config)
+		},
+		"pachca": func(ctx context.Context) error {
+			return checkPachca(ctx, config, client)
+		},
+		"gitlab": func(ctx context.Context) error {
+			gitlabClient := gitlab.NewClient(config.Gitlab.URL, config.Gitlab.Key, config.Gitlab.ProjectID, client)
+			_, err := gitlabClient.GetProject(ctx)
+			return err
+		},
+	}
+
+	if config.Queue.Store != "" {
+		checks["queue"] = func(ctx context.Context) error {
+			jobs, err := queue.Open(config.Queue.Store, config.Queue.Path)
+			if err != nil {
+				return err
+			}
+			_, err = jobs.DeadLetters(ctx)
+			return err
+		}
+	}
+
+	return checks
+}
+
+// checkConfig loads the configuration again, so that a config file broken since startup is reported.
+func checkConfig(ctx context.Context) error {
+	_, err := config.LoadFromEnv()
+	return err
+}
+
+func checkReleaseStore(ctx context.Context, config *config.Config) error {
+	store, err := release.OpenStore(config.Release.Store, config.Release.StorePath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := store.Get(ctx, 0); err != nil && !errors.Is(err, release.ErrNotFound) {
+		return err
+	}
+	return nil
+}
+
+func checkPachca(ctx context.Context, config *config.Config, client *http.Client) error {
+	// A probe is repeated by the monitor, so one attempt is enough.
+	policy := config.Pachca.RetryPolicy()
+	policy.MaxAttempts = 1
+
+	pachcaClient := pachca.NewClient(config.Pachca.URL, config.Pachca.Key, client, pachca.WithRetryPolicy(policy))
+	_, err := pachcaClient.GetProfile(ctx)
+	return err
+}
+
+// Run runs the checks concurrently.
+func Run(ctx context.Context, checks map[string]Check) Report {
+	report := Report{Status: StatusOK, Checks: make(map[string]Result, len(checks))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			started := time.Now()
+			err := check(ctx)
+			result := Result{Status: StatusOK, Duration: time.Since(started).Round(time.Millisecond).String()}
+			if err != nil {
+				result.Status = StatusError
+				result.Error = err.Error()
+				slog.WarnContext(ctx, "Readiness check failed", "check", name, "error", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if err != nil {
+				report.Status = StatusError
+			}
+		})
+	}
+	wg.Wait()
+
+	return report
+}
+
+// LiveHandler answers while the process serves requests.
+func LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": StatusOK})
+	})
+}
+
+// ReadyHandler runs the checks and answers 503 when any of them fails. The report is reused
+// for reportTTL, and probes that arrive while the checks run wait for their report.
+func ReadyHandler(checks map[string]Check) http.Handler {
+	var mu sync.Mutex
+	var cached Report
+	var checked time.Time
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if time.Since(checked) >= reportTTL {
+			// A probe that hangs up does not fail the report the next probes get.
+			cached, checked = Run(context.WithoutCancel(r.Context()), checks), time.Now()
+		}
+		report := cached
+		mu.Unlock()
+
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,162 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"pachca.com/android-deployment/config"
+	"pachca.com/android-deployment/shared"
+)
+
+func TestReadyReportsEveryDependency(t *testing.T) {
+	tests := []struct {
+		name           string
+		gitlabStatus   int
+		expectedStatus int
+		expectedChecks map[string]string
+	}{
+		{
+			name:           "all dependencies work",
+			gitlabStatus:   http.StatusOK,
+			expectedStatus: http.StatusOK,
+			expectedChecks: map[string]string{"config": StatusOK, "release_store": StatusOK, "pachca": StatusOK, "gitlab": StatusOK},
+		},
+		{
+			name:           "gitlab token revoked",
+			gitlabStatus:   http.StatusUnauthorized,
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedChecks: map[string]string{"config": StatusOK, "release_store": StatusOK, "pachca": StatusOK, "gitlab": StatusError},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/profile":
+					if r.Header.Get("Authorization") != "Bearer test-api-key" {
+						t.Errorf("Expected Pachca API key, got '%s'", r.Header.Get("Authorization"))
+					}
+					json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"id": 1, "first_name": "Release bot"}})
+				case "/projects/42":
+					w.WriteHeader(tt.gitlabStatus)
+					json.NewEncoder(w).Encode(map[string]any{"id": 42, "message": "401 Unauthorized"})
+				default:
+					t.Errorf("Unexpected path: %s", r.URL.Path)
+				}
+			}))
+			defer mockAPI.Close()
+
+			t.Setenv(shared.EnvPachcaUrl, mockAPI.URL)
+			t.Setenv(shared.EnvPachcaKey, "test-api-key")
+			t.Setenv(shared.EnvPachcaInternalChatId, "198")
+			t.Setenv(shared.EnvPachcaSigningSecret, "test-signing-secret")
+			t.Setenv(shared.EnvGitlabUrl, mockAPI.URL)
+			t.Setenv(shared.EnvGitlabKey, "test-gitlab-key")
+			t.Setenv(shared.EnvGitlabProjectId, "42")
+			t.Setenv(shared.EnvGitlabRef, "release")
+			t.Setenv(shared.EnvGitlabWebhookToken, "test-webhook-token")
+			t.Setenv(shared.EnvReleaseSigningKey, "test-release-key")
+			t.Setenv(shared.EnvReleaseStore, "file")
+			t.Setenv(shared.EnvReleaseStorePath, filepath.Join(t.TempDir(), "releases.json"))
+			t.Setenv(shared.EnvAuditStore, "memory")
+
+			config, err := config.LoadFromEnv()
+			if err != nil {
+				t.Fatalf("Config error: %v", err)
+			}
+
+			w := httptest.NewRecorder()
+			ReadyHandler(Checks(config, mockAPI.Client())).ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+
+			if w.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, w.Code)
+			}
+
+			body := w.Body.String()
+			var report Report
+			if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+				t.Fatalf("Expected JSON report, got %v", err)
+			}
+			for name, status := range tt.expectedChecks {
+				if report.Checks[name].Status != status {
+					t.Errorf("Expected %s check %s, got %+v", name, status, report.Checks[name])
+				}
+			}
+			if len(report.Checks) != len(tt.expectedChecks) {
+				t.Errorf("Expected %d checks, got %v", len(tt.expectedChecks), report.Checks)
+			}
+			if strings.Contains(body, "Unauthorized") || strings.Contains(body, `"error":"`) {
+				t.Errorf("Expected no error detail in the public report, got %s", body)
+			}
+		})
+	}
+}
+
+func TestReadyReusesRecentReport(t *testing.T) {
+	var calls atomic.Int32
+	handler := ReadyHandler(map[string]Check{
+		"pachca": func(ctx context.Context) error {
+			calls.Add(1)
+			return nil
+		},
+	})
+
+	for range 3 {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200, got %d", w.Code)
+		}
+	}
+
+	if calls.Load() != 1 {
+		t.Errorf("Expected 1 check within %s, got %d", reportTTL, calls.Load())
+	}
+}
+
+func TestReadyReportsBrokenConfig(t *testing.T) {
+	t.Setenv(shared.EnvPachcaUrl, "")
+
+	report := Run(context.Background(), map[string]Check{"config": checkConfig})
+
+	if report.Status != StatusError || report.Checks["config"].Error == "" {
+		t.Errorf("Expected config check to fail with detail, got %+v", report)
+	}
+}
+
+func TestRunTimesOutHangingChecks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	report := Run(ctx, map[string]Check{
+		"hanging": func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		"fine": func(ctx context.Context) error { return nil },
+	})
+
+	if report.Checks["hanging"].Error != context.DeadlineExceeded.Error() {
+		t.Errorf("Expected hanging check to fail, got %+v", report.Checks["hanging"])
+	}
+	if report.Checks["fine"].Status != StatusOK || report.Status != StatusError {
+		t.Errorf("Expected only the hanging check to fail the report, got %+v", report)
+	}
+}
+
+func TestLiveAnswersOK(t *testing.T) {
+	w := httptest.NewRecorder()
+	LiveHandler().ServeHTTP(w, httptest.NewRequest("GET", "/healthz", nil))
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected 200 with JSON, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+}
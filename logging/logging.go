@@ -0,0 +1,130 @@
+// Package logging sets up structured logs for the release bot. Fields that identify a webhook,
+// such as the request ID and version code, travel in the context and are added to every record.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync/atomic"
+)
+
+// Options are the logging settings of the config file.
+type Options struct {
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level" toml:"level"`
+	// Format is text or json.
+	Format string `yaml:"format" toml:"format"`
+	// DumpPayloads logs webhook and API payloads in full instead of redacted.
+	DumpPayloads bool `yaml:"dump_payloads" toml:"dump_payloads"`
+}
+
+// Validate reports a level or format that Setup would not understand.
+func (o Options) Validate() error {
+	if _, err := parseLevel(o.Level); err != nil {
+		return err
+	}
+	switch o.Format {
+	case "", "text", "json":
+		return nil
+	default:
+		return fmt.Errorf("unknown log format %q", o.Format)
+	}
+}
+
+var dumpPayloads atomic.Bool
+
+// Setup makes a logger with the options the default for slog and the log package.
+func Setup(options Options) error {
+	logger, err := New(os.Stderr, options)
+	if err != nil {
+		return err
+	}
+
+	slog.SetDefault(logger)
+	dumpPayloads.Store(options.DumpPayloads)
+	return nil
+}
+
+// New returns a logger writing to w that adds the fields of the context to every record.
+func New(w io.Writer, options Options) (*slog.Logger, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
+	}
+
+	level, _ := parseLevel(options.Level)
+	handlerOptions := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if options.Format == "json" {
+		handler = slog.NewJSONHandler(w, handlerOptions)
+	} else {
+		handler = slog.NewTextHandler(w, handlerOptions)
+	}
+
+	return slog.New(contextHandler{handler}), nil
+}
+
+func parseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if value == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", value)
+	}
+	return level, nil
+}
+
+type contextKey struct{}
+
+// With returns a context whose log records carry the given key-value pairs.
+func With(ctx context.Context, args ...any) context.Context {
+	attrs, _ := ctx.Value(contextKey{}).([]slog.Attr)
+	attrs = attrs[:len(attrs):len(attrs)]
+
+	var record slog.Record
+	record.Add(args...)
+	record.Attrs(func(attr slog.Attr) bool {
+		attrs = append(attrs, attr)
+		return true
+	})
+
+	return context.WithValue(ctx, contextKey{}, attrs)
+}
+
+// WithRequestID tags the context with the request ID the caller sent, or a new one.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	if requestID == "" {
+		id := make([]byte, 8)
+		rand.Read(id)
+		requestID = hex.EncodeToString(id)
+	}
+
+	return With(ctx, "request_id", requestID)
+}
+
+// contextHandler adds the fields stored in the context to every record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs, ok := ctx.Value(contextKey{}).([]slog.Attr); ok {
+		record = record.Clone()
+		record.AddAttrs(attrs...)
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
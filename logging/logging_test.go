@@ -0,0 +1,133 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestLoggerAddsContextFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Options{Format: "json"})
+	if err != nil {
+		t.Fatalf("Expected logger, got %v", err)
+	}
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	ctx = With(ctx, "version_code", 42, "user_id", 7)
+	With(ctx, "action", "promote")
+	logger.InfoContext(ctx, "Processed", "event", "build")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Expected JSON record, got %q: %v", buf.String(), err)
+	}
+	want := map[string]any{"request_id": "req-1", "version_code": 42.0, "user_id": 7.0, "event": "build"}
+	for key, value := range want {
+		if record[key] != value {
+			t.Errorf("Expected %s=%v, got %v", key, value, record[key])
+		}
+	}
+	if _, ok := record["action"]; ok {
+		t.Errorf("Expected no action from a context the record was not logged with, got %v", record)
+	}
+}
+
+func TestWithRequestIDGeneratesID(t *testing.T) {
+	first, _ := WithRequestID(context.Background(), "").Value(contextKey{}).([]slog.Attr)
+	second, _ := WithRequestID(context.Background(), "").Value(contextKey{}).([]slog.Attr)
+	if len(first) != 1 || first[0].Value.String() == "" {
+		t.Fatalf("Expected a generated request_id, got %v", first)
+	}
+	if first[0].Value.String() == second[0].Value.String() {
+		t.Errorf("Expected distinct request IDs, got %s twice", first[0].Value)
+	}
+}
+
+func TestLoggerFiltersLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, Options{Level: "warn"})
+	if err != nil {
+		t.Fatalf("Expected logger, got %v", err)
+	}
+
+	logger.Info("quiet")
+	logger.Warn("loud")
+
+	if strings.Contains(buf.String(), "quiet") || !strings.Contains(buf.String(), "loud") {
+		t.Errorf("Expected only the warning, got %q", buf.String())
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	if err := (Options{Level: "DEBUG", Format: "text"}).Validate(); err != nil {
+		t.Errorf("Expected valid options, got %v", err)
+	}
+	if err := (Options{Level: "verbose"}).Validate(); err == nil {
+		t.Error("Expected unknown level to be rejected")
+	}
+	if err := (Options{Format: "xml"}).Validate(); err == nil {
+		t.Error("Expected unknown format to be rejected")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	body := `{"type":"button","data":"signed","user_id":7,"message":{"content":"hi","id":3},` +
+		`"variables":[{"key":"RELEASE_NOTES","value":"notes"},{"key":"ROLLOUT","value":"10"},` +
+		`{"key":"RELEASE_NOTES_EN_US","value":"notes"}],` +
+		`"data_object":{"token":"t"}}`
+
+	var got map[string]any
+	if err := json.Unmarshal([]byte(Redact([]byte(body))), &got); err != nil {
+		t.Fatalf("Expected redacted JSON, got %v", err)
+	}
+	want := map[string]any{
+		"type":    "button",
+		"data":    redacted,
+		"user_id": 7.0,
+		"message": map[string]any{"content": redacted, "id": 3.0},
+		"variables": []any{
+			map[string]any{"key": "RELEASE_NOTES", "value": redacted},
+			map[string]any{"key": "ROLLOUT", "value": "10"},
+			map[string]any{"key": "RELEASE_NOTES_EN_US", "value": redacted},
+		},
+		"data_object": map[string]any{"token": redacted},
+	}
+	gotJSON, _ := json.Marshal(got)
+	wantJSON, _ := json.Marshal(want)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("Expected %s, got %s", wantJSON, gotJSON)
+	}
+
+	if got := Redact([]byte("token=secret")); got != redacted {
+		t.Errorf("Expected non-JSON body to be %q, got %q", redacted, got)
+	}
+}
+
+func TestPayloadDumpsOnlyWhenEnabled(t *testing.T) {
+	previous := slog.Default()
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+		dumpPayloads.Store(false)
+	})
+
+	body := []byte(`{"content":"release notes"}`)
+	for _, dump := range []bool{false, true} {
+		var buf bytes.Buffer
+		logger, err := New(&buf, Options{Level: "debug"})
+		if err != nil {
+			t.Fatalf("Expected logger, got %v", err)
+		}
+		slog.SetDefault(logger)
+		dumpPayloads.Store(dump)
+
+		Payload(context.Background(), "Incoming payload", body)
+
+		if got := strings.Contains(buf.String(), "release notes"); got != dump {
+			t.Errorf("Expected notes in output only when dumping (dump=%v), got %q", dump, buf.String())
+		}
+	}
+}
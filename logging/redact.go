@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys name JSON fields that carry secrets, signed data or text written by people.
+var sensitiveKeys = map[string]bool{
+	"content":          true,
+	"release_notes":    true,
+	"private_metadata": true,
+	"trigger_id":       true,
+	"token":            true,
+	"secret":           true,
+	"signing_secret":   true,
+	"password":         true,
+	"email":            true,
+	"phone_number":     true,
+	"first_name":       true,
+	"last_name":        true,
+	"nickname":         true,
+	"x-amz-signature":  true,
+	"x-amz-credential": true,
+	"policy":           true,
+}
+
+// Payload logs a webhook or API payload at debug level, redacted unless payload dumps are enabled.
+func Payload(ctx context.Context, msg string, body []byte, args ...any) {
+	if !slog.Default().Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	payload := string(body)
+	if !dumpPayloads.Load() {
+		payload = Redact(body)
+	}
+	slog.DebugContext(ctx, msg, append(args, "payload", payload)...)
+}
+
+// Redact replaces the values of sensitive fields in a JSON document. String values of "data",
+// such as signed button data, are redacted too, while "data" objects are searched.
+// Values of variables named after a sensitive field are redacted as well.
+// A body that is not JSON is replaced entirely.
+func Redact(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var document any
+	if err := json.Unmarshal(body, &document); err != nil {
+		return redacted
+	}
+
+	redactedBody, _ := json.Marshal(redactValue(document))
+	return string(redactedBody)
+}
+
+// isSensitive also matches the release notes of each locale, like release_notes_en-US.
+func isSensitive(key string) bool {
+	key = strings.ToLower(key)
+	return sensitiveKeys[key] || strings.HasPrefix(key, "release_notes")
+}
+
+func redactValue(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		// Gitlab variables name the field in "key", like {"key": "RELEASE_NOTES", "value": "..."}.
+		if name, ok := value["key"].(string); ok && isSensitive(name) {
+			if _, ok := value["value"]; ok {
+				value["value"] = redacted
+			}
+		}
+		for key, field := range value {
+			_, isString := field.(string)
+			if isSensitive(key) || (key == "data" && isString) {
+				value[key] = redacted
+				continue
+			}
+			value[key] = redactValue(field)
+		}
+		return value
+	case []any:
+		for i, item := range value {
+			value[i] = redactValue(item)
+		}
+		return value
+	default:
+		return value
+	}
+}
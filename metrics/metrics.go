@@ -0,0 +1,129 @@
+// Package metrics records what the release bot does for Prometheus: the webhooks it receives,
+// the calls it makes to Pachca and Gitlab, and where releases are in their lifecycle.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Services the bot receives webhooks from and calls.
+const (
+	ServicePachca string = "pachca"
+	ServiceGitlab string = "gitlab"
+)
+
+// Registry holds the metrics of the bot along with the Go runtime and process metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	webhooks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "release_bot_webhooks_total",
+		Help: "Incoming webhooks by source, type, release action, pipeline result and outcome.",
+	}, []string{"source", "type", "action", "result", "outcome"})
+
+	calls = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "release_bot_outgoing_request_duration_seconds",
+		Help:    "Latency of calls to Pachca and Gitlab by service, method and status.",
+		Buckets: []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"service", "method", "status"})
+)
+
+func init() {
+	Registry.MustRegister(
+		webhooks,
+		calls,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveCall records a call to service that started at started. The status is
+// the HTTP status code, or "error" when no response came back.
+func ObserveCall(service string, method string, started time.Time, statusCode int, err error) {
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(statusCode)
+	}
+	calls.WithLabelValues(service, method, status).Observe(time.Since(started).Seconds())
+}
+
+// Webhook counts an incoming webhook by the status its handler answered with.
+// Handlers write the response through it and call Done when they return.
+type Webhook struct {
+	http.ResponseWriter
+	// Type is the kind of webhook, known once the payload is parsed.
+	Type string
+	// Action is the release action the webhook is about, such as promote, once it is known to be valid.
+	Action string
+	// Result is the result of the pipeline a Gitlab webhook reports, success or failed.
+	Result string
+
+	source string
+	status int
+}
+
+func NewWebhook(w http.ResponseWriter, source string) *Webhook {
+	return &Webhook{ResponseWriter: w, Type: "unknown", source: source}
+}
+
+func (w *Webhook) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *Webhook) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Status is the status the handler answered with.
+func (w *Webhook) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// Done counts the webhook.
+func (w *Webhook) Done() {
+	webhooks.WithLabelValues(w.source, w.Type, w.Action, w.Result, outcome(w.Status())).Inc()
+}
+
+// SetAction labels the webhook that w writes the response of with the release action.
+func SetAction(w http.ResponseWriter, action string) {
+	if webhook, ok := w.(*Webhook); ok {
+		webhook.Action = action
+	}
+}
+
+func outcome(status int) string {
+	switch {
+	case status == http.StatusOK:
+		return "ok"
+	case status == http.StatusAccepted:
+		return "queued"
+	case status == http.StatusConflict:
+		return "conflict"
+	case status >= 500:
+		return "error"
+	case status >= 400:
+		return "rejected"
+	default:
+		return "ok"
+	}
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"pachca.com/android-deployment/release"
+)
+
+func TestWebhookCountsOutcome(t *testing.T) {
+	tests := []struct {
+		status  int
+		outcome string
+	}{
+		{status: 0, outcome: "ok"},
+		{status: http.StatusOK, outcome: "ok"},
+		{status: http.StatusAccepted, outcome: "queued"},
+		{status: http.StatusConflict, outcome: "conflict"},
+		{status: http.StatusUnauthorized, outcome: "rejected"},
+		{status: http.StatusInternalServerError, outcome: "error"},
+	}
+
+	for _, tt := range tests {
+		counter := webhooks.WithLabelValues("test", "outcome", "", "", tt.outcome)
+		before := testutil.ToFloat64(counter)
+
+		webhook := NewWebhook(httptest.NewRecorder(), "test")
+		webhook.Type = "outcome"
+		if tt.status != 0 {
+			webhook.WriteHeader(tt.status)
+		}
+		webhook.Done()
+
+		if got := testutil.ToFloat64(counter) - before; got != 1 {
+			t.Errorf("Expected status %d to count one %s webhook, got %v", tt.status, tt.outcome, got)
+		}
+	}
+}
+
+func TestObserveCallLabelsStatus(t *testing.T) {
+	ObserveCall("test", http.MethodGet, time.Now(), http.StatusOK, nil)
+	ObserveCall("test", http.MethodGet, time.Now(), 0, errors.New("connection refused"))
+
+	for _, status := range []string{"200", "error"} {
+		observer := calls.WithLabelValues("test", http.MethodGet, status).(prometheus.Histogram)
+		if count := testutil.CollectAndCount(observer); count != 1 {
+			t.Errorf("Expected a %s histogram, got %d", status, count)
+		}
+	}
+}
+
+func TestReleaseCollector(t *testing.T) {
+	ctx := context.Background()
+	store := release.NewMemoryStore()
+	for _, r := range []release.Release{
+		{VersionCode: 1001, VersionName: "1.0.1", State: release.StateDone, Track: release.TrackProduction, RolloutPercentage: 100},
+		{VersionCode: 1002, VersionName: "1.0.2", State: release.StateProductionInProgress, Track: release.TrackProduction, RolloutPercentage: 25},
+		{VersionCode: 1003, VersionName: "1.0.3", State: release.StateInternal, Track: release.TrackInternal},
+	} {
+		if _, err := store.Update(ctx, r.VersionCode, func(stored *release.Release) error {
+			*stored = r
+			return nil
+		}); err != nil {
+			t.Fatalf("Failed to seed release: %v", err)
+		}
+	}
+
+	expected := `
+# HELP release_bot_production_rollout_percentage Percentage of production users the newest production release is rolled out to.
+# TYPE release_bot_production_rollout_percentage gauge
+release_bot_production_rollout_percentage{state="production_in_progress",version_code="1002",version_name="1.0.2"} 25
+# HELP release_bot_releases Releases in each lifecycle state.
+# TYPE release_bot_releases gauge
+release_bot_releases{state="done"} 1
+release_bot_releases{state="failed"} 0
+release_bot_releases{state="halted"} 0
+release_bot_releases{state="internal"} 1
+release_bot_releases{state="production_complete"} 0
+release_bot_releases{state="production_in_progress"} 1
+release_bot_releases{state="releasing_other_stores"} 0
+`
+	if err := testutil.CollectAndCompare(releaseCollector{store}, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
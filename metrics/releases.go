@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pachca.com/android-deployment/release"
+)
+
+// scrapeTimeout bounds the time a scrape waits for the release store.
+const scrapeTimeout = 5 * time.Second
+
+var (
+	releasesDesc = prometheus.NewDesc(
+		"release_bot_releases",
+		"Releases in each lifecycle state.",
+		[]string{"state"}, nil,
+	)
+	rolloutDesc = prometheus.NewDesc(
+		"release_bot_production_rollout_percentage",
+		"Percentage of production users the newest production release is rolled out to.",
+		[]string{"version_code", "version_name", "state"}, nil,
+	)
+)
+
+// releaseCollector reads the release store at every scrape, so that the gauges
+// agree with the store however many processes update it.
+type releaseCollector struct {
+	store release.Store
+}
+
+// RegisterReleases reports the releases in store with the metrics of the bot.
+func RegisterReleases(store release.Store) error {
+	return Registry.Register(releaseCollector{store})
+}
+
+func (c releaseCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- releasesDesc
+	ch <- rolloutDesc
+}
+
+func (c releaseCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+
+	releases, err := c.store.List(ctx)
+	if err != nil {
+		slog.Error("Error listing releases for metrics", "error", err)
+		ch <- prometheus.NewInvalidMetric(releasesDesc, err)
+		return
+	}
+
+	counts := make(map[release.State]int, len(release.States))
+	var production *release.Release
+	for _, r := range releases {
+		counts[r.State]++
+		if r.Track == release.TrackProduction && (production == nil || r.VersionCode > production.VersionCode) {
+			production = r
+		}
+	}
+
+	for _, state := range release.States {
+		ch <- prometheus.MustNewConstMetric(releasesDesc, prometheus.GaugeValue, float64(counts[state]), string(state))
+	}
+
+	if production != nil {
+		ch <- prometheus.MustNewConstMetric(rolloutDesc, prometheus.GaugeValue, float64(production.RolloutPercentage),
+			strconv.Itoa(production.VersionCode), production.VersionName, string(production.State))
+	}
+}
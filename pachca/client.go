@@ -0,0 +1,176 @@
+// Package pachca is a client for the Pachca API used by the release bot.
+package pachca
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"pachca.com/android-deployment/logging"
+	"pachca.com/android-deployment/metrics"
+	"pachca.com/android-deployment/tracing"
+)
+
+type Client struct {
+	baseURL    string
+	apiKey     string
+	httpClient *http.Client
+	retry      RetryPolicy
+}
+
+func NewClient(baseURL string, apiKey string, httpClient *http.Client, options ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		apiKey:     apiKey,
+		httpClient: httpClient,
+		retry:      DefaultRetryPolicy,
+	}
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
+}
+
+// APIError is returned for non-2xx responses. Pachca reports validation problems
+// as a list of errors and authorization problems as an OAuth style error.
+type APIError struct {
+	StatusCode       int           `json:"-"`
+	Errors           []ErrorDetail `json:"errors"`
+	ErrorCode        string        `json:"error"`
+	ErrorDescription string        `json:"error_description"`
+	// RetryAfter is how long Pachca asked to wait before calling again after 429.
+	RetryAfter time.Duration `json:"-"`
+}
+
+type ErrorDetail struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Code    string `json:"code"`
+	Payload any    `json:"payload"`
+}
+
+func (e *APIError) Error() string {
+	var details []string
+	for _, detail := range e.Errors {
+		details = append(details, fmt.Sprintf("%s: %s", detail.Key, detail.Value))
+	}
+	if e.ErrorCode != "" {
+		details = append(details, fmt.Sprintf("%s: %s", e.ErrorCode, e.ErrorDescription))
+	}
+
+	if len(details) == 0 {
+		return fmt.Sprintf("Pachca API returned status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("Pachca API returned status %d: %s", e.StatusCode, strings.Join(details, "; "))
+}
+
+// do sends a JSON request and decodes a JSON response into out, when both are present.
+// GET, PUT and DELETE requests are idempotent and retried on any transient failure.
+func (c *Client) do(ctx context.Context, method string, path string, in any, out any) error {
+	return c.doRetrying(ctx, method, path, in, out, method != http.MethodPost)
+}
+
+// doIdempotent is do for POST requests that can be repeated without effect, such as pinning.
+func (c *Client) doIdempotent(ctx context.Context, method string, path string, in any, out any) error {
+	return c.doRetrying(ctx, method, path, in, out, true)
+}
+
+func (c *Client) doRetrying(ctx context.Context, method string, path string, in any, out any, idempotent bool) error {
+	var payloadBytes []byte
+	if in != nil {
+		var err error
+		payloadBytes, err = json.Marshal(in)
+		if err != nil {
+			return err
+		}
+
+		logging.Payload(ctx, "Outgoing Pachca request", payloadBytes, "method", method, "path", path)
+	}
+
+	if c.retry.Budget > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.retry.Budget)
+		defer cancel()
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := c.send(ctx, method, path, payloadBytes, out)
+		if err == nil {
+			return nil
+		}
+
+		delay, retry := c.retry.retryDelay(ctx, err, attempt, idempotent)
+		if !retry {
+			return err
+		}
+
+		slog.WarnContext(ctx, "Pachca call failed, retrying", "method", method, "path", path, "attempt", attempt, "delay", delay, "error", err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// send makes a single attempt of a request within the per-call timeout.
+func (c *Client) send(ctx context.Context, method string, path string, payloadBytes []byte, out any) error {
+	if c.retry.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.retry.Timeout)
+		defer cancel()
+	}
+
+	var body io.Reader
+	if payloadBytes != nil {
+		body = bytes.NewReader(payloadBytes)
+	}
+
+	ctx, span := tracing.StartCall(ctx, metrics.ServicePachca, method, path)
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		tracing.End(span, err)
+		return err
+	}
+
+	if payloadBytes != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+
+	started := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		metrics.ObserveCall(metrics.ServicePachca, method, started, 0, err)
+		tracing.EndCall(span, 0, err)
+		return err
+	}
+	defer resp.Body.Close()
+	metrics.ObserveCall(metrics.ServicePachca, method, started, resp.StatusCode, nil)
+	tracing.EndCall(span, resp.StatusCode, nil)
+
+	respBody, _ := io.ReadAll(resp.Body)
+	logging.Payload(ctx, "Pachca response", respBody, "method", method, "path", path, "status", resp.StatusCode)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+		json.Unmarshal(respBody, apiErr)
+		return apiErr
+	}
+
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(respBody, out)
+}
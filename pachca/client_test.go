@@ -0,0 +1,239 @@
+package pachca
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientCreatesMessage(t *testing.T) {
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/messages" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-api-key" {
+			t.Errorf("Expected bearer authorization, got '%s'", r.Header.Get("Authorization"))
+		}
+
+		var messageReq MessageCreateRequest
+		json.NewDecoder(r.Body).Decode(&messageReq)
+		if messageReq.Message.EntityID != 198 {
+			t.Errorf("Expected entity_id 198, got %d", messageReq.Message.EntityID)
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": map[string]any{"id": 194275, "chat_id": 198, "content": messageReq.Message.Content},
+		})
+	}))
+	defer mockPachca.Close()
+
+	client := NewClient(mockPachca.URL, "test-api-key", mockPachca.Client())
+
+	message, err := client.CreateMessage(context.Background(), MessageCreateRequest{
+		Message: NewMessage{EntityType: "discussion", EntityID: 198, Content: "Hello"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if message.ID != 194275 {
+		t.Errorf("Expected message id 194275, got %d", message.ID)
+	}
+	if message.Content != "Hello" {
+		t.Errorf("Expected content 'Hello', got '%s'", message.Content)
+	}
+}
+
+func TestClientEditMessageRemovesButtons(t *testing.T) {
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"buttons":[]`) {
+			t.Errorf("Expected empty buttons list, got %s", string(body))
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer mockPachca.Close()
+
+	client := NewClient(mockPachca.URL, "test-api-key", mockPachca.Client())
+
+	_, err := client.EditMessage(context.Background(), 194275, MessageUpdateRequest{
+		Message: MessageUpdate{Content: "Done"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+}
+
+func TestClientDecodesAPIErrors(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int
+		body            string
+		expectedMessage string
+	}{
+		{
+			name:            "validation errors",
+			status:          http.StatusBadRequest,
+			body:            `{"errors":[{"key":"content","value":"can't be blank","code":"blank","payload":null}]}`,
+			expectedMessage: "Pachca API returned status 400: content: can't be blank",
+		},
+		{
+			name:            "oauth error",
+			status:          http.StatusUnauthorized,
+			body:            `{"error":"invalid_token","error_description":"Access token is invalid"}`,
+			expectedMessage: "Pachca API returned status 401: invalid_token: Access token is invalid",
+		},
+		{
+			name:            "empty body",
+			status:          http.StatusBadGateway,
+			body:            ``,
+			expectedMessage: "Pachca API returned status 502",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer mockPachca.Close()
+
+			client := NewClient(mockPachca.URL, "test-api-key", mockPachca.Client())
+
+			err := client.PinMessage(context.Background(), 194275)
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("Expected APIError, got %v", err)
+			}
+			if apiErr.StatusCode != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, apiErr.StatusCode)
+			}
+			if apiErr.Error() != tt.expectedMessage {
+				t.Errorf("Expected message '%s', got '%s'", tt.expectedMessage, apiErr.Error())
+			}
+		})
+	}
+}
+
+func TestClientUploadsFile(t *testing.T) {
+	var mockPachca *httptest.Server
+	mockPachca = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/uploads":
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{
+				"Content-Disposition": "attachment",
+				"acl":                 "private",
+				"policy":              "test-policy",
+				"x-amz-credential":    "test-credential",
+				"x-amz-algorithm":     "AWS4-HMAC-SHA256",
+				"x-amz-date":          "20261016T000000Z",
+				"x-amz-signature":     "test-signature",
+				"key":                 "attaches/files/1/${filename}",
+				"direct_url":          mockPachca.URL + "/direct_upload",
+			})
+		case "/direct_upload":
+			if r.Header.Get("Authorization") != "" {
+				t.Error("Expected direct upload without API authorization")
+			}
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				t.Errorf("Failed to parse multipart form: %v", err)
+			}
+			if r.FormValue("policy") != "test-policy" {
+				t.Errorf("Expected policy 'test-policy', got '%s'", r.FormValue("policy"))
+			}
+			file, header, err := r.FormFile("file")
+			if err != nil {
+				t.Errorf("Expected file part: %v", err)
+			} else {
+				content, _ := io.ReadAll(file)
+				if string(content) != "release notes" || header.Filename != "notes.txt" {
+					t.Errorf("Unexpected file %s: %s", header.Filename, string(content))
+				}
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	client := NewClient(mockPachca.URL, "test-api-key", mockPachca.Client())
+
+	file, err := client.UploadFile(context.Background(), "notes.txt", "file", strings.NewReader("release notes"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if file.Key != "attaches/files/1/notes.txt" {
+		t.Errorf("Expected key 'attaches/files/1/notes.txt', got '%s'", file.Key)
+	}
+	if file.Size != int64(len("release notes")) {
+		t.Errorf("Expected size %d, got %d", len("release notes"), file.Size)
+	}
+}
+
+func TestClientBoundsDirectUpload(t *testing.T) {
+	var mockPachca *httptest.Server
+	mockPachca = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/uploads":
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]any{
+				"key":        "attaches/files/1/${filename}",
+				"direct_url": mockPachca.URL + "/direct_upload",
+			})
+		case "/direct_upload":
+			time.Sleep(200 * time.Millisecond)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer mockPachca.Close()
+
+	policy := DefaultRetryPolicy
+	policy.Timeout = 50 * time.Millisecond
+	client := NewClient(mockPachca.URL, "test-api-key", mockPachca.Client(), WithRetryPolicy(policy))
+
+	_, err := client.UploadFile(context.Background(), "notes.txt", "file", strings.NewReader("release notes"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the direct upload to time out, got %v", err)
+	}
+}
+
+func TestClientListsUsers(t *testing.T) {
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/users" {
+			t.Errorf("Unexpected path: %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("query") != "anna" || r.URL.Query().Get("limit") != "10" {
+			t.Errorf("Unexpected query: %s", r.URL.RawQuery)
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"data": []map[string]any{{"id": 123, "first_name": "Anna"}},
+			"meta": map[string]any{"paginate": map[string]any{"next_page": "cursor-2"}},
+		})
+	}))
+	defer mockPachca.Close()
+
+	client := NewClient(mockPachca.URL, "test-api-key", mockPachca.Client())
+
+	users, err := client.ListUsers(context.Background(), ListUsersOptions{Query: "anna", Limit: 10})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(users.Users) != 1 || users.Users[0].ID != 123 {
+		t.Errorf("Expected user 123, got %v", users.Users)
+	}
+	if users.NextCursor != "cursor-2" {
+		t.Errorf("Expected next cursor 'cursor-2', got '%s'", users.NextCursor)
+	}
+}
@@ -0,0 +1,111 @@
+package pachca
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+type Message struct {
+	ID              int        `json:"id"`
+	EntityType      string     `json:"entity_type"`
+	EntityID        int        `json:"entity_id"`
+	ChatID          int        `json:"chat_id"`
+	Content         string     `json:"content"`
+	UserID          int        `json:"user_id"`
+	CreatedAt       string     `json:"created_at"`
+	Files           []File     `json:"files"`
+	Buttons         [][]Button `json:"buttons"`
+	ThreadID        int        `json:"thread_id"`
+	ParentMessageID int        `json:"parent_message_id"`
+}
+
+type Button struct {
+	Text string `json:"text"`
+	Data string `json:"data,omitempty"`
+	URL  string `json:"url,omitempty"`
+}
+
+type MessageCreateRequest struct {
+	Message NewMessage `json:"message"`
+}
+
+type NewMessage struct {
+	EntityType      string       `json:"entity_type"`
+	EntityID        int          `json:"entity_id"`
+	Content         string       `json:"content"`
+	Files           []FileParams `json:"files,omitempty"`
+	Buttons         [][]Button   `json:"buttons,omitempty"`
+	ParentMessageID int          `json:"parent_message_id,omitempty"`
+}
+
+type MessageUpdateRequest struct {
+	Message MessageUpdate `json:"message"`
+}
+
+// MessageUpdate replaces the content and buttons of a message.
+// An empty Buttons list removes the buttons from the message.
+type MessageUpdate struct {
+	Content string       `json:"content"`
+	Files   []FileParams `json:"files,omitempty"`
+	Buttons [][]Button   `json:"buttons"`
+}
+
+type Thread struct {
+	ID        int    `json:"id"`
+	ChatID    int    `json:"chat_id"`
+	MessageID int    `json:"message_id"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type messageResponse struct {
+	Data Message `json:"data"`
+}
+
+type threadResponse struct {
+	Data Thread `json:"data"`
+}
+
+func (c *Client) CreateMessage(ctx context.Context, messageReq MessageCreateRequest) (*Message, error) {
+	var resp messageResponse
+	if err := c.do(ctx, http.MethodPost, "/messages", messageReq, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Data, nil
+}
+
+func (c *Client) EditMessage(ctx context.Context, messageID int, updateReq MessageUpdateRequest) (*Message, error) {
+	if updateReq.Message.Buttons == nil {
+		updateReq.Message.Buttons = [][]Button{}
+	}
+
+	var resp messageResponse
+	if err := c.do(ctx, http.MethodPut, fmt.Sprintf("/messages/%d", messageID), updateReq, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Data, nil
+}
+
+func (c *Client) DeleteMessage(ctx context.Context, messageID int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/messages/%d", messageID), nil, nil)
+}
+
+func (c *Client) PinMessage(ctx context.Context, messageID int) error {
+	return c.doIdempotent(ctx, http.MethodPost, fmt.Sprintf("/messages/%d/pin", messageID), nil, nil)
+}
+
+func (c *Client) UnpinMessage(ctx context.Context, messageID int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/messages/%d/pin", messageID), nil, nil)
+}
+
+// CreateThread opens a thread for the message, or returns the existing one.
+func (c *Client) CreateThread(ctx context.Context, messageID int) (*Thread, error) {
+	var resp threadResponse
+	if err := c.do(ctx, http.MethodPost, fmt.Sprintf("/messages/%d/thread", messageID), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Data, nil
+}
@@ -0,0 +1,122 @@
+package pachca
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how the client repeats calls that failed on the way to Pachca.
+// Idempotent calls are repeated after 5xx responses and network errors. Calls that create
+// something, such as a message, are only repeated when Pachca cannot have received them:
+// after 429 and when the connection could not be opened.
+type RetryPolicy struct {
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled after every attempt up to MaxDelay.
+	BaseDelay time.Duration
+	// MaxDelay also bounds Retry-After: a call Pachca asks to repeat later than that is given up.
+	MaxDelay time.Duration
+	// Timeout bounds every attempt, so that a hanging connection does not hold the webhook.
+	Timeout time.Duration
+	// Budget bounds a call with all its attempts and delays, so that the webhook is answered
+	// before the server gives up on it. A retry that cannot start within the budget is given up.
+	Budget time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   250 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+	Timeout:     10 * time.Second,
+	Budget:      20 * time.Second,
+}
+
+// Option configures a Client.
+type Option func(c *Client)
+
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+// retryDelay reports whether the call that failed with err on the given attempt
+// is worth another attempt, and how long to wait before it.
+func (p RetryPolicy) retryDelay(ctx context.Context, err error, attempt int, idempotent bool) (time.Duration, bool) {
+	delay, retry := p.nextDelay(ctx, err, attempt, idempotent)
+	if deadline, ok := ctx.Deadline(); retry && ok && time.Now().Add(delay).After(deadline) {
+		return 0, false
+	}
+	return delay, retry
+}
+
+func (p RetryPolicy) nextDelay(ctx context.Context, err error, attempt int, idempotent bool) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts || ctx.Err() != nil {
+		return 0, false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusTooManyRequests:
+			if apiErr.RetryAfter > p.MaxDelay {
+				return 0, false
+			}
+			if apiErr.RetryAfter > 0 {
+				return apiErr.RetryAfter, true
+			}
+			return p.backoff(attempt), true
+		case apiErr.StatusCode >= 500 && idempotent:
+			return p.backoff(attempt), true
+		default:
+			return 0, false
+		}
+	}
+
+	if idempotent || notSent(err) {
+		return p.backoff(attempt), true
+	}
+	return 0, false
+}
+
+// backoff picks a random delay between half and all of the exponential delay,
+// so that clients failing together do not retry together.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, p.MaxDelay)
+
+	if delay <= 1 {
+		return delay
+	}
+	return delay/2 + rand.N(delay/2)
+}
+
+// notSent reports whether the request failed before it reached Pachca.
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+
+	return 0
+}
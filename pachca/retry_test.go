@@ -0,0 +1,182 @@
+package pachca
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond,
+	MaxDelay:    5 * time.Millisecond,
+	Timeout:     time.Second,
+}
+
+func TestClientRetriesIdempotentCalls(t *testing.T) {
+	var calls atomic.Int32
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer mockPachca.Close()
+
+	client := NewClient(mockPachca.URL, "test-api-key", mockPachca.Client(), WithRetryPolicy(testRetryPolicy))
+
+	if err := client.PinMessage(context.Background(), 194275); err != nil {
+		t.Fatalf("Expected pin to succeed on the third attempt, got %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected 3 calls, got %d", calls.Load())
+	}
+}
+
+func TestClientGivesUpRetriesOutsideBudget(t *testing.T) {
+	var calls atomic.Int32
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer mockPachca.Close()
+
+	policy := RetryPolicy{
+		MaxAttempts: 100,
+		BaseDelay:   20 * time.Millisecond,
+		MaxDelay:    20 * time.Millisecond,
+		Timeout:     time.Second,
+		Budget:      100 * time.Millisecond,
+	}
+	client := NewClient(mockPachca.URL, "test-api-key", mockPachca.Client(), WithRetryPolicy(policy))
+
+	started := time.Now()
+	err := client.PinMessage(context.Background(), 194275)
+	elapsed := time.Since(started)
+
+	if err == nil {
+		t.Fatal("Expected the call to fail once the budget is spent")
+	}
+	// The last attempt may start just before the budget runs out and be cut off by it.
+	if elapsed > policy.Budget+50*time.Millisecond {
+		t.Errorf("Expected the call to give up within %s, took %s", policy.Budget, elapsed)
+	}
+	if calls.Load() < 2 || int(calls.Load()) >= policy.MaxAttempts {
+		t.Errorf("Expected a few attempts within the budget, got %d", calls.Load())
+	}
+}
+
+func TestClientDoesNotRepeatMessageCreation(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name: "server error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			},
+		},
+		{
+			name: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(100 * time.Millisecond)
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+
+			mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				tt.handler(w, r)
+			}))
+			defer mockPachca.Close()
+
+			policy := testRetryPolicy
+			policy.Timeout = 20 * time.Millisecond
+			client := NewClient(mockPachca.URL, "test-api-key", mockPachca.Client(), WithRetryPolicy(policy))
+
+			_, err := client.CreateMessage(context.Background(), MessageCreateRequest{
+				Message: NewMessage{EntityType: "discussion", EntityID: 198, Content: "Hello"},
+			})
+			if err == nil {
+				t.Fatal("Expected error")
+			}
+			if calls.Load() != 1 {
+				t.Errorf("Expected message to be sent once, got %d calls", calls.Load())
+			}
+		})
+	}
+}
+
+func TestClientRetriesRateLimitedCreation(t *testing.T) {
+	var calls atomic.Int32
+
+	mockPachca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"data":{"id":194275}}`))
+	}))
+	defer mockPachca.Close()
+
+	client := NewClient(mockPachca.URL, "test-api-key", mockPachca.Client(), WithRetryPolicy(testRetryPolicy))
+
+	message, err := client.CreateMessage(context.Background(), MessageCreateRequest{
+		Message: NewMessage{EntityType: "discussion", EntityID: 198, Content: "Hello"},
+	})
+	if err != nil {
+		t.Fatalf("Expected message after the rate limit, got %v", err)
+	}
+	if message.ID != 194275 || calls.Load() != 2 {
+		t.Errorf("Expected message 194275 after 2 calls, got %d after %d", message.ID, calls.Load())
+	}
+}
+
+func TestRetryPolicyHonorsRetryAfter(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	if got := parseRetryAfter("7", now); got != 7*time.Second {
+		t.Errorf("Expected 7s, got %s", got)
+	}
+	if got := parseRetryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now); got != 30*time.Second {
+		t.Errorf("Expected 30s, got %s", got)
+	}
+	if got := parseRetryAfter("soon", now); got != 0 {
+		t.Errorf("Expected no delay for an invalid header, got %s", got)
+	}
+
+	rateLimited := &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 7 * time.Second}
+	delay, retry := DefaultRetryPolicy.retryDelay(context.Background(), rateLimited, 1, false)
+	if !retry || delay != 7*time.Second {
+		t.Errorf("Expected retry after 7s, got %s, %v", delay, retry)
+	}
+
+	rateLimitedForAnHour := &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}
+	if delay, retry := DefaultRetryPolicy.retryDelay(context.Background(), rateLimitedForAnHour, 1, false); retry {
+		t.Errorf("Expected no retry beyond the maximum delay, got retry after %s", delay)
+	}
+
+	if _, retry := testRetryPolicy.retryDelay(context.Background(), rateLimited, 3, false); retry {
+		t.Error("Expected no retry after the last attempt")
+	}
+	if _, retry := testRetryPolicy.retryDelay(context.Background(), &APIError{StatusCode: http.StatusBadRequest}, 1, true); retry {
+		t.Error("Expected no retry for a client error")
+	}
+	if _, retry := testRetryPolicy.retryDelay(context.Background(), errors.New("connection reset"), 1, false); retry {
+		t.Error("Expected no retry of a non-idempotent call that may have been sent")
+	}
+}
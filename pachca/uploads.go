@@ -0,0 +1,126 @@
+package pachca
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"pachca.com/android-deployment/logging"
+	"pachca.com/android-deployment/metrics"
+	"pachca.com/android-deployment/tracing"
+)
+
+// File describes an attachment of a received message.
+type File struct {
+	ID       int    `json:"id"`
+	Key      string `json:"key"`
+	Name     string `json:"name"`
+	FileType string `json:"file_type"`
+	URL      string `json:"url"`
+}
+
+// FileParams attaches an uploaded file to a new or edited message.
+type FileParams struct {
+	Key      string `json:"key"`
+	Name     string `json:"name"`
+	FileType string `json:"file_type"`
+	Size     int64  `json:"size"`
+}
+
+// uploadForm holds the presigned form fields returned by POST /uploads.
+type uploadForm struct {
+	ContentDisposition string `json:"Content-Disposition"`
+	ACL                string `json:"acl"`
+	Policy             string `json:"policy"`
+	Credential         string `json:"x-amz-credential"`
+	Algorithm          string `json:"x-amz-algorithm"`
+	Date               string `json:"x-amz-date"`
+	Signature          string `json:"x-amz-signature"`
+	Key                string `json:"key"`
+	DirectURL          string `json:"direct_url"`
+}
+
+// UploadFile uploads the content to Pachca storage and returns the parameters
+// to attach it to a message. fileType is either "file" or "image".
+func (c *Client) UploadFile(ctx context.Context, name string, fileType string, content io.Reader) (*FileParams, error) {
+	var form uploadForm
+	if err := c.do(ctx, http.MethodPost, "/uploads", nil, &form); err != nil {
+		return nil, err
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	fields := []struct{ name, value string }{
+		{"Content-Disposition", form.ContentDisposition},
+		{"acl", form.ACL},
+		{"policy", form.Policy},
+		{"x-amz-credential", form.Credential},
+		{"x-amz-algorithm", form.Algorithm},
+		{"x-amz-date", form.Date},
+		{"x-amz-signature", form.Signature},
+		{"key", form.Key},
+	}
+	for _, field := range fields {
+		if err := writer.WriteField(field.name, field.value); err != nil {
+			return nil, err
+		}
+	}
+
+	part, err := writer.CreateFormFile("file", name)
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(part, content)
+	if err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	// The direct upload is made once, within the same per-call timeout as the calls to the API.
+	if c.retry.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.retry.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, form.DirectURL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	ctx, span := tracing.StartCall(ctx, metrics.ServicePachca, req.Method, req.URL.Path)
+	req = req.WithContext(ctx)
+
+	started := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		metrics.ObserveCall(metrics.ServicePachca, http.MethodPost, started, 0, err)
+		tracing.EndCall(span, 0, err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+	metrics.ObserveCall(metrics.ServicePachca, http.MethodPost, started, resp.StatusCode, nil)
+	tracing.EndCall(span, resp.StatusCode, nil)
+
+	respBody, _ := io.ReadAll(resp.Body)
+	logging.Payload(ctx, "Pachca direct upload response", respBody, "status", resp.StatusCode)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("Pachca direct upload returned status %d", resp.StatusCode)
+	}
+
+	return &FileParams{
+		Key:      strings.ReplaceAll(form.Key, "${filename}", name),
+		Name:     name,
+		FileType: fileType,
+		Size:     size,
+	}, nil
+}
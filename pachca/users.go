@@ -0,0 +1,89 @@
+package pachca
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type User struct {
+	ID         int    `json:"id"`
+	FirstName  string `json:"first_name"`
+	LastName   string `json:"last_name"`
+	Nickname   string `json:"nickname"`
+	Email      string `json:"email"`
+	Role       string `json:"role"`
+	Suspended  bool   `json:"suspended"`
+	Bot        bool   `json:"bot"`
+	Department string `json:"department"`
+}
+
+type ListUsersOptions struct {
+	Query  string
+	Limit  int
+	Cursor string
+}
+
+type UserList struct {
+	Users      []User
+	NextCursor string
+}
+
+type userResponse struct {
+	Data User `json:"data"`
+}
+
+type userListResponse struct {
+	Data []User `json:"data"`
+	Meta struct {
+		Paginate struct {
+			NextPage string `json:"next_page"`
+		} `json:"paginate"`
+	} `json:"meta"`
+}
+
+func (c *Client) GetUser(ctx context.Context, userID int) (*User, error) {
+	var resp userResponse
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/users/%d", userID), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Data, nil
+}
+
+func (c *Client) ListUsers(ctx context.Context, opts ListUsersOptions) (*UserList, error) {
+	query := url.Values{}
+	if opts.Query != "" {
+		query.Set("query", opts.Query)
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Cursor != "" {
+		query.Set("cursor", opts.Cursor)
+	}
+
+	path := "/users"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var resp userListResponse
+	if err := c.do(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &UserList{Users: resp.Data, NextCursor: resp.Meta.Paginate.NextPage}, nil
+}
+
+// GetProfile returns the user the API key belongs to.
+func (c *Client) GetProfile(ctx context.Context) (*User, error) {
+	var resp userResponse
+	if err := c.do(ctx, http.MethodGet, "/profile", nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp.Data, nil
+}
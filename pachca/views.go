@@ -0,0 +1,37 @@
+package pachca
+
+import (
+	"context"
+	"net/http"
+)
+
+type ViewRequest struct {
+	Type            string `json:"type"`
+	TriggerID       string `json:"trigger_id"`
+	CallbackID      string `json:"callback_id"`
+	PrivateMetadata string `json:"private_metadata"`
+	View            View   `json:"view"`
+}
+
+type View struct {
+	Title  string      `json:"title"`
+	Blocks []ViewBlock `json:"blocks"`
+}
+
+type ViewBlock struct {
+	Type        string `json:"type"`
+	Name        string `json:"name,omitempty"`
+	Label       string `json:"label,omitempty"`
+	Text        string `json:"text,omitempty"`
+	Placeholder string `json:"placeholder,omitempty"`
+	Multiline   bool   `json:"multiline,omitempty"`
+	MinLength   int    `json:"min_length,omitempty"`
+	MaxLength   int    `json:"max_length,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Hint        string `json:"hint,omitempty"`
+}
+
+// OpenView shows a modal to the user who triggered the webhook with trigger_id.
+func (c *Client) OpenView(ctx context.Context, viewReq ViewRequest) error {
+	return c.do(ctx, http.MethodPost, "/views/open", viewReq, nil)
+}
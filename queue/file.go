@@ -0,0 +1,221 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"pachca.com/android-deployment/filelock"
+)
+
+// FileQueue keeps all jobs in a single JSON file, rewritten atomically on every change.
+// Changes hold a lock on the file, so that processes sharing it never claim the same job.
+type FileQueue struct {
+	mu   sync.Mutex
+	path string
+}
+
+type fileQueueData struct {
+	LastID int64  `json:"last_id"`
+	Jobs   []*Job `json:"jobs"`
+}
+
+func NewFileQueue(path string) (*FileQueue, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file queue needs a path")
+	}
+
+	q := &FileQueue{path: path}
+	if _, err := q.load(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+func (q *FileQueue) Enqueue(ctx context.Context, kind string, payload []byte, now time.Time) (*Job, error) {
+	var job *Job
+	err := q.update(func(data *fileQueueData) error {
+		data.LastID++
+		job = &Job{ID: data.LastID, Kind: kind, Payload: payload, RunAt: now, CreatedAt: now}
+		data.Jobs = append(data.Jobs, job)
+		return nil
+	})
+	return job, err
+}
+
+func (q *FileQueue) Claim(ctx context.Context, now time.Time, lease time.Duration) (*Job, error) {
+	var claimed Job
+	err := q.update(func(data *fileQueueData) error {
+		var due *Job
+		for _, job := range data.Jobs {
+			if job.Dead || job.RunAt.After(now) {
+				continue
+			}
+			if due == nil || job.RunAt.Before(due.RunAt) {
+				due = job
+			}
+		}
+		if due == nil {
+			return ErrEmpty
+		}
+
+		due.Attempts++
+		due.RunAt = now.Add(lease)
+		claimed = *due
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &claimed, nil
+}
+
+func (q *FileQueue) Complete(ctx context.Context, id int64) error {
+	return q.update(func(data *fileQueueData) error {
+		for i, job := range data.Jobs {
+			if job.ID == id {
+				data.Jobs = append(data.Jobs[:i], data.Jobs[i+1:]...)
+				return nil
+			}
+		}
+		return nil
+	})
+}
+
+func (q *FileQueue) Retry(ctx context.Context, id int64, cause string, runAt time.Time) error {
+	return q.update(func(data *fileQueueData) error {
+		job, err := findJob(data, id)
+		if err != nil {
+			return err
+		}
+		job.LastError = cause
+		job.RunAt = runAt
+		return nil
+	})
+}
+
+func (q *FileQueue) Bury(ctx context.Context, id int64, cause string) error {
+	return q.update(func(data *fileQueueData) error {
+		job, err := findJob(data, id)
+		if err != nil {
+			return err
+		}
+		job.LastError = cause
+		job.Dead = true
+		return nil
+	})
+}
+
+func (q *FileQueue) DeadLetters(ctx context.Context) ([]*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// The file is replaced as a whole, so reading it needs no lock.
+	data, err := q.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var dead []*Job
+	for _, job := range data.Jobs {
+		if job.Dead {
+			dead = append(dead, job)
+		}
+	}
+
+	return dead, nil
+}
+
+func (q *FileQueue) Close() error {
+	return nil
+}
+
+func findJob(data *fileQueueData, id int64) (*Job, error) {
+	for _, job := range data.Jobs {
+		if job.ID == id {
+			return job, nil
+		}
+	}
+	return nil, fmt.Errorf("job %d not found", id)
+}
+
+// update changes the queue under both the in-process and the file lock. The file lock is not
+// enough on its own where flock is not available.
+func (q *FileQueue) update(fn func(data *fileQueueData) error) (err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	unlock, err := filelock.Lock(q.path)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, unlock()) }()
+
+	data, err := q.load()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(data); err != nil {
+		return err
+	}
+
+	return q.save(data)
+}
+
+// load reads the file on every call, so that several processes sharing it see each other's jobs.
+func (q *FileQueue) load() (*fileQueueData, error) {
+	data := &fileQueueData{}
+
+	content, err := os.ReadFile(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return data, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) == 0 {
+		return data, nil
+	}
+
+	if err := json.Unmarshal(content, data); err != nil {
+		return nil, fmt.Errorf("invalid queue %s: %w", q.path, err)
+	}
+
+	return data, nil
+}
+
+func (q *FileQueue) save(data *fileQueueData) error {
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(q.path), filepath.Base(q.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), q.path)
+}
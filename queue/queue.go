@@ -0,0 +1,82 @@
+// Package queue keeps accepted webhooks until background workers have processed them,
+// so that an outage of Pachca or Gitlab delays the work instead of failing the webhook.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrEmpty is returned by Claim when no job is due.
+var ErrEmpty = errors.New("no job is due")
+
+// Job is a unit of work of a given kind, such as a Gitlab webhook.
+type Job struct {
+	ID       int64  `json:"id"`
+	Kind     string `json:"kind"`
+	Payload  []byte `json:"payload"`
+	Attempts int    `json:"attempts"`
+	// RunAt is when the job is due next. A claimed job is due again when its lease runs out.
+	RunAt     time.Time `json:"run_at"`
+	LastError string    `json:"last_error,omitempty"`
+	// Dead jobs failed for good and stay in the dead-letter list until removed by hand.
+	Dead      bool      `json:"dead,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Queue is a durable list of jobs shared by the webhook handlers and the workers.
+type Queue interface {
+	Enqueue(ctx context.Context, kind string, payload []byte, now time.Time) (*Job, error)
+	// Claim returns the oldest job that is due at now and hides it from other workers for lease.
+	Claim(ctx context.Context, now time.Time, lease time.Duration) (*Job, error)
+	// Complete removes a processed job.
+	Complete(ctx context.Context, id int64) error
+	// Retry records the error of a failed attempt and schedules the job to run again at runAt.
+	Retry(ctx context.Context, id int64, cause string, runAt time.Time) error
+	// Bury moves a job to the dead-letter list.
+	Bury(ctx context.Context, id int64, cause string) error
+	DeadLetters(ctx context.Context) ([]*Job, error)
+	Close() error
+}
+
+const (
+	StoreFile   string = "file"
+	StoreSQLite string = "sqlite"
+)
+
+var (
+	queuesMu sync.Mutex
+	queues   = make(map[string]Queue)
+)
+
+// Open returns the queue of the given kind at path. Like release stores, queues are opened
+// once per process, so that the handlers and the workers share them.
+func Open(kind string, path string) (Queue, error) {
+	queuesMu.Lock()
+	defer queuesMu.Unlock()
+
+	key := kind + ":" + path
+	if queue, ok := queues[key]; ok {
+		return queue, nil
+	}
+
+	var queue Queue
+	var err error
+	switch kind {
+	case StoreFile:
+		queue, err = NewFileQueue(path)
+	case StoreSQLite:
+		queue, err = NewSQLiteQueue(path)
+	default:
+		return nil, fmt.Errorf("unknown queue store %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	queues[key] = queue
+	return queue, nil
+}
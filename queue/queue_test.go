@@ -0,0 +1,189 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueues(t *testing.T) {
+	tests := []struct {
+		name string
+		open func(t *testing.T, path string) Queue
+	}{
+		{
+			name: "file",
+			open: func(t *testing.T, path string) Queue {
+				queue, err := NewFileQueue(filepath.Join(path, "queue.json"))
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				return queue
+			},
+		},
+		{
+			name: "sqlite",
+			open: func(t *testing.T, path string) Queue {
+				queue, err := NewSQLiteQueue(filepath.Join(path, "queue.db"))
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				return queue
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			queue := tt.open(t, t.TempDir())
+			defer queue.Close()
+
+			now := time.Unix(1755075544, 0).UTC()
+			if _, err := queue.Claim(ctx, now, time.Minute); !errors.Is(err, ErrEmpty) {
+				t.Fatalf("Expected ErrEmpty, got %v", err)
+			}
+
+			first, err := queue.Enqueue(ctx, "gitlab", []byte(`{"event":"build"}`), now)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			second, err := queue.Enqueue(ctx, "pachca", []byte(`{"type":"button"}`), now.Add(time.Second))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			job, err := queue.Claim(ctx, now.Add(time.Second), time.Minute)
+			if err != nil {
+				t.Fatalf("Expected a job, got %v", err)
+			}
+			if job.ID != first.ID || job.Kind != "gitlab" || string(job.Payload) != `{"event":"build"}` || job.Attempts != 1 {
+				t.Errorf("Expected first gitlab job on its first attempt, got %+v", job)
+			}
+
+			job, err = queue.Claim(ctx, now.Add(time.Second), time.Minute)
+			if err != nil || job.ID != second.ID {
+				t.Fatalf("Expected second job while the first is claimed, got %+v, %v", job, err)
+			}
+			if _, err := queue.Claim(ctx, now.Add(time.Second), time.Minute); !errors.Is(err, ErrEmpty) {
+				t.Errorf("Expected claimed jobs to be hidden, got %v", err)
+			}
+
+			if err := queue.Retry(ctx, first.ID, "pachca is down", now.Add(time.Minute)); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if err := queue.Complete(ctx, second.ID); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			job, err = queue.Claim(ctx, now.Add(time.Minute), time.Minute)
+			if err != nil || job.ID != first.ID || job.Attempts != 2 || job.LastError != "pachca is down" {
+				t.Fatalf("Expected first job again on its second attempt, got %+v, %v", job, err)
+			}
+
+			if err := queue.Bury(ctx, first.ID, "still down"); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if _, err := queue.Claim(ctx, now.Add(time.Hour), time.Minute); !errors.Is(err, ErrEmpty) {
+				t.Errorf("Expected dead jobs not to be claimed, got %v", err)
+			}
+
+			dead, err := queue.DeadLetters(ctx)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(dead) != 1 || dead[0].ID != first.ID || dead[0].LastError != "still down" {
+				t.Errorf("Expected first job in dead letters, got %+v", dead)
+			}
+		})
+	}
+}
+
+func TestFileQueueSurvivesReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "queue.json")
+	now := time.Unix(1755075544, 0).UTC()
+
+	queue, err := NewFileQueue(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := queue.Enqueue(ctx, "gitlab", []byte(`{}`), now); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	reopened, err := NewFileQueue(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	job, err := reopened.Claim(ctx, now, time.Minute)
+	if err != nil || job.Kind != "gitlab" {
+		t.Errorf("Expected queued job after reopening, got %+v, %v", job, err)
+	}
+}
+
+func TestFileQueuesShareFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "queue.json")
+	now := time.Unix(1755075544, 0).UTC()
+
+	// Each FileQueue stands for a process: they share only the file.
+	queues := make([]*FileQueue, 4)
+	for i := range queues {
+		queue, err := NewFileQueue(path)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		queues[i] = queue
+	}
+
+	const jobs = 20
+	var wg sync.WaitGroup
+	for i := range jobs {
+		wg.Go(func() {
+			if _, err := queues[i%len(queues)].Enqueue(ctx, "gitlab", []byte(`{}`), now); err != nil {
+				t.Errorf("Expected no error, got %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	var mu sync.Mutex
+	claimed := make(map[int64]int)
+	for _, queue := range queues {
+		wg.Go(func() {
+			for {
+				job, err := queue.Claim(ctx, now, time.Minute)
+				if errors.Is(err, ErrEmpty) {
+					return
+				}
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+					return
+				}
+				mu.Lock()
+				claimed[job.ID]++
+				mu.Unlock()
+			}
+		})
+	}
+	wg.Wait()
+
+	if len(claimed) != jobs {
+		t.Errorf("Expected %d claimed jobs, got %d", jobs, len(claimed))
+	}
+	for id, claims := range claimed {
+		if claims != 1 {
+			t.Errorf("Expected job %d to be claimed once, got %d", id, claims)
+		}
+	}
+}
+
+func TestOpenRejectsUnknownKind(t *testing.T) {
+	if _, err := Open("redis", ""); err == nil {
+		t.Error("Expected error for unknown queue store")
+	}
+}
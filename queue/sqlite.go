@@ -0,0 +1,158 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteQueue keeps jobs as rows ordered by the time they are due.
+type SQLiteQueue struct {
+	db *sql.DB
+}
+
+func NewSQLiteQueue(path string) (*SQLiteQueue, error) {
+	if path == "" {
+		return nil, fmt.Errorf("sqlite queue needs a path")
+	}
+
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// A single connection serializes claims, which SQLite would do anyway.
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		payload BLOB NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		run_at INTEGER NOT NULL,
+		last_error TEXT NOT NULL DEFAULT '',
+		dead INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteQueue{db: db}, nil
+}
+
+func (q *SQLiteQueue) Enqueue(ctx context.Context, kind string, payload []byte, now time.Time) (*Job, error) {
+	result, err := q.db.ExecContext(ctx,
+		`INSERT INTO jobs (kind, payload, run_at, created_at) VALUES (?, ?, ?, ?)`,
+		kind, payload, now.UnixNano(), now.UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Job{ID: id, Kind: kind, Payload: payload, RunAt: now, CreatedAt: now}, nil
+}
+
+func (q *SQLiteQueue) Claim(ctx context.Context, now time.Time, lease time.Duration) (*Job, error) {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx,
+		`SELECT id, kind, payload, attempts, run_at, last_error, dead, created_at FROM jobs
+		WHERE dead = 0 AND run_at <= ? ORDER BY run_at, id LIMIT 1`,
+		now.UnixNano(),
+	)
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrEmpty
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	job.Attempts++
+	job.RunAt = now.Add(lease)
+	_, err = tx.ExecContext(ctx, `UPDATE jobs SET attempts = ?, run_at = ? WHERE id = ?`,
+		job.Attempts, job.RunAt.UnixNano(), job.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (q *SQLiteQueue) Complete(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, `DELETE FROM jobs WHERE id = ?`, id)
+	return err
+}
+
+func (q *SQLiteQueue) Retry(ctx context.Context, id int64, cause string, runAt time.Time) error {
+	_, err := q.db.ExecContext(ctx, `UPDATE jobs SET last_error = ?, run_at = ? WHERE id = ?`,
+		cause, runAt.UnixNano(), id)
+	return err
+}
+
+func (q *SQLiteQueue) Bury(ctx context.Context, id int64, cause string) error {
+	_, err := q.db.ExecContext(ctx, `UPDATE jobs SET last_error = ?, dead = 1 WHERE id = ?`, cause, id)
+	return err
+}
+
+func (q *SQLiteQueue) DeadLetters(ctx context.Context) ([]*Job, error) {
+	rows, err := q.db.QueryContext(ctx,
+		`SELECT id, kind, payload, attempts, run_at, last_error, dead, created_at FROM jobs
+		WHERE dead = 1 ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+func (q *SQLiteQueue) Close() error {
+	return q.db.Close()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row scanner) (*Job, error) {
+	var job Job
+	var payload []byte
+	var runAt, createdAt int64
+	err := row.Scan(&job.ID, &job.Kind, &payload, &job.Attempts, &runAt, &job.LastError, &job.Dead, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Payload = payload
+	job.RunAt = time.Unix(0, runAt)
+	job.CreatedAt = time.Unix(0, createdAt)
+	return &job, nil
+}
@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"pachca.com/android-deployment/logging"
+)
+
+// Handler processes the payload of one kind of job.
+type Handler func(ctx context.Context, payload []byte) error
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so that the worker moves the job to the dead-letter list without retrying it.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Worker claims due jobs and runs their handlers. A failed job is retried with
+// exponential backoff until it runs out of attempts and goes to the dead-letter list.
+type Worker struct {
+	Queue       Queue
+	Handlers    map[string]Handler
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	// Lease is how long a job is hidden from other workers while it runs.
+	Lease time.Duration
+	// PollInterval is how often an idle worker looks for due jobs.
+	PollInterval time.Duration
+}
+
+// Run processes jobs until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	for {
+		processed, err := w.RunOnce(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "Queue error", "error", err)
+		}
+		if processed && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(w.PollInterval):
+		}
+	}
+}
+
+// RunOnce processes the next due job, if any, and reports whether there was one.
+func (w *Worker) RunOnce(ctx context.Context) (bool, error) {
+	job, err := w.Queue.Claim(ctx, time.Now(), w.Lease)
+	if errors.Is(err, ErrEmpty) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	handler, ok := w.Handlers[job.Kind]
+	if !ok {
+		return true, w.Queue.Bury(ctx, job.ID, fmt.Sprintf("no handler for %s jobs", job.Kind))
+	}
+
+	jobCtx := logging.With(ctx, "job_id", job.ID, "job_kind", job.Kind)
+	handlerCtx, cancel := context.WithTimeout(jobCtx, w.Lease)
+	err = handler(handlerCtx, job.Payload)
+	cancel()
+
+	// The outcome is recorded even when the worker is being stopped.
+	ctx = context.WithoutCancel(ctx)
+	jobCtx = context.WithoutCancel(jobCtx)
+	if err == nil {
+		return true, w.Queue.Complete(ctx, job.ID)
+	}
+
+	var permanent *permanentError
+	if errors.As(err, &permanent) || job.Attempts >= w.MaxAttempts {
+		slog.ErrorContext(jobCtx, "Job failed, moved to dead letters", "attempts", job.Attempts, "error", err)
+		return true, w.Queue.Bury(ctx, job.ID, err.Error())
+	}
+
+	delay := w.backoff(job.Attempts)
+	slog.WarnContext(jobCtx, "Job failed, retrying", "attempts", job.Attempts, "delay", delay, "error", err)
+	return true, w.Queue.Retry(ctx, job.ID, err.Error(), time.Now().Add(delay))
+}
+
+// backoff doubles the delay after every failed attempt, up to MaxBackoff.
+func (w *Worker) backoff(attempts int) time.Duration {
+	delay := w.Backoff
+	for i := 1; i < attempts && delay < w.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, w.MaxBackoff)
+}
@@ -0,0 +1,103 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWorkerRetriesAndBuries(t *testing.T) {
+	ctx := context.Background()
+	queue, err := NewFileQueue(filepath.Join(t.TempDir(), "queue.json"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var attempts int
+	worker := &Worker{
+		Queue: queue,
+		Handlers: map[string]Handler{
+			"gitlab": func(ctx context.Context, payload []byte) error {
+				attempts++
+				return errors.New("pachca is down")
+			},
+		},
+		MaxAttempts: 2,
+		Backoff:     time.Hour,
+		MaxBackoff:  time.Hour,
+		Lease:       time.Minute,
+	}
+
+	job, _ := queue.Enqueue(ctx, "gitlab", []byte(`{}`), time.Now())
+
+	if processed, err := worker.RunOnce(ctx); !processed || err != nil {
+		t.Fatalf("Expected job to be processed, got %v, %v", processed, err)
+	}
+	if processed, _ := worker.RunOnce(ctx); processed {
+		t.Fatal("Expected failed job to wait for its backoff")
+	}
+
+	// Make the job due again instead of waiting for the backoff.
+	if err := queue.Retry(ctx, job.ID, "pachca is down", time.Now()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if processed, err := worker.RunOnce(ctx); !processed || err != nil {
+		t.Fatalf("Expected job to be processed, got %v, %v", processed, err)
+	}
+
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+	dead, _ := queue.DeadLetters(ctx)
+	if len(dead) != 1 || dead[0].LastError != "pachca is down" {
+		t.Errorf("Expected job in dead letters after the last attempt, got %+v", dead)
+	}
+}
+
+func TestWorkerBuriesPermanentFailures(t *testing.T) {
+	ctx := context.Background()
+	queue, err := NewFileQueue(filepath.Join(t.TempDir(), "queue.json"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	worker := &Worker{
+		Queue: queue,
+		Handlers: map[string]Handler{
+			"gitlab": func(ctx context.Context, payload []byte) error {
+				return Permanent(errors.New("invalid payload"))
+			},
+		},
+		MaxAttempts: 5,
+		Backoff:     time.Second,
+		MaxBackoff:  time.Minute,
+		Lease:       time.Minute,
+	}
+
+	queue.Enqueue(ctx, "gitlab", []byte(`{}`), time.Now())
+	queue.Enqueue(ctx, "linear", []byte(`{}`), time.Now())
+
+	for range 2 {
+		if _, err := worker.RunOnce(ctx); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	dead, _ := queue.DeadLetters(ctx)
+	if len(dead) != 2 {
+		t.Errorf("Expected both jobs in dead letters, got %+v", dead)
+	}
+}
+
+func TestWorkerBackoff(t *testing.T) {
+	worker := &Worker{Backoff: 5 * time.Second, MaxBackoff: time.Minute}
+
+	expected := []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}
+	for i, delay := range expected {
+		if got := worker.backoff(i + 1); got != delay {
+			t.Errorf("Expected backoff %s after attempt %d, got %s", delay, i+1, got)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+var (
+	ErrDeliveryDone       = errors.New("delivery already processed")
+	ErrDeliveryInProgress = errors.New("delivery is being processed")
+)
+
+// DeliveryRecord remembers how far the processing of one webhook event got,
+// so that a repeated delivery neither repeats side effects nor loses the remaining ones.
+// Releases keep their records by event key, such as "build:success:1234".
+type DeliveryRecord struct {
+	Steps     []string  `json:"steps,omitempty"`
+	ClaimedAt time.Time `json:"claimed_at,omitzero"`
+	Done      bool      `json:"done,omitempty"`
+}
+
+// Delivery is the processing of one webhook event, claimed in the store until it finishes or is abandoned.
+type Delivery struct {
+	store       Store
+	versionCode int
+	key         string
+	steps       []string
+}
+
+// ClaimDelivery starts processing the event identified by key for the release.
+// It returns ErrDeliveryDone for an event that was processed before and ErrDeliveryInProgress
+// while another delivery of the same event holds the claim. A claim older than lease is
+// considered abandoned, so that a crashed delivery is resumed.
+func ClaimDelivery(ctx context.Context, store Store, versionCode int, key string, now time.Time, lease time.Duration) (*Delivery, error) {
+	var steps []string
+	_, err := store.Update(ctx, versionCode, func(r *Release) error {
+		record := r.Deliveries[key]
+		if record == nil {
+			record = &DeliveryRecord{}
+		}
+
+		if record.Done {
+			return ErrDeliveryDone
+		}
+		if !record.ClaimedAt.IsZero() && now.Sub(record.ClaimedAt) < lease {
+			return ErrDeliveryInProgress
+		}
+
+		record.ClaimedAt = now
+		if r.Deliveries == nil {
+			r.Deliveries = make(map[string]*DeliveryRecord)
+		}
+		r.Deliveries[key] = record
+		steps = slices.Clone(record.Steps)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Delivery{store: store, versionCode: versionCode, key: key, steps: steps}, nil
+}
+
+// Get returns the release the delivery is about, which is empty before its first event.
+func (d *Delivery) Get(ctx context.Context) (*Release, error) {
+	r, err := d.store.Get(ctx, d.versionCode)
+	if errors.Is(err, ErrNotFound) {
+		return &Release{VersionCode: d.versionCode}, nil
+	}
+	return r, err
+}
+
+// Completed reports whether a previous attempt already carried out the step.
+func (d *Delivery) Completed(step string) bool {
+	return slices.Contains(d.steps, step)
+}
+
+// Complete records the step together with the changes fn makes to the release, in one update.
+func (d *Delivery) Complete(ctx context.Context, step string, fn func(*Release) error) (*Release, error) {
+	r, err := d.store.Update(ctx, d.versionCode, func(r *Release) error {
+		if fn != nil {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+
+		record := r.Deliveries[d.key]
+		record.Steps = append(record.Steps, step)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	d.steps = append(d.steps, step)
+	return r, nil
+}
+
+// Finish marks the event as processed, so that later deliveries of it are ignored.
+func (d *Delivery) Finish(ctx context.Context) error {
+	_, err := d.store.Update(ctx, d.versionCode, func(r *Release) error {
+		record := r.Deliveries[d.key]
+		record.Done = true
+		record.ClaimedAt = time.Time{}
+		return nil
+	})
+	return err
+}
+
+// Abandon gives up the claim after a failure, so that the next delivery resumes right away.
+func (d *Delivery) Abandon(ctx context.Context) error {
+	_, err := d.store.Update(ctx, d.versionCode, func(r *Release) error {
+		r.Deliveries[d.key].ClaimedAt = time.Time{}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,104 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeliveryResumesAfterAbandon(t *testing.T) {
+	ctx := context.Background()
+	store, err := OpenStore(StoreFile, filepath.Join(t.TempDir(), "releases.json"))
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	d, err := ClaimDelivery(ctx, store, 1001, "build:success:12345", now, time.Minute)
+	if err != nil {
+		t.Fatalf("Expected claim, got %v", err)
+	}
+	if _, err := ClaimDelivery(ctx, store, 1001, "build:success:12345", now.Add(time.Second), time.Minute); !errors.Is(err, ErrDeliveryInProgress) {
+		t.Errorf("Expected ErrDeliveryInProgress while claimed, got %v", err)
+	}
+
+	_, err = d.Complete(ctx, "message", func(r *Release) error {
+		r.MessageID = 194275
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to complete step: %v", err)
+	}
+	if err := d.Abandon(ctx); err != nil {
+		t.Fatalf("Failed to abandon delivery: %v", err)
+	}
+
+	d, err = ClaimDelivery(ctx, store, 1001, "build:success:12345", now.Add(time.Second), time.Minute)
+	if err != nil {
+		t.Fatalf("Expected claim after abandon, got %v", err)
+	}
+	if !d.Completed("message") || d.Completed("pin") {
+		t.Errorf("Expected only the message step to be completed")
+	}
+	r, err := d.Get(ctx)
+	if err != nil || r.MessageID != 194275 {
+		t.Errorf("Expected message_id 194275 from the completed step, got %v, %v", r, err)
+	}
+
+	if err := d.Finish(ctx); err != nil {
+		t.Fatalf("Failed to finish delivery: %v", err)
+	}
+	if _, err := ClaimDelivery(ctx, store, 1001, "build:success:12345", now.Add(time.Hour), time.Minute); !errors.Is(err, ErrDeliveryDone) {
+		t.Errorf("Expected ErrDeliveryDone after finish, got %v", err)
+	}
+	if _, err := ClaimDelivery(ctx, store, 1001, "build:success:12346", now, time.Minute); err != nil {
+		t.Errorf("Expected another job to be claimed, got %v", err)
+	}
+}
+
+func TestDeliveryTakesOverExpiredClaim(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	if _, err := ClaimDelivery(ctx, store, 1001, "promote:success:12350", now, time.Minute); err != nil {
+		t.Fatalf("Expected claim, got %v", err)
+	}
+	if _, err := ClaimDelivery(ctx, store, 1001, "promote:success:12350", now.Add(2*time.Minute), time.Minute); err != nil {
+		t.Errorf("Expected expired claim to be taken over, got %v", err)
+	}
+}
+
+func TestFileStoresClaimDeliveryOnce(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "releases.json")
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// Each FileStore stands for a process: they share only the file.
+	var claims atomic.Int32
+	var wg sync.WaitGroup
+	for range 8 {
+		store, err := NewFileStore(path)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		wg.Go(func() {
+			_, err := ClaimDelivery(ctx, store, 1001, "promote:success:12350", now, time.Minute)
+			switch {
+			case err == nil:
+				claims.Add(1)
+			case !errors.Is(err, ErrDeliveryInProgress):
+				t.Errorf("Expected claim or ErrDeliveryInProgress, got %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if claims.Load() != 1 {
+		t.Errorf("Expected 1 claim of the delivery, got %d", claims.Load())
+	}
+}
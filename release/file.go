@@ -0,0 +1,156 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+
+	"pachca.com/android-deployment/filelock"
+)
+
+// FileStore keeps all releases in a single JSON file, rewritten atomically on every update.
+// Updates hold a lock on the file, so that processes sharing it never claim the same delivery.
+type FileStore struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("file release store needs a path")
+	}
+
+	s := &FileStore{path: path}
+	if _, err := s.load(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) Get(ctx context.Context, versionCode int) (*Release, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	releases, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	r, ok := releases[strconv.Itoa(versionCode)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return r, nil
+}
+
+func (s *FileStore) Update(ctx context.Context, versionCode int, fn func(*Release) error) (_ *Release, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := filelock.Lock(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { err = errors.Join(err, unlock()) }()
+
+	releases, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	key := strconv.Itoa(versionCode)
+	r, ok := releases[key]
+	if !ok {
+		r = &Release{VersionCode: versionCode}
+	}
+
+	if err := fn(r); err != nil {
+		return nil, err
+	}
+
+	releases[key] = r
+	if err := s.save(releases); err != nil {
+		return nil, err
+	}
+
+	return clone(r), nil
+}
+
+func (s *FileStore) List(ctx context.Context) ([]*Release, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	releases, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*Release, 0, len(releases))
+	for _, r := range releases {
+		list = append(list, r)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].VersionCode < list[j].VersionCode })
+
+	return list, nil
+}
+
+func (s *FileStore) Close() error {
+	return nil
+}
+
+// load reads the file on every call, so that several processes sharing it see each other's updates.
+func (s *FileStore) load() (map[string]*Release, error) {
+	releases := make(map[string]*Release)
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return releases, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == 0 {
+		return releases, nil
+	}
+
+	if err := json.Unmarshal(data, &releases); err != nil {
+		return nil, fmt.Errorf("invalid release store %s: %w", s.path, err)
+	}
+
+	return releases, nil
+}
+
+func (s *FileStore) save(releases map[string]*Release) error {
+	data, err := json.MarshalIndent(releases, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,159 @@
+package release
+
+import (
+	"fmt"
+	"slices"
+
+	"pachca.com/android-deployment/shared"
+)
+
+// State is a step in the lifecycle of a release.
+type State string
+
+const (
+	StateNone                 State = ""
+	StateInternal             State = "internal"
+	StateProductionInProgress State = "production_in_progress"
+	StateHalted               State = "halted"
+	StateProductionComplete   State = "production_complete"
+	StateReleasingOtherStores State = "releasing_other_stores"
+	StateDone                 State = "done"
+	StateFailed               State = "failed"
+)
+
+// States lists the states a release moves through, in lifecycle order.
+var States = []State{
+	StateInternal,
+	StateProductionInProgress,
+	StateHalted,
+	StateProductionComplete,
+	StateReleasingOtherStores,
+	StateDone,
+	StateFailed,
+}
+
+// stateDescriptions complete "release 1.0.1 (1001) is ..." in chat replies.
+var stateDescriptions = map[State]string{
+	StateNone:                 "not known yet",
+	StateInternal:             "on the internal track",
+	StateProductionInProgress: "rolling out in production",
+	StateHalted:               "halted in production",
+	StateProductionComplete:   "fully rolled out in production",
+	StateReleasingOtherStores: "being released to other stores",
+	StateDone:                 "released everywhere",
+	StateFailed:               "failed",
+}
+
+func (s State) Description() string {
+	return stateDescriptions[s]
+}
+
+// transitions lists the states a release can move to from each state.
+// A release the store does not know was built before the store existed, or by a process whose
+// in-memory store is gone. Its message can only carry the promote button, so it takes the results
+// of a build or a promotion and failures, but nothing that needs the release to be in production.
+// A failed release can move on to any state but done once its job succeeds on a retry:
+// a failed release to other stores goes back to releasing_other_stores when it is retried.
+var transitions = map[State][]State{
+	StateNone:                 {StateInternal, StateProductionInProgress, StateProductionComplete, StateFailed},
+	StateInternal:             {StateProductionInProgress, StateProductionComplete, StateFailed},
+	StateProductionInProgress: {StateProductionInProgress, StateHalted, StateProductionComplete, StateReleasingOtherStores, StateFailed},
+	StateHalted:               {StateProductionInProgress, StateHalted, StateProductionComplete, StateFailed},
+	StateProductionComplete:   {StateReleasingOtherStores, StateFailed},
+	StateReleasingOtherStores: {StateDone, StateFailed},
+	StateFailed:               {StateInternal, StateProductionInProgress, StateHalted, StateProductionComplete, StateReleasingOtherStores},
+	StateDone:                 {},
+}
+
+// actionStates lists the states in which a user can start each release action.
+var actionStates = map[string][]State{
+	shared.ActionPromote:       {StateNone, StateInternal},
+	shared.ActionUpdateRollout: {StateProductionInProgress, StateHalted},
+	shared.ActionReleaseStores: {StateProductionInProgress, StateProductionComplete},
+	shared.ActionRetry:         {StateFailed},
+	shared.ActionHalt:          {StateProductionInProgress},
+}
+
+// TransitionError is returned for a state change or an action the lifecycle does not allow.
+type TransitionError struct {
+	VersionCode int
+	From        State
+	To          State
+	Action      string
+}
+
+func (e *TransitionError) Error() string {
+	if e.Action != "" {
+		return fmt.Sprintf("release %d cannot %s while %s", e.VersionCode, e.Action, e.From.Description())
+	}
+	return fmt.Sprintf("release %d cannot move from %q to %q", e.VersionCode, e.From, e.To)
+}
+
+// CanTransition reports whether the release may move to the state.
+func (r *Release) CanTransition(to State) error {
+	if !slices.Contains(transitions[r.State], to) {
+		return &TransitionError{VersionCode: r.VersionCode, From: r.State, To: to}
+	}
+	return nil
+}
+
+// Transition moves the release to the state, remembering where a failure happened so that a retry can go back there.
+func (r *Release) Transition(to State) error {
+	if err := r.CanTransition(to); err != nil {
+		return err
+	}
+
+	if to == StateFailed {
+		r.FailedFrom = r.State
+	}
+	r.State = to
+
+	return nil
+}
+
+// Retry moves a failed release back to the state it failed in.
+func (r *Release) Retry() error {
+	if err := r.CanStart(shared.ActionRetry); err != nil {
+		return err
+	}
+
+	r.State = r.FailedFrom
+	r.FailedFrom = StateNone
+
+	return nil
+}
+
+// Revert moves the release back from the state an action claimed before it started,
+// when the action could not be started after all. A release that has moved on since is left alone.
+func (r *Release) Revert(claimed State, from State) {
+	if r.State != claimed {
+		return
+	}
+
+	if from == StateFailed {
+		r.FailedFrom = claimed
+	}
+	r.State = from
+}
+
+// CanStart reports whether a user may start the action in the current state.
+func (r *Release) CanStart(action string) error {
+	if !slices.Contains(actionStates[action], r.State) {
+		return &TransitionError{VersionCode: r.VersionCode, From: r.State, Action: action}
+	}
+	return nil
+}
+
+// ProductionState is the state of a release rolled out to the percentage of production users.
+// A percentage that is not positive is an error rather than a halted rollout, since it is
+// what a result without the percentage decodes to.
+func ProductionState(rolloutPercentage int) (State, error) {
+	switch {
+	case rolloutPercentage <= 0:
+		return StateNone, fmt.Errorf("rollout percentage %d is not positive", rolloutPercentage)
+	case rolloutPercentage >= 100:
+		return StateProductionComplete, nil
+	default:
+		return StateProductionInProgress, nil
+	}
+}
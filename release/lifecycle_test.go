@@ -0,0 +1,182 @@
+package release
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"pachca.com/android-deployment/shared"
+)
+
+func TestReleaseLifecycle(t *testing.T) {
+	r := &Release{VersionCode: 1001}
+
+	steps := []State{
+		StateInternal,
+		StateProductionInProgress,
+		StateHalted,
+		StateProductionInProgress,
+		StateProductionComplete,
+		StateReleasingOtherStores,
+		StateDone,
+	}
+	for _, to := range steps {
+		if err := r.Transition(to); err != nil {
+			t.Fatalf("Expected transition to %s, got %v", to, err)
+		}
+	}
+
+	if err := r.Transition(StateFailed); err == nil {
+		t.Error("Expected a done release not to fail")
+	}
+}
+
+func TestReleaseRejectsIllegalTransitions(t *testing.T) {
+	tests := []struct {
+		from State
+		to   State
+	}{
+		{from: StateInternal, to: StateReleasingOtherStores},
+		{from: StateInternal, to: StateDone},
+		{from: StateHalted, to: StateReleasingOtherStores},
+		{from: StateProductionComplete, to: StateProductionInProgress},
+	}
+
+	for _, tt := range tests {
+		r := &Release{VersionCode: 1001, State: tt.from}
+
+		err := r.Transition(tt.to)
+
+		var transitionErr *TransitionError
+		if !errors.As(err, &transitionErr) {
+			t.Errorf("Expected TransitionError from %q to %q, got %v", tt.from, tt.to, err)
+			continue
+		}
+		if r.State != tt.from {
+			t.Errorf("Expected state to stay %q, got %q", tt.from, r.State)
+		}
+	}
+}
+
+func TestReleaseGuardsActions(t *testing.T) {
+	tests := []struct {
+		state   State
+		allowed []string
+	}{
+		{state: StateNone, allowed: []string{shared.ActionPromote}},
+		{state: StateInternal, allowed: []string{shared.ActionPromote}},
+		{state: StateProductionInProgress, allowed: []string{shared.ActionUpdateRollout, shared.ActionReleaseStores, shared.ActionHalt}},
+		{state: StateHalted, allowed: []string{shared.ActionUpdateRollout}},
+		{state: StateProductionComplete, allowed: []string{shared.ActionReleaseStores}},
+		{state: StateReleasingOtherStores, allowed: nil},
+		{state: StateDone, allowed: nil},
+		{state: StateFailed, allowed: []string{shared.ActionRetry}},
+	}
+
+	actions := []string{shared.ActionPromote, shared.ActionUpdateRollout, shared.ActionReleaseStores, shared.ActionRetry, shared.ActionHalt}
+
+	for _, tt := range tests {
+		r := &Release{VersionCode: 1001, State: tt.state}
+		for _, action := range actions {
+			expected := false
+			for _, allowed := range tt.allowed {
+				if allowed == action {
+					expected = true
+				}
+			}
+
+			if err := r.CanStart(action); (err == nil) != expected {
+				t.Errorf("Expected %s allowed=%v while %q, got %v", action, expected, tt.state, err)
+			}
+		}
+	}
+}
+
+func TestProductionState(t *testing.T) {
+	tests := []struct {
+		rollout  int
+		expected State
+	}{
+		{rollout: 1, expected: StateProductionInProgress},
+		{rollout: 99, expected: StateProductionInProgress},
+		{rollout: 100, expected: StateProductionComplete},
+	}
+
+	for _, tt := range tests {
+		state, err := ProductionState(tt.rollout)
+		if err != nil || state != tt.expected {
+			t.Errorf("Expected %d%% to be %q, got %q, %v", tt.rollout, tt.expected, state, err)
+		}
+	}
+
+	for _, rollout := range []int{0, -5} {
+		if state, err := ProductionState(rollout); err == nil {
+			t.Errorf("Expected %d%% to be rejected, got %q", rollout, state)
+		}
+	}
+}
+
+func TestUnknownReleaseTakesBuildPromotionAndFailure(t *testing.T) {
+	allowed := []State{StateInternal, StateProductionInProgress, StateProductionComplete, StateFailed}
+
+	for _, to := range States {
+		r := &Release{VersionCode: 1001}
+		err := r.Transition(to)
+		if expected := slices.Contains(allowed, to); (err == nil) != expected {
+			t.Errorf("Expected unknown release allowed=%v to move to %q, got %v", expected, to, err)
+		}
+	}
+}
+
+func TestReleaseRetryReturnsToFailedState(t *testing.T) {
+	r := &Release{VersionCode: 1001, State: StateProductionComplete}
+
+	if err := r.Transition(StateFailed); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := r.Retry(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if r.State != StateProductionComplete {
+		t.Errorf("Expected state %q after retry, got %q", StateProductionComplete, r.State)
+	}
+	if err := r.Retry(); err == nil {
+		t.Error("Expected retry of a release that has not failed to be rejected")
+	}
+}
+
+func TestFailedReleaseMovesOnToAnyStateButDone(t *testing.T) {
+	for _, to := range States {
+		r := &Release{VersionCode: 1001, State: StateFailed, FailedFrom: StateReleasingOtherStores}
+		err := r.Transition(to)
+		if expected := to != StateDone && to != StateFailed; (err == nil) != expected {
+			t.Errorf("Expected failed release allowed=%v to move to %q, got %v", expected, to, err)
+		}
+	}
+}
+
+func TestReleaseRevertsClaimedState(t *testing.T) {
+	r := &Release{VersionCode: 1001, State: StateProductionComplete}
+	if err := r.Transition(StateReleasingOtherStores); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	r.Revert(StateReleasingOtherStores, StateProductionComplete)
+	if r.State != StateProductionComplete {
+		t.Errorf("Expected state %q after revert, got %q", StateProductionComplete, r.State)
+	}
+
+	r = &Release{VersionCode: 1001, State: StateFailed, FailedFrom: StateInternal}
+	if err := r.Retry(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	r.Revert(StateInternal, StateFailed)
+	if r.State != StateFailed || r.FailedFrom != StateInternal {
+		t.Errorf("Expected failed release to retry from %q, got %q from %q", StateInternal, r.State, r.FailedFrom)
+	}
+
+	r = &Release{VersionCode: 1001, State: StateDone}
+	r.Revert(StateReleasingOtherStores, StateProductionComplete)
+	if r.State != StateDone {
+		t.Errorf("Expected a release that moved on to stay %q, got %q", StateDone, r.State)
+	}
+}
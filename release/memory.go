@@ -0,0 +1,61 @@
+package release
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+type MemoryStore struct {
+	mu       sync.Mutex
+	releases map[int]*Release
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{releases: make(map[int]*Release)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, versionCode int) (*Release, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.releases[versionCode]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(r), nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, versionCode int, fn func(*Release) error) (*Release, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &Release{VersionCode: versionCode}
+	if existing, ok := s.releases[versionCode]; ok {
+		r = clone(existing)
+	}
+
+	if err := fn(r); err != nil {
+		return nil, err
+	}
+
+	s.releases[versionCode] = clone(r)
+	return r, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]*Release, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	releases := make([]*Release, 0, len(s.releases))
+	for _, r := range s.releases {
+		releases = append(releases, clone(r))
+	}
+	sort.Slice(releases, func(i, j int) bool { return releases[i].VersionCode < releases[j].VersionCode })
+
+	return releases, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
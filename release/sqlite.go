@@ -0,0 +1,134 @@
+package release
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStore keeps every release as a JSON document in a row keyed by version code.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	if path == "" {
+		return nil, fmt.Errorf("sqlite release store needs a path")
+	}
+
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// A single connection serializes updates, which SQLite would do anyway.
+	db.SetMaxOpenConns(1)
+
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS releases (
+		version_code INTEGER PRIMARY KEY,
+		data TEXT NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStore{db: db}, nil
+}
+
+func (s *SQLiteStore) Get(ctx context.Context, versionCode int) (*Release, error) {
+	return getRelease(ctx, s.db, versionCode)
+}
+
+func (s *SQLiteStore) Update(ctx context.Context, versionCode int, fn func(*Release) error) (*Release, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	r, err := getRelease(ctx, tx, versionCode)
+	if errors.Is(err, ErrNotFound) {
+		r = &Release{VersionCode: versionCode}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := fn(r); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO releases (version_code, data, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (version_code) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`,
+		versionCode, string(data), r.UpdatedAt.Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (s *SQLiteStore) List(ctx context.Context) ([]*Release, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT data FROM releases ORDER BY version_code`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var releases []*Release
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var r Release
+		if err := json.Unmarshal([]byte(data), &r); err != nil {
+			return nil, err
+		}
+		releases = append(releases, &r)
+	}
+
+	return releases, rows.Err()
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func getRelease(ctx context.Context, q queryer, versionCode int) (*Release, error) {
+	var data string
+	err := q.QueryRowContext(ctx, `SELECT data FROM releases WHERE version_code = ?`, versionCode).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var r Release
+	if err := json.Unmarshal([]byte(data), &r); err != nil {
+		return nil, err
+	}
+
+	return &r, nil
+}
@@ -0,0 +1,125 @@
+// Package release keeps track of Android releases between the webhooks that move them forward.
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("release not found")
+
+// Tracks a release can be in.
+const (
+	TrackInternal   string = "internal"
+	TrackProduction string = "production"
+)
+
+// Release is everything known about a version since it was uploaded to Google Play Internal.
+type Release struct {
+	VersionCode       int                        `json:"version_code"`
+	VersionName       string                     `json:"version_name"`
+	JobID             int                        `json:"job_id"`
+	MessageID         int                        `json:"message_id"`
+	State             State                      `json:"state"`
+	FailedFrom        State                      `json:"failed_from,omitempty"`
+	Track             string                     `json:"track"`
+	RolloutPercentage int                        `json:"rollout_percentage"`
+	Stores            map[string]string          `json:"stores,omitempty"`
+	History           []Event                    `json:"history,omitempty"`
+	Deliveries        map[string]*DeliveryRecord `json:"deliveries,omitempty"`
+	UpdatedAt         time.Time                  `json:"updated_at"`
+}
+
+// Event is an entry in the history of a release.
+type Event struct {
+	At     time.Time `json:"at"`
+	Event  string    `json:"event"`
+	Detail string    `json:"detail,omitempty"`
+}
+
+func (r *Release) Record(at time.Time, event string, detail string) {
+	r.History = append(r.History, Event{At: at, Event: event, Detail: detail})
+	r.UpdatedAt = at
+}
+
+// Store keeps releases keyed by version code.
+type Store interface {
+	// Get returns ErrNotFound when the version is unknown.
+	Get(ctx context.Context, versionCode int) (*Release, error)
+	// Update loads the release, or a new one with only VersionCode set, and saves it
+	// if fn succeeds. Updates of the same store do not interleave.
+	Update(ctx context.Context, versionCode int, fn func(*Release) error) (*Release, error)
+	List(ctx context.Context) ([]*Release, error)
+	Close() error
+}
+
+// Store kinds selectable by configuration.
+const (
+	StoreMemory string = "memory"
+	StoreFile   string = "file"
+	StoreSQLite string = "sqlite"
+)
+
+var (
+	storesMu sync.Mutex
+	stores   = make(map[string]Store)
+)
+
+// OpenStore returns the store of the given kind at path. Stores are opened once
+// per process and shared between requests, so that the in-memory store keeps
+// its releases and file based stores are not reopened for every webhook.
+func OpenStore(kind string, path string) (Store, error) {
+	if kind == "" {
+		kind = StoreMemory
+	}
+
+	storesMu.Lock()
+	defer storesMu.Unlock()
+
+	key := kind + ":" + path
+	if store, ok := stores[key]; ok {
+		return store, nil
+	}
+
+	var store Store
+	var err error
+	switch kind {
+	case StoreMemory:
+		store = NewMemoryStore()
+	case StoreFile:
+		store, err = NewFileStore(path)
+	case StoreSQLite:
+		store, err = NewSQLiteStore(path)
+	default:
+		return nil, fmt.Errorf("unknown release store %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stores[key] = store
+	return store, nil
+}
+
+func clone(r *Release) *Release {
+	c := *r
+	if r.Stores != nil {
+		c.Stores = make(map[string]string, len(r.Stores))
+		for name, status := range r.Stores {
+			c.Stores[name] = status
+		}
+	}
+	c.History = append([]Event(nil), r.History...)
+	if r.Deliveries != nil {
+		c.Deliveries = make(map[string]*DeliveryRecord, len(r.Deliveries))
+		for key, record := range r.Deliveries {
+			recordCopy := *record
+			recordCopy.Steps = append([]string(nil), record.Steps...)
+			c.Deliveries[key] = &recordCopy
+		}
+	}
+	return &c
+}
@@ -0,0 +1,140 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStores(t *testing.T) {
+	tests := []struct {
+		name string
+		open func(t *testing.T, path string) Store
+	}{
+		{
+			name: "memory",
+			open: func(t *testing.T, path string) Store { return NewMemoryStore() },
+		},
+		{
+			name: "file",
+			open: func(t *testing.T, path string) Store {
+				store, err := NewFileStore(filepath.Join(path, "releases.json"))
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				return store
+			},
+		},
+		{
+			name: "sqlite",
+			open: func(t *testing.T, path string) Store {
+				store, err := NewSQLiteStore(filepath.Join(path, "releases.db"))
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				return store
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := tt.open(t, t.TempDir())
+			defer store.Close()
+
+			if _, err := store.Get(ctx, 42); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("Expected ErrNotFound, got %v", err)
+			}
+
+			now := time.Unix(1755075544, 0).UTC()
+			_, err := store.Update(ctx, 42, func(r *Release) error {
+				r.VersionName = "1.0.0"
+				r.MessageID = 194275
+				r.Track = TrackInternal
+				r.Record(now, "build", "job 100")
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			_, err = store.Update(ctx, 42, func(r *Release) error {
+				r.Track = TrackProduction
+				r.RolloutPercentage = 25
+				r.Stores = map[string]string{"rustore": "success"}
+				r.Record(now.Add(time.Minute), "promote", "25%")
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			failed := errors.New("failed")
+			_, err = store.Update(ctx, 42, func(r *Release) error {
+				r.RolloutPercentage = 100
+				return failed
+			})
+			if !errors.Is(err, failed) {
+				t.Fatalf("Expected update error, got %v", err)
+			}
+
+			r, err := store.Get(ctx, 42)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if r.VersionCode != 42 || r.VersionName != "1.0.0" || r.MessageID != 194275 {
+				t.Errorf("Unexpected release: %+v", r)
+			}
+			if r.Track != TrackProduction || r.RolloutPercentage != 25 {
+				t.Errorf("Expected production track at 25%%, got %s at %d%%", r.Track, r.RolloutPercentage)
+			}
+			if r.Stores["rustore"] != "success" {
+				t.Errorf("Expected rustore status 'success', got '%s'", r.Stores["rustore"])
+			}
+			if len(r.History) != 2 || r.History[1].Event != "promote" {
+				t.Errorf("Unexpected history: %+v", r.History)
+			}
+
+			store.Update(ctx, 7, func(r *Release) error { return nil })
+			releases, err := store.List(ctx)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if len(releases) != 2 || releases[0].VersionCode != 7 || releases[1].VersionCode != 42 {
+				t.Errorf("Unexpected releases: %+v", releases)
+			}
+		})
+	}
+}
+
+func TestFileStoreSurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "releases.json")
+
+	store, _ := NewFileStore(path)
+	store.Update(context.Background(), 42, func(r *Release) error {
+		r.MessageID = 194275
+		return nil
+	})
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	r, err := reopened.Get(context.Background(), 42)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if r.MessageID != 194275 {
+		t.Errorf("Expected message id 194275, got %d", r.MessageID)
+	}
+}
+
+func TestOpenStoreRejectsUnknownKind(t *testing.T) {
+	if _, err := OpenStore("redis", ""); err == nil {
+		t.Error("Expected error for unknown store kind")
+	}
+}
@@ -0,0 +1,95 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// Release actions that can be restricted by a Policy.
+const (
+	ActionPromote       string = "promote"
+	ActionUpdateRollout string = "update_rollout"
+	ActionReleaseStores string = "release_stores"
+	ActionRetry         string = "retry"
+	ActionHalt          string = "halt"
+)
+
+// PipelineActions names the Gitlab pipelines, and the events they report, by the actions of the release policy.
+var PipelineActions = map[string]string{
+	"promote":      ActionPromote,
+	"rollout":      ActionUpdateRollout,
+	"other_stores": ActionReleaseStores,
+	"halt":         ActionHalt,
+}
+
+// Policy maps release actions to the Pachca users allowed to perform them,
+// either directly or through named groups of user IDs.
+//
+//	{
+//	  "groups": {"release-managers": [123, 456]},
+//	  "actions": {
+//	    "promote": {"groups": ["release-managers"]},
+//	    "update_rollout": {"users": [789], "groups": ["release-managers"]}
+//	  }
+//	}
+type Policy struct {
+	Groups  map[string][]int        `json:"groups" yaml:"groups" toml:"groups"`
+	Actions map[string]ActionPolicy `json:"actions" yaml:"actions" toml:"actions"`
+}
+
+type ActionPolicy struct {
+	Users  []int    `json:"users" yaml:"users" toml:"users"`
+	Groups []string `json:"groups" yaml:"groups" toml:"groups"`
+}
+
+func ParsePolicy(data string) (*Policy, error) {
+	var policy Policy
+	if err := json.Unmarshal([]byte(data), &policy); err != nil {
+		return nil, fmt.Errorf("invalid policy json: %w", err)
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &policy, nil
+}
+
+// Validate checks that actions only refer to groups the policy defines.
+func (p *Policy) Validate() error {
+	for action, actionPolicy := range p.Actions {
+		for _, group := range actionPolicy.Groups {
+			if _, ok := p.Groups[group]; !ok {
+				return fmt.Errorf("policy for %q refers to unknown group %q", action, group)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Allows reports whether the user may perform the action.
+// A nil policy allows everything, while a configured policy denies actions it does not list.
+func (p *Policy) Allows(action string, userID int) bool {
+	if p == nil {
+		return true
+	}
+
+	actionPolicy, ok := p.Actions[action]
+	if !ok {
+		return false
+	}
+
+	if slices.Contains(actionPolicy.Users, userID) {
+		return true
+	}
+
+	for _, group := range actionPolicy.Groups {
+		if slices.Contains(p.Groups[group], userID) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,44 @@
+package shared
+
+import (
+	"sync"
+	"time"
+)
+
+// ReplayCache remembers webhook keys until their freshness window closes,
+// so that a captured webhook cannot be delivered twice.
+type ReplayCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func NewReplayCache() *ReplayCache {
+	return &ReplayCache{seen: make(map[string]time.Time)}
+}
+
+// Seen records the key until expiresAt and reports whether it was already recorded.
+func (c *ReplayCache) Seen(key string, expiresAt time.Time, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, exp := range c.seen {
+		if !exp.After(now) {
+			delete(c.seen, k)
+		}
+	}
+
+	if _, ok := c.seen[key]; ok {
+		return true
+	}
+
+	c.seen[key] = expiresAt
+	return false
+}
+
+// Forget drops the key, so that the webhook can be delivered again after it failed.
+func (c *ReplayCache) Forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.seen, key)
+}
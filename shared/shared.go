@@ -4,6 +4,7 @@ type ReleaseInfo struct {
 	JobID       int    `json:"job_id"`
 	VersionCode int    `json:"version_code"`
 	VersionName string `json:"version_name"`
+	MessageID   int    `json:"message_id,omitempty"`
 }
 
 const (
@@ -15,8 +16,55 @@ const (
 	EnvGitlabKey string = "ENV_GITLAB_KEY"
 	EnvLinearKey string = "ENV_LINEAR_KEY"
 
+	EnvPachcaSigningSecret string = "ENV_PACHCA_SIGNING_SECRET"
+	EnvPachcaWebhookMaxAge string = "ENV_PACHCA_WEBHOOK_MAX_AGE"
+	EnvGitlabWebhookToken  string = "ENV_GITLAB_WEBHOOK_TOKEN"
+
+	EnvReleasePolicy     string = "ENV_RELEASE_POLICY"
+	EnvReleaseSigningKey string = "ENV_RELEASE_SIGNING_KEY"
+	EnvReleaseDataTTL    string = "ENV_RELEASE_DATA_TTL"
+
+	EnvReleaseStore     string = "ENV_RELEASE_STORE"
+	EnvReleaseStorePath string = "ENV_RELEASE_STORE_PATH"
+
+	EnvReleaseNotesLocales              string = "ENV_RELEASE_NOTES_LOCALES"
+	EnvReleaseNotesPlayMaxLength        string = "ENV_RELEASE_NOTES_PLAY_MAX_LENGTH"
+	EnvReleaseNotesOtherStoresMaxLength string = "ENV_RELEASE_NOTES_OTHER_STORES_MAX_LENGTH"
+
+	EnvGitlabProjectId string = "ENV_GITLAB_PROJECT_ID"
+	EnvGitlabRef       string = "ENV_GITLAB_REF"
+
 	EnvPachcaInternalChatId string = "ENV_PACHCA_INTERNAL_CHAT_ID"
 	EnvPachcaPublicChatId   string = "ENV_PACHCA_PUBLIC_CHAT_ID"
+	EnvPachcaTimeout        string = "ENV_PACHCA_TIMEOUT"
+	EnvPachcaMaxAttempts    string = "ENV_PACHCA_MAX_ATTEMPTS"
+	EnvPachcaRetryBudget    string = "ENV_PACHCA_RETRY_BUDGET"
 
 	EnvLinearTeamId string = "ENV_LINEAR_TEAM_ID"
+
+	EnvConfigFile string = "ENV_CONFIG_FILE"
+
+	EnvServerAddr            string = "ENV_SERVER_ADDR"
+	EnvServerTLSCert         string = "ENV_SERVER_TLS_CERT"
+	EnvServerTLSKey          string = "ENV_SERVER_TLS_KEY"
+	EnvServerReadTimeout     string = "ENV_SERVER_READ_TIMEOUT"
+	EnvServerWriteTimeout    string = "ENV_SERVER_WRITE_TIMEOUT"
+	EnvServerShutdownTimeout string = "ENV_SERVER_SHUTDOWN_TIMEOUT"
+
+	EnvQueueStore       string = "ENV_QUEUE_STORE"
+	EnvQueuePath        string = "ENV_QUEUE_PATH"
+	EnvQueueWorkers     string = "ENV_QUEUE_WORKERS"
+	EnvQueueMaxAttempts string = "ENV_QUEUE_MAX_ATTEMPTS"
+	EnvQueueBackoff     string = "ENV_QUEUE_BACKOFF"
+	EnvQueueMaxBackoff  string = "ENV_QUEUE_MAX_BACKOFF"
+
+	EnvAuditStore string = "ENV_AUDIT_STORE"
+	EnvAuditPath  string = "ENV_AUDIT_PATH"
+
+	EnvLogLevel        string = "ENV_LOG_LEVEL"
+	EnvLogFormat       string = "ENV_LOG_FORMAT"
+	EnvLogDumpPayloads string = "ENV_LOG_DUMP_PAYLOADS"
+
+	EnvTracingEndpoint    string = "ENV_TRACING_ENDPOINT"
+	EnvTracingServiceName string = "ENV_TRACING_SERVICE_NAME"
 )
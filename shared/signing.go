@@ -0,0 +1,74 @@
+package shared
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid release info signature")
+	ErrExpired          = errors.New("release info expired")
+	ErrWrongAction      = errors.New("release info signed for another action")
+)
+
+type signedReleaseInfo struct {
+	Action string `json:"action"`
+	ReleaseInfo
+	ExpiresAt int64 `json:"exp"`
+}
+
+// SignReleaseInfo serializes ReleaseInfo for button data and private_metadata
+// as "<json>|<signature>", where the JSON carries the action it is meant for and an expiry,
+// and the signature is a base64url HMAC-SHA256 of the JSON.
+func SignReleaseInfo(key string, action string, releaseInfo ReleaseInfo, expiresAt time.Time) (string, error) {
+	payload, err := json.Marshal(signedReleaseInfo{
+		Action:      action,
+		ReleaseInfo: releaseInfo,
+		ExpiresAt:   expiresAt.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(payload) + "|" + releaseInfoSignature(key, payload), nil
+}
+
+// VerifyReleaseInfo checks the signature, action and expiry of data produced by SignReleaseInfo.
+func VerifyReleaseInfo(key string, action string, data string, now time.Time) (*ReleaseInfo, error) {
+	i := strings.LastIndex(data, "|")
+	if i < 0 {
+		return nil, ErrInvalidSignature
+	}
+	payload, signature := []byte(data[:i]), data[i+1:]
+
+	expected := releaseInfoSignature(key, payload)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return nil, ErrInvalidSignature
+	}
+
+	var signed signedReleaseInfo
+	if err := json.Unmarshal(payload, &signed); err != nil {
+		return nil, err
+	}
+
+	if signed.Action != action {
+		return nil, ErrWrongAction
+	}
+
+	if !now.Before(time.Unix(signed.ExpiresAt, 0)) {
+		return nil, ErrExpired
+	}
+
+	return &signed.ReleaseInfo, nil
+}
+
+func releaseInfoSignature(key string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,189 @@
+// Package tracing follows a release action through the bot for OpenTelemetry: the webhook that
+// starts it, the calls to Pachca and Gitlab, and the Gitlab webhook that reports its result.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"pachca.com/android-deployment/shared"
+)
+
+const tracerName = "pachca.com/android-deployment"
+
+// TraceparentVariable is the pipeline variable that carries the trace of the action
+// that started a pipeline. CI jobs send it back as "traceparent" in their webhooks.
+const TraceparentVariable = "TRACEPARENT"
+
+// Options are the tracing settings of the config file.
+type Options struct {
+	// Endpoint is the OTLP/HTTP URL of a collector, like http://localhost:4318.
+	// Tracing is off while it is empty.
+	Endpoint string `yaml:"endpoint" toml:"endpoint"`
+	// ServiceName names the bot in traces.
+	ServiceName string `yaml:"service_name" toml:"service_name"`
+}
+
+// Validate reports an endpoint the exporter could not send to.
+func (o Options) Validate() error {
+	if o.Endpoint == "" {
+		return nil
+	}
+	endpoint, err := url.Parse(o.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return fmt.Errorf("tracing endpoint %q is not an http or https URL", o.Endpoint)
+	}
+	return nil
+}
+
+// propagator reads and writes the W3C traceparent.
+var propagator = propagation.TraceContext{}
+
+// Setup installs a tracer provider exporting spans to the endpoint. The returned function
+// flushes and stops the exporter. Without an endpoint spans are dropped.
+func Setup(ctx context.Context, options Options) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagator)
+	if options.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(options.Endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := options.ServiceName
+	if serviceName == "" {
+		serviceName = "android-release-bot"
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Flush exports the spans ended so far, for hosts that may freeze the process between requests.
+func Flush(ctx context.Context) error {
+	if provider, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); ok {
+		return provider.ForceFlush(ctx)
+	}
+	return nil
+}
+
+func start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, options...)
+}
+
+// StartWebhook starts the span of an incoming webhook, continuing a trace the sender propagated.
+func StartWebhook(r *http.Request, source string) (*http.Request, trace.Span) {
+	ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := start(ctx, source+" webhook",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.HTTPRequestMethodKey.String(r.Method), semconv.URLPath(r.URL.Path)),
+	)
+	return r.WithContext(ctx), span
+}
+
+// EndWebhook records the status a handler answered with and ends the span of the webhook.
+func EndWebhook(span trace.Span, status int) {
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if status >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
+// StartJob starts the span of a queued job within the trace of the webhook that queued it.
+func StartJob(ctx context.Context, name string, traceparent string) (context.Context, trace.Span) {
+	if parent := spanContext(traceparent); parent.IsValid() {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, parent)
+	}
+	return start(ctx, name, trace.WithSpanKind(trace.SpanKindConsumer))
+}
+
+// StartLinked starts a span of work that follows from an earlier trace, such as the result of
+// a pipeline, and links it to the span the traceparent names.
+func StartLinked(ctx context.Context, name string, traceparent string) (context.Context, trace.Span) {
+	var options []trace.SpanStartOption
+	if origin := spanContext(traceparent); origin.IsValid() {
+		options = append(options, trace.WithLinks(trace.Link{SpanContext: origin}))
+	}
+	return start(ctx, name, options...)
+}
+
+// StartCall starts the span of a call to Pachca or Gitlab.
+func StartCall(ctx context.Context, service string, method string, path string) (context.Context, trace.Span) {
+	return start(ctx, service+" "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPRequestMethodKey.String(method), semconv.URLPath(path)),
+	)
+}
+
+// EndCall records the status of a call, or the error when no response came back, and ends its span.
+func EndCall(span trace.Span, statusCode int, err error) {
+	if err == nil {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(statusCode))
+		if statusCode >= 400 {
+			err = errors.New(http.StatusText(statusCode))
+		}
+	}
+	End(span, err)
+}
+
+// End marks the span as failed when err is set and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// SetRelease describes the release the current span works on.
+func SetRelease(ctx context.Context, releaseInfo *shared.ReleaseInfo) {
+	if releaseInfo == nil {
+		return
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int("release.version_code", releaseInfo.VersionCode),
+		attribute.String("release.version_name", releaseInfo.VersionName),
+		attribute.Int("release.job_id", releaseInfo.JobID),
+		attribute.Int("release.message_id", releaseInfo.MessageID),
+	)
+}
+
+// Set adds attributes to the current span.
+func Set(ctx context.Context, attributes ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).SetAttributes(attributes...)
+}
+
+// Traceparent returns the W3C traceparent of the current span, or "" outside a sampled trace.
+func Traceparent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+func spanContext(traceparent string) trace.SpanContext {
+	if traceparent == "" {
+		return trace.SpanContext{}
+	}
+	ctx := propagator.Extract(context.Background(), propagation.MapCarrier{"traceparent": traceparent})
+	return trace.SpanContextFromContext(ctx)
+}
@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"pachca.com/android-deployment/shared"
+)
+
+const clickTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return recorder
+}
+
+func TestWebhookContinuesPropagatedTrace(t *testing.T) {
+	recorder := recordSpans(t)
+
+	req := httptest.NewRequest("POST", "/pachca/webhook", nil)
+	req.Header.Set("traceparent", clickTraceparent)
+
+	req, span := StartWebhook(req, "pachca")
+	SetRelease(req.Context(), &shared.ReleaseInfo{JobID: 12345, VersionCode: 1001, VersionName: "1.0.1"})
+	traceparent := Traceparent(req.Context())
+	EndWebhook(span, http.StatusInternalServerError)
+
+	if !strings.HasPrefix(traceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || traceparent == clickTraceparent {
+		t.Errorf("Expected traceparent of a new span in the propagated trace, got %q", traceparent)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	if spans[0].Status().Code != codes.Error {
+		t.Errorf("Expected failed webhook span, got status %v", spans[0].Status())
+	}
+	attributes := map[string]string{}
+	for _, attribute := range spans[0].Attributes() {
+		attributes[string(attribute.Key)] = attribute.Value.Emit()
+	}
+	if attributes["release.version_code"] != "1001" || attributes["release.version_name"] != "1.0.1" {
+		t.Errorf("Expected release attributes, got %v", attributes)
+	}
+}
+
+func TestStartJobContinuesQueuedTrace(t *testing.T) {
+	recorder := recordSpans(t)
+
+	_, span := StartJob(context.Background(), "pachca pipeline job", clickTraceparent)
+	End(span, errors.New("gitlab is down"))
+
+	ended := recorder.Ended()[0]
+	if ended.Parent().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || ended.SpanContext().TraceID() != ended.Parent().TraceID() {
+		t.Errorf("Expected job span in the queued trace, got parent %v", ended.Parent())
+	}
+	if ended.Status().Code != codes.Error {
+		t.Errorf("Expected failed job span, got status %v", ended.Status())
+	}
+}
+
+func TestStartLinkedLinksPipelineResult(t *testing.T) {
+	recorder := recordSpans(t)
+
+	_, span := StartLinked(context.Background(), "gitlab promote", clickTraceparent)
+	span.End()
+	_, unlinked := StartLinked(context.Background(), "gitlab build", "not a traceparent")
+	unlinked.End()
+
+	spans := recorder.Ended()
+	if links := spans[0].Links(); len(links) != 1 || links[0].SpanContext.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected link to the button click, got %v", links)
+	}
+	if spans[0].Parent().IsValid() {
+		t.Errorf("Expected pipeline result to start its own trace, got parent %v", spans[0].Parent())
+	}
+	if links := spans[1].Links(); len(links) != 0 {
+		t.Errorf("Expected no link for an invalid traceparent, got %v", links)
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	for endpoint, valid := range map[string]bool{
+		"":                       true,
+		"http://localhost:4318":  true,
+		"https://collector:4318": true,
+		"localhost:4318":         false,
+		"grpc://localhost:4317":  false,
+	} {
+		if err := (Options{Endpoint: endpoint}).Validate(); (err == nil) != valid {
+			t.Errorf("Expected endpoint %q valid=%v, got %v", endpoint, valid, err)
+		}
+	}
+}